@@ -0,0 +1,84 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"strings"
+)
+
+// ----------------------- Annotations -----------------------
+
+// Annotations sit between the identifier block and the ' :' that precedes the filename.  Each one is a
+// 'key=value' token containing no spaces, and they are only written out in format 5 (full) records.
+// The --annotate switch takes a comma-separated list of annotators, e.g. "--annotate media".
+
+var cli_annotate string = "" // comma-separated list of annotators to run on each file
+
+// check that the annotators requested on the command line are ones we know about
+func annotateValidate() {
+	chunksValidate()
+	if cli_annotate == "" {
+		return
+	}
+	for _, a := range strings.Split(cli_annotate, ",") {
+		switch a {
+		case "media", "owner":
+		default:
+			abort(6, "Unknown annotator '"+a+"' (valid: media, owner)")
+		}
+	}
+}
+
+// run the requested annotators against a file, returning a space-separated annotation string (or "")
+func getAnnotations(fn string) string {
+	if target := entryLink(fn); target != "" {
+		return entryLinkAnnotation(target)
+	}
+	if kind, dev := entrySpecial(fn); kind != "" {
+		return entrySpecialAnnotation(kind, dev)
+	}
+	if (cli_annotate == "" && chunkMin == 0) || strings.HasSuffix(fn, "/") {
+		return ""
+	}
+
+	var annots []string
+	for _, a := range strings.Split(cli_annotate, ",") {
+		switch a {
+		case "media":
+			annots = append(annots, mediaAnnotations(fn)...)
+		case "owner":
+			annots = append(annots, ownerAnnotations(fn)...)
+		}
+	}
+	if chunkMin > 0 {
+		if c := chunkAnnotation(fn); c != "" {
+			annots = append(annots, c)
+		}
+	}
+	return strings.Join(annots, " ")
+}
+
+// make a value safe to be an annotation (no spaces, cannot look like a filename marker)
+func annotationValue(v string) string {
+	v = strings.TrimSpace(v)
+	v = strings.ReplaceAll(v, " ", "_")
+	v = strings.TrimLeft(v, ":")
+	return v
+}
+
+// split an annotation string into a key/value map (tokens without '=' get an empty value)
+func annotationMap(annot string) map[string]string {
+	m := map[string]string{}
+	for _, tok := range strings.Fields(annot) {
+		k, v, _ := strings.Cut(tok, "=")
+		m[k] = v
+	}
+	return m
+}
+
+// return the annotation part of an SSF line (between identifier and name) or "" if none
+func ssfAnnotations(s string) string {
+	rec, _ := parseSSFRecord(s)
+	return rec.annot
+}
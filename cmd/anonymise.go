@@ -5,34 +5,103 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 
 	"github.com/spf13/cobra"
 )
 
+// -------------------------------- Cobra management -------------------------------
+
 // anonymiseCmd represents the anonymise command
 var anonymiseCmd = &cobra.Command{
-	Use:   "anonymise",
+	Use:   "anonymise in.ssf [out.ssf] [-f format]",
 	Short: "Remove all data except SHA hashes from file",
-	Long: `Removes the filename, size and last used information from an .ssf file to leave only the hashes - useful
-when you want to have a very small .ssf for the purposes of checking for the presence of files without wanting to 
-disclose the filenames such as a list of customer names, account codes or other related personally-identifiable 
-information (PII).  An .ssf with only hashes can still be used for comparisons.`,
+	Long: `shaman anonymise in.ssf [out.ssf] [-f format] [--encrypt-to recipient] [--dry-run]
+Removes the filenames from an .ssf file (and, by default, the size and modify time too) to leave only
+the hashes - useful when you want to have a very small .ssf for the purposes of checking for the presence
+of files without wanting to disclose the filenames such as a list of customer names, account codes or
+other related personally-identifiable information (PII).  An .ssf with only hashes can still be used for
+comparisons.  The format says how much is kept:
+   shaman ano in.ssf anon.ssf                     # format 1 (SHA only - max anonymised)
+   shaman ano in.ssf anon.ssf -f 2                # SHA and modify time
+   shaman ano in.ssf anon.ssf -f 3                # SHA, modify time and size
+   shaman ano in.ssf anon.ssf -f full             # SHA, modify time, size and annotations
+Each SHA appears once: where a file is held more than once, its record is the one with the earliest
+modify time (as in 'shaman consolidate').  Output is sorted by SHA.  A 'full' record keeps its place
+for a name, left empty (' :') - the annotations (e.g. dur=, res=, taken=) are kept, the name is not.
+Comments are dropped.  The output goes to stdout if no out.ssf is given, and must not already exist.
+With --encrypt-to, the output is encrypted as it is written, as for 'shaman generate'.
+With --dry-run, the anonymisation is done but nothing is written.`,
 	Aliases: []string{"ano", "anonymize"},
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G3",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("anonymise called")
+		ano(args)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(anonymiseCmd)
 
-	// Here you will define your flags and configuration settings.
+	anonymiseCmd.Flags().StringVarP(&cli_format, "format", "f", "", "Format: sha, sha+time, sha+time+size or full (or 1..3, 5, default 1)")
+	anonymiseCmd.Flags().BoolVarP(&cli_dryrun, "dry-run", "n", false, "Do everything but write: report what would be written")
+	anonymiseCmd.Flags().StringVarP(&cli_encryptto, "encrypt-to", "", "", "Encrypt the output to an age recipient (age1...) or PGP key")
+}
+
+// ----------------------- Anonymise function below this line -----------------------
+
+func ano(args []string) {
+	form := formatParse(1, 1, 2, 3, 5) // format: default is 1 (SHA only)
+
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found, "form", form)
+	fnr, fnw := files[0], ""
+	switch {
+	case !found[0]:
+		abort(6, "Input SSF file '"+fnr+"' does not exist")
+	case num == 2 && found[1]:
+		abort(6, "Output file '"+files[1]+"' already exists")
+	case num == 2:
+		fnw = files[1]
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// anonymiseCmd.PersistentFlags().String("foo", "", "A help for foo")
+	w := writeInit(fnw)
+	var shas, rows int
+	switch {
+	case form == 5:
+		// whole records, with the earliest modify time for each SHA, and the name left empty
+		hits := map[string]ssfRecord{}
+		ssfForEachRecord(fnr, func(rec ssfRecord) {
+			if rec.format < 3 || rec.format == 9 {
+				abort(6, fmt.Sprintf("File %s has format %d records - cannot produce format %d", fnr, rec.format, form))
+			}
+			rows++
+			if old, ok := hits[rec.shab64]; ok && old.modtime <= rec.modtime {
+				return
+			}
+			rec.name = ""
+			hits[rec.shab64] = rec
+		})
+		shas = len(hits)
+		for _, k := range slices.Sorted(maps.Keys(hits)) {
+			r := hits[k]
+			w.record(true, form, 0, "N", r.shab64, r.modtime, r.size, r.annot, "", "")
+		}
+	case extSortWanted(fnr):
+		// too big for memory - sort on disk
+		shas, rows = ssfCollectSorted(fnr, w.Writer, nil, form)
+	default:
+		hits := map[string]string{} // SHA -> empty string, mod-time, or composite time/size
+		shas, rows = ssfCollectRead(fnr, hits, nil, form)
+		for _, k := range slices.Sorted(maps.Keys(hits)) {
+			fmt.Fprintln(w, k+hits[k])
+		}
+	}
+	w.close()
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// anonymiseCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	if fnw != "" && !cli_dryrun {
+		fmt.Printf("Anonymised %s records to %s SHAs in %s\n", intAsString(int64(rows)), intAsString(int64(shas)), fnw)
+	}
 }
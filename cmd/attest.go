@@ -0,0 +1,160 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// attestCmd represents the attest command
+var attestCmd = &cobra.Command{
+	Use:   "attest file.ssf",
+	Short: "Write an SSF as an in-toto attestation statement",
+	Long: `shaman attest file.ssf [--predicate-out att.json] [-p root-name]
+Emits the manifest as an in-toto Statement (v1) with a SLSA provenance (v0.2) predicate, so that a
+manifest can be passed to supply-chain tooling (signing, policy checks, transparency logs):
+   subject     the tree root - named by -p (default: the SSF's name), with the SHA256 of the canonical SSF
+   materials   every file in the SSF, with its SHA256 (as hex)
+The canonical SSF is its records, re-encoded canonically and sorted by name, each ending in a newline,
+without comments - so the digest does not change when only comments or field encodings do.
+Writes to stdout unless --predicate-out is given.`,
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		att(args)
+	},
+}
+
+var cli_predicateout string = "" // attest output file
+
+func init() {
+	rootCmd.AddCommand(attestCmd)
+
+	attestCmd.Flags().StringVarP(&cli_predicateout, "predicate-out", "", "", "Write the statement to this file (default: stdout)")
+	attestCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Name for the tree root (default: the SSF's name)")
+	attestCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Overwrite the output file if it exists")
+}
+
+// ----------------------- Attest function below this line -----------------------
+
+// the canonical form of an SSF - its records, re-encoded and sorted, without comments
+func ssfCanonical(fn string) []byte {
+	var recs []ssfRecord
+	ssfForEachRecord(fn, func(rec ssfRecord) {
+		recs = append(recs, rec)
+	})
+	sortRecords(recs)
+	var b strings.Builder
+	for _, rec := range recs {
+		b.WriteString(ssfRecordLine(rec))
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// in-toto statement (https://github.com/in-toto/attestation/blob/main/spec/v1/statement.md)
+type intotoDigest struct {
+	Sha256 string `json:"sha256"`
+}
+
+type intotoSubject struct {
+	Name   string       `json:"name"`
+	Digest intotoDigest `json:"digest"`
+}
+
+type intotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []intotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     slsaProvenance  `json:"predicate"`
+}
+
+// SLSA provenance v0.2 (https://slsa.dev/provenance/v0.2) - just the parts a manifest can fill
+type slsaProvenance struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		Parameters map[string]string `json:"parameters"`
+	} `json:"invocation"`
+	Metadata struct {
+		BuildFinishedOn string `json:"buildFinishedOn"`
+		Completeness    struct {
+			Materials bool `json:"materials"`
+		} `json:"completeness"`
+	} `json:"metadata"`
+	Materials []slsaMaterial `json:"materials"`
+}
+
+type slsaMaterial struct {
+	URI    string       `json:"uri"`
+	Digest intotoDigest `json:"digest"`
+}
+
+func att(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+	fnr := files[0]
+	if cli_predicateout != "" {
+		if _, err := os.Stat(cli_predicateout); err == nil && !cli_overwrite {
+			abort(6, "Output file '"+cli_predicateout+"' already exists (use --overwrite)")
+		}
+	}
+
+	root := cli_path
+	if root == "" {
+		root = strings.TrimSuffix(path.Base(fnr), path.Ext(fnr))
+	}
+	canon := ssfCanonical(fnr)
+	digest := sha256.Sum256(canon)
+
+	st := intotoStatement{
+		Type:          "https://in-toto.io/Statement/v1",
+		Subject:       []intotoSubject{{Name: root, Digest: intotoDigest{hex.EncodeToString(digest[:])}}},
+		PredicateType: "https://slsa.dev/provenance/v0.2",
+	}
+	p := &st.Predicate
+	p.Builder.ID = "https://github.com/jonknoxdotcom/shaman"
+	p.BuildType = "https://github.com/jonknoxdotcom/shaman/manifest@v1"
+	p.Invocation.Parameters = map[string]string{"manifest": path.Base(fnr)}
+	p.Metadata.BuildFinishedOn = time.Now().UTC().Format(time.RFC3339)
+	p.Metadata.Completeness.Materials = true
+	p.Materials = []slsaMaterial{}
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+fnr+"' is anonymous - materials need names")
+		}
+		p.Materials = append(p.Materials, slsaMaterial{rec.name, intotoDigest{hex.EncodeToString(shaBase64ToShaBinary(rec.shab64))}})
+	})
+
+	out := os.Stdout
+	if cli_predicateout != "" {
+		f, err := os.Create(cli_predicateout)
+		if err != nil {
+			abort(4, "Cannot create file "+cli_predicateout)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(st); err != nil {
+		abort(4, "Cannot write statement: "+err.Error())
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure walking and hashing speed on this machine",
+	Long: `shaman bench [-p path]
+Measures, for the given tree (default current directory):
+ - walker speed (files per second, no hashing)
+ - sequential hashing throughput on a sample of the files (first read - i.e. disk speed)
+ - parallel hashing throughput with increasing numbers of workers (re-read - i.e. CPU speed)
+ - in-memory throughput of several hash algorithms
+and recommends a --workers value for generate.  Use --limit to change the sample size.`,
+	Args:    cobra.NoArgs,
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		ben()
+	},
+}
+
+var cli_limit int = 256 // sample size (MB) for hashing tests
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to test (default is current directory)")
+	benchCmd.Flags().IntVarP(&cli_limit, "limit", "l", 256, "Size of file sample to hash, in MB")
+}
+
+// ----------------------- Bench function below this line -----------------------
+
+// megabytes per second, for reporting
+func mbps(nbytes int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(nbytes) / (1024 * 1024) / d.Seconds()
+}
+
+// hash the sample files with n workers, returning the elapsed time
+func benchHash(sample []triplex, n int) time.Duration {
+	in := make(chan triplex, len(sample))
+	for _, t := range sample {
+		in <- t
+	}
+	close(in)
+
+	start := time.Now()
+	for range hashTriplexes(in, n) {
+	}
+	return time.Since(start)
+}
+
+func ben() {
+	var startpath string = "."
+	if cli_path != "" {
+		startpath = cli_path // add validation here
+	}
+
+	opts := walkOptionsFromFlags()
+
+	// 1. walker only - also collects the sample for hashing
+	fileQueue := make(chan triplex, 4096)
+	go func() {
+		defer close(fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
+	}()
+	var nfiles int64
+	var sample []triplex
+	var sampleBytes int64
+	limit := int64(cli_limit) * 1024 * 1024
+	start := time.Now()
+	for filerec := range fileQueue {
+		nfiles++
+		if sampleBytes < limit {
+			sample = append(sample, filerec)
+			sampleBytes += filerec.size
+		}
+	}
+	walkTime := time.Since(start)
+	fmt.Printf("Walker:      %s files in %s (%.0f files/sec)\n", intAsString(nfiles), walkTime.Round(time.Millisecond), float64(nfiles)/max(walkTime.Seconds(), 0.001))
+	if len(sample) == 0 {
+		abort(1, "No files to hash")
+	}
+
+	// 2. sequential hash of the sample - first read, so mostly a measure of the storage
+	d := benchHash(sample, 1)
+	fmt.Printf("Sequential:  %d files, %s bytes in %s (%.1f MB/s, first read)\n", len(sample), intAsString(sampleBytes), d.Round(time.Millisecond), mbps(sampleBytes, d))
+
+	// 3. parallel hashes - re-reads (probably cached), so mostly a measure of the CPUs
+	best := 0.0
+	var rates []float64
+	var counts []int
+	for n := 1; n <= runtime.NumCPU()*2; n *= 2 {
+		d := benchHash(sample, n)
+		rate := mbps(sampleBytes, d)
+		fmt.Printf("Workers %3d: %.1f MB/s\n", n, rate)
+		rates = append(rates, rate)
+		counts = append(counts, n)
+		best = max(best, rate)
+	}
+
+	// 4. algorithms, in memory
+	buf := make([]byte, 64*1024*1024)
+	for x := range buf {
+		buf[x] = byte(x)
+	}
+	for _, alg := range []struct {
+		name string
+		h    hash.Hash
+	}{
+		{"sha256", sha256.New()},
+		{"sha512", sha512.New()},
+		{"sha1", sha1.New()},
+		{"md5", md5.New()},
+		{"crc32", crc32.NewIEEE()},
+	} {
+		start := time.Now()
+		alg.h.Write(buf)
+		alg.h.Sum(nil)
+		fmt.Printf("Algorithm %-7s %.0f MB/s\n", alg.name+":", mbps(int64(len(buf)), time.Since(start)))
+	}
+
+	// recommendation - the fewest workers that get within 10% of the best
+	recommend := 1
+	for x, rate := range rates {
+		if rate >= best*0.9 {
+			recommend = counts[x]
+			break
+		}
+	}
+	fmt.Printf("Recommended: --workers %d\n", recommend)
+	fmt.Println("(Results with cached files overstate disk speed - the sequential figure is the best guide to I/O)")
+}
@@ -4,10 +4,12 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
-	"bufio"
+	"cmp"
 	"fmt"
 	"log/slog"
-	"os"
+	"maps"
+	"path"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -15,9 +17,14 @@ import (
 
 // biggestCmd represents the biggest command
 var biggestCmd = &cobra.Command{
-	Use:     "biggest",
-	Short:   "Show the names of the largest files",
-	Long:    `Finds the top-10 largest files in an .ssf file`,
+	Use:   "biggest",
+	Short: "Show the names of the largest files",
+	Long: `Finds the top-10 largest files in an .ssf file
+With --by-ext, totals the files and bytes for each extension instead, biggest share first, with the
+largest file of each - to see at a glance what is taking the space:
+   shaman biggest --by-ext share.ssf
+--discard leaves out the files under a path prefix, and can be given more than once:
+   shaman biggest home.ssf --discard build/ --discard node_modules/`,
 	Aliases: []string{"big", "largest", "lar"},
 	Args:    cobra.MaximumNArgs(99), // handle in code
 	GroupID: "G2",
@@ -31,16 +38,19 @@ func init() {
 	rootCmd.AddCommand(biggestCmd)
 
 	biggestCmd.Flags().IntVarP(&cli_count, "count", "c", 20, "Specify number of files to show (default: 20)")
-	biggestCmd.Flags().StringVarP(&cli_discard, "discard", "", "", "Path to exclude from results")
+	biggestCmd.Flags().StringArrayVarP(&cli_discard, "discard", "", nil, "Path prefix to exclude from results (repeatable)")
 	biggestCmd.Flags().BoolVarP(&cli_ellipsis, "ellipsis", "e", false, "Replace repeated size with '...'")
 	biggestCmd.Flags().BoolVarP(&cli_nodot, "no-dot", "", false, "Do not include files/directories beginning '.'")
+	biggestCmd.Flags().BoolVarP(&cli_byext, "by-ext", "", false, "Total the files and bytes for each extension (the top --count)")
 }
 
+var cli_byext bool = false // totals by extension
+
 // ----------------------- "Biggest" (largest) function below this line -----------------------
 
 func bigFile(fn string, prefix string) int {
 	// open file
-	r, err := os.Open(fn)
+	r, err := ssfOpen(fn)
 	if err != nil {
 		fmt.Println("Unexpected problem opening file " + fn)
 		return 0
@@ -48,12 +58,12 @@ func bigFile(fn string, prefix string) int {
 	defer r.Close()
 
 	// get the threshold
-	thresh := topKeys[topDepth-1]
+	thresh := topThreshold()
 
 	// process lines
 	var s string
 	var lineno int
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		lineno++
@@ -63,32 +73,39 @@ func bigFile(fn string, prefix string) int {
 		}
 
 		// check size with least kerfuffle
-		pos1 := strings.Index(s, " ")
-
-		if pos1 == -1 && len(s) == 43 {
+		rec, ok := parseSSFRecord(s)
+		if ok && rec.format < 4 {
 			fmt.Printf("Seeing anonymous records in %s - skipping\n", fn)
 			return 0
 		}
-		if pos1 == -1 || pos1 < 55 {
-			fmt.Printf("Skipping line %d - Invalid format (position %d, length %d)\n", lineno, pos1, len(s))
+		if !ok {
+			fmt.Printf("Skipping line %d - Invalid format (length %d)\n", lineno, len(s))
+			continue
+		}
+		name := prefix + rec.name
+
+		// drop if files or directories begins "." and nodot asserted, or discarded
+		if cli_nodot && (strings.Contains(name, "/.") || name[0:1] == ".") {
+			continue
+		}
+		if discarded(rec.name) {
+			continue
+		}
+		if cli_byext {
+			if !entryIsSpecial(rec) {
+				bigExtAdd(name, decodeHex(rec.size))
+			}
 			continue
 		}
-		temp := "000000" + s[51:pos1] // pad - better way?
-		key := temp[len(temp)-10:]
+
+		key := sizeKey(rec.size)
 		if key < thresh {
 			// off the bottom - no need to do a Add attempt
 			continue
 		}
 
 		// get rest of fields
-		id := s[0:pos1]
-		pos2 := strings.Index(s, " :")
-		name := prefix + s[pos2+2:]
-
-		// drop if files or directories begins "." and nodot asserted
-		if cli_nodot && (strings.Contains(name, "/.") || name[0:1] == ".") {
-			continue
-		}
+		id := rec.shab64 + rec.modtime + rec.size
 
 		thresh = topAdd(key, id, name)
 	}
@@ -96,26 +113,32 @@ func bigFile(fn string, prefix string) int {
 }
 
 func bigLocal(path string) int {
-	// create tree walker channel
+	// create tree walker channel (which leaves out dot files with --no-dot)
+	opts := walkOptionsFromFlags()
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(path, fileQueue)
+		walkTreeToChannel(path, opts, fileQueue)
 	}()
 
 	// get the threshold
-	thresh := topKeys[topDepth-1]
+	thresh := topThreshold()
 
 	// process lines
 	lineno := 0
 	for filerec := range fileQueue {
-		// drop if files or directories begins "." and nodot asserted
-		if cli_nodot && (strings.Contains(filerec.filename, "/.") || filerec.filename[0:1] == ".") {
+		if discarded(filerec.filename) {
 			continue
 		}
 
 		lineno++
-		key := fmt.Sprintf("%010x", filerec.size)
+		if cli_byext {
+			if !strings.HasSuffix(filerec.filename, "/") {
+				bigExtAdd(filerec.filename, filerec.size)
+			}
+			continue
+		}
+		key := sizeKey(encodeSize(filerec.size))
 		if key < thresh {
 			// off the bottom - no need to do a Add attempt
 			continue
@@ -144,7 +167,7 @@ func big(args []string) {
 	}
 
 	// Default 20, user over-ride with '--count', maximum 999
-	var thresh string = "0000000000" // size is 010x format
+	var thresh string = sizeKey("0") // size keys are 16 hex digits
 	cli_count = min(cli_count, 999)
 	title := fmt.Sprintf("TOP %d FILES BY SIZE", cli_count)
 	topInit(cli_count, true, thresh)
@@ -168,5 +191,74 @@ func big(args []string) {
 	default:
 	}
 
+	if cli_byext {
+		bigExtReport(strings.Replace(strings.Replace(title, "FILES BY SIZE", "EXTENSIONS BY TOTAL SIZE", 1), " (dupes not identified)", "", 1))
+		return
+	}
 	topReportBySize(title)
 }
+
+// ----------------------- By extension (--by-ext)
+
+type extTotal struct {
+	files   int64
+	bytes   int64
+	largest int64  // size of the largest file
+	name    string // and its name
+}
+
+var extTotals = map[string]*extTotal{}
+
+// the extension of a name, lowercased ("" for none - a dot file like '.bashrc' has none)
+func bigExt(name string) string {
+	base := path.Base(name)
+	ext := path.Ext(base)
+	if ext == base {
+		return ""
+	}
+	return strings.ToLower(ext)
+}
+
+func bigExtAdd(name string, size int64) {
+	ext := bigExt(name)
+	t := extTotals[ext]
+	if t == nil {
+		t = &extTotal{}
+		extTotals[ext] = t
+	}
+	t.files++
+	t.bytes += size
+	if size > t.largest || t.name == "" {
+		t.largest, t.name = size, name
+	}
+}
+
+func bigExtReport(title string) {
+	var total int64
+	for _, t := range extTotals {
+		total += t.bytes
+	}
+	exts := slices.SortedFunc(maps.Keys(extTotals), func(a, b string) int {
+		if c := cmp.Compare(extTotals[b].bytes, extTotals[a].bytes); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	fmt.Println(title)
+	fmt.Println("POS  EXTENSION     FILES   -------BYTES------      %   LARGEST")
+	for x, ext := range exts[0:min(len(exts), cli_count)] {
+		t := extTotals[ext]
+		pct := 0.0
+		if total > 0 {
+			pct = float64(t.bytes) * 100 / float64(total)
+		}
+		if ext == "" {
+			ext = "(none)"
+		}
+		fmt.Printf("%2d:  %-10s %8d %20s %5.1f%%  %s (%s)\n", x+1, ext, t.files, sizeAsString(t.bytes), pct, t.name, sizeAsString(t.largest))
+	}
+	if len(exts) > cli_count {
+		fmt.Printf("(%d more extensions - see --count)\n", len(exts)-cli_count)
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// casCmd represents the cas command (parent of export/restore)
+var casCmd = &cobra.Command{
+	Use:   "cas",
+	Short: "Content-addressed store operations driven by an SSF",
+	Long: `shaman cas export|restore
+Maintains a content-addressed store (CAS) of file contents, where each unique file is held once as
+<cas-root>/ab/cd/<sha256 in hex>.  The SSF provides the list of files (and their expected hashes).`,
+	GroupID: "G3",
+}
+
+// casExportCmd represents the cas export command
+var casExportCmd = &cobra.Command{
+	Use:   "export file.ssf /cas-root",
+	Short: "Copy (or hardlink) every unique file in an SSF into a content-addressed store",
+	Long: `shaman cas export file.ssf /cas-root
+Copies every unique file described by the SSF into a <cas-root>/ab/cd/<sha> layout.  Blobs that are already
+present in the store are skipped, so repeated exports only copy new content.  Each file is hashed while being
+copied, and is rejected if it no longer matches the manifest.  The files are looked for from the root
+recorded in the SSF (see 'shaman generate'), or --root, or --path.  Use --link to hardlink rather than
+copy (same filesystem only).`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		casExport(args)
+	},
+}
+
+// casRestoreCmd represents the cas restore command
+var casRestoreCmd = &cobra.Command{
+	Use:   "restore file.ssf /cas-root /dest",
+	Short: "Recreate the tree described by an SSF from a content-addressed store",
+	Long: `shaman cas restore file.ssf /cas-root /dest
+The inverse of export: recreates the directory structure and filenames of the SSF under /dest by copying
+blobs out of the store, verifying each hash as it is written, and setting each file's modify time from the
+manifest.  Existing files in /dest are left alone (and reported) unless --overwrite is given.`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		casRestore(args)
+	},
+}
+
+var cli_link bool = false // hardlink into the store rather than copy
+
+func init() {
+	rootCmd.AddCommand(casCmd)
+	casCmd.AddCommand(casExportCmd)
+	casCmd.AddCommand(casRestoreCmd)
+
+	casExportCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	casExportCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to, instead of the recorded root ('.' for the current directory)")
+	casExportCmd.Flags().BoolVarP(&cli_link, "link", "l", false, "Hardlink files into the store instead of copying (falls back to copy)")
+	casExportCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "List each file as it is stored")
+
+	casRestoreCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Replace files that already exist in the destination")
+	casRestoreCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "List each file as it is restored")
+}
+
+// ----------------------- CAS functions below this line -----------------------
+
+// location of a blob in the store - two levels of fan-out on the hex sha
+func casBlobPath(root string, shab64 string) string {
+	hex := fmt.Sprintf("%x", shaBase64ToShaBinary(shab64))
+	return path.Join(root, hex[0:2], hex[2:4], hex)
+}
+
+// copy src to dst (via a temp file and rename) hashing on the way - fails if the hash isn't want
+func casCopyVerified(src string, dst string, want []byte) (int64, error) {
+	r, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	tmp := dst + ".temp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err == nil {
+		err = w.Sync()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !bytes.Equal(h.Sum(nil), want) {
+		err = errors.New("content does not match SSF hash")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, os.Rename(tmp, dst)
+}
+
+func casExport(args []string) {
+	num, files, found := getSSFs(args[0:1])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+	root := args[1]
+	if err := os.MkdirAll(root, 0755); err != nil {
+		abort(4, "Cannot create store directory "+root)
+	}
+	startpath := rootStart(files[0])
+	if startpath != "." {
+		fmt.Println("Reading files from " + startpath + " (" + rootSource() + ")")
+	}
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+
+	// one pass over the manifest - the first record with a given sha supplies the content
+	var seen = map[string]bool{}
+	var stored, present, skipped, failed int
+	var nbytes int64
+	var s string
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s = scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+
+		_, shab64, _, _, name := splitSSFLine(s)
+		if shab64 == "" {
+			fmt.Printf("Skipping line %d - no filename (anonymous or invalid record)\n", lineno)
+			skipped++
+			continue
+		}
+		if seen[shab64] {
+			continue
+		}
+		seen[shab64] = true
+
+		blob := casBlobPath(root, shab64)
+		if _, err := os.Stat(blob); err == nil {
+			present++
+			continue
+		}
+
+		src := rootJoin(startpath, name)
+
+		// hardlink if asked (and possible), otherwise copy with verification
+		if _, err := os.Stat(src); err == nil && cli_link {
+			_, sha := getFileSha256(src)
+			if sha == shab64 && os.MkdirAll(path.Dir(blob), 0755) == nil && os.Link(src, blob) == nil {
+				if cli_verbose {
+					fmt.Println("  Link: " + name)
+				}
+				stored++
+				continue
+			}
+		}
+		n, err := casCopyVerified(src, blob, shaBase64ToShaBinary(shab64))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot store %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if cli_verbose {
+			fmt.Println("  Copy: " + name)
+		}
+		stored++
+		nbytes += n
+	}
+
+	fmt.Printf("%d unique SHAs: %d stored (%s copied), %d already present, %d failed\n",
+		len(seen), stored, bytesAsString(nbytes), present, failed)
+	if skipped > 0 {
+		fmt.Printf("%d records could not be used\n", skipped)
+	}
+	if failed > 0 {
+		abort(1, "")
+	}
+}
+
+func casRestore(args []string) {
+	num, files, found := getSSFs(args[0:1])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+	root := args[1]
+	if st, err := os.Stat(root); err != nil || !st.IsDir() {
+		abort(6, "Store directory '"+root+"' does not exist")
+	}
+	dest := path.Clean(args[2])
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+
+	var restored, existing, skipped, failed int
+	var nbytes int64
+	var s string
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s = scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+
+		_, shab64, modtime, _, name := splitSSFLine(s)
+		if shab64 == "" {
+			fmt.Printf("Skipping line %d - no filename (anonymous or invalid record)\n", lineno)
+			skipped++
+			continue
+		}
+
+		// never write outside the destination
+		// (by the path from dest to the target, so that a dest of "." or "/" works too)
+		target := path.Join(dest, name)
+		if rel, err := filepath.Rel(dest, target); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			fmt.Printf("Skipping line %d - name escapes destination: %s\n", lineno, name)
+			skipped++
+			continue
+		}
+		if _, err := os.Lstat(target); err == nil && !cli_overwrite {
+			existing++
+			continue
+		}
+
+		n, err := casCopyVerified(casBlobPath(root, shab64), target, shaBase64ToShaBinary(shab64))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot restore %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if secs, err := strconv.ParseInt(modtime, 16, 64); err == nil {
+			t := time.Unix(secs, 0)
+			os.Chtimes(target, t, t)
+		}
+		if cli_verbose {
+			fmt.Println("  Restored: " + name)
+		}
+		restored++
+		nbytes += n
+	}
+
+	fmt.Printf("%d files restored (%s), %d already existed, %d failed\n",
+		restored, bytesAsString(nbytes), existing, failed)
+	if skipped > 0 {
+		fmt.Printf("%d records could not be used\n", skipped)
+	}
+	if failed > 0 {
+		abort(1, "")
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// catCmd represents the cat command
+var catCmd = &cobra.Command{
+	Use:   "cat file.ssf",
+	Short: "Print an SSF's records in readable columns",
+	Long: `shaman cat file.ssf [--head N] [--tail N] [--annotations]
+Prints each record of an SSF with its size in bytes and its modify time as a date (RFC3339, UTC) rather
+than hex, and its name unescaped, in columns:
+   shaman cat photos.ssf --head 20
+Names with control characters in them are shown quoted.  --annotations adds each record's annotations
+after its name.`,
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		cat(args)
+	},
+}
+
+var cli_head int = 0        // only the first N records
+var cli_tail int = 0        // only the last N records
+var cli_annots bool = false // show annotations
+
+func init() {
+	rootCmd.AddCommand(catCmd)
+
+	catCmd.Flags().IntVarP(&cli_head, "head", "", 0, "Only print the first N records")
+	catCmd.Flags().IntVarP(&cli_tail, "tail", "", 0, "Only print the last N records")
+	catCmd.Flags().BoolVarP(&cli_annots, "annotations", "", false, "Print annotations after the name")
+}
+
+// ----------------------- Cat function below this line -----------------------
+
+// undo escapeName (control characters written as \0xHH)
+func unescapeName(name string) string {
+	if !strings.Contains(name, `\0x`) {
+		return name
+	}
+	var b strings.Builder
+	for x := 0; x < len(name); x++ {
+		if strings.HasPrefix(name[x:], `\0x`) && x+5 <= len(name) {
+			if c, err := strconv.ParseUint(name[x+3:x+5], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				x += 4
+				continue
+			}
+		}
+		b.WriteByte(name[x])
+	}
+	return b.String()
+}
+
+// a record as a line of columns
+func catLine(rec ssfRecord) string {
+	size, when, name := "-", "-", ""
+	if rec.size != "" {
+		size = sizeAsString(decodeHex(rec.size))
+	}
+	if rec.modtime != "" {
+		when = time.Unix(decodeHex(rec.modtime), 0).UTC().Format(time.RFC3339)
+	}
+	if rec.format >= 4 {
+		name = unescapeName(rec.name)
+		if strings.ContainsFunc(name, func(c rune) bool { return c < 0x20 || c == 0x7f }) {
+			name = strconv.Quote(name)
+		}
+	}
+	if cli_annots && rec.annot != "" {
+		name += "  [" + rec.annot + "]"
+	}
+	return fmt.Sprintf("%s  %15s  %20s  %s", rec.shab64, size, when, name)
+}
+
+func cat(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case !found[0]:
+		abort(6, "SSF file '"+files[0]+"' does not exist")
+	case cli_head < 0 || cli_tail < 0:
+		abort(6, "--head and --tail must be positive")
+	case cli_head > 0 && cli_tail > 0:
+		abort(6, "Give --head or --tail, not both")
+	}
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+
+	// (the last --tail lines are kept in a ring)
+	var ring []string
+	var n int
+	scanner := ssfScanner(r)
+	for scanner.Scan() && (cli_head == 0 || n < cli_head) {
+		s := scanner.Text()
+		if len(s) == 0 || s[0:1] == "#" {
+			continue
+		}
+		rec, ok := parseSSFRecord(s)
+		if !ok {
+			continue
+		}
+		n++
+		switch {
+		case cli_tail == 0:
+			fmt.Println(catLine(rec))
+		case len(ring) < cli_tail:
+			ring = append(ring, catLine(rec))
+		default:
+			ring[(n-1)%cli_tail] = catLine(rec)
+		}
+	}
+	for x := range ring {
+		fmt.Println(ring[(n+x)%len(ring)])
+	}
+}
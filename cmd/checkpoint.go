@@ -0,0 +1,123 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ----------------------- Update checkpoints -----------------------
+
+// A long update (tens of millions of files) can be checkpointed, so that after a reboot it is resumed
+// rather than started again.  Every --checkpoint interval the output is flushed and synced to disk, and
+// then the position is saved beside it (atomically, by rename) as 'out.ssf.checkpoint': the length of the
+// output so far, the name of the last record dealt with, and the counts.  With --resume, the output is
+// cut back to that length and appended to, and the records up to that name are skipped.
+
+var cli_checkpoint string = "" // interval between checkpoints, e.g. 10m (""=none)
+var cli_resume bool = false    // carry on from the checkpoint
+
+type updateCheckpoint struct {
+	Input     string `json:"input"`
+	InSize    int64  `json:"input_size"` // (the input must not have changed since)
+	InModt    int64  `json:"input_modtime"`
+	Offset    int64  `json:"offset"` // length of the output
+	Last      string `json:"last"`   // name of the last record dealt with
+	Files     int64  `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	New       int64  `json:"new"`
+	Changed   int64  `json:"changed"`
+	Deleted   int64  `json:"deleted"`
+	Unchanged int64  `json:"unchanged"`
+	Time      string `json:"time"`
+}
+
+func checkpointName(fnw string) string {
+	return fnw + ".checkpoint"
+}
+
+// the interval given by --checkpoint (0 if none)
+func checkpointInterval() time.Duration {
+	if cli_checkpoint == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(cli_checkpoint)
+	if err != nil || d < time.Second {
+		abort(6, "Invalid --checkpoint '"+cli_checkpoint+"' (expected an interval, e.g. 10m)")
+	}
+	return d
+}
+
+// save the position, once everything before it is safely on disk
+func checkpointSave(fnw string, fnr string, w *writeSSF, last string) {
+	w.Flush()
+	f, err := os.OpenFile(fnw, os.O_WRONLY, 0)
+	if err != nil {
+		abort(4, "Cannot open "+fnw+" to checkpoint it")
+	}
+	f.Sync()
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		abort(4, "Cannot stat "+fnw+" to checkpoint it")
+	}
+	in, err := os.Stat(fnr)
+	if err != nil {
+		abort(4, "Cannot stat "+fnr+" to checkpoint it")
+	}
+
+	cp := updateCheckpoint{fnr, in.Size(), in.ModTime().Unix(), info.Size(), last,
+		w.tf, w.tb, w.nnew, w.nchg, w.ndel, w.nunc, time.Now().Format(time.RFC3339)}
+	b, _ := json.MarshalIndent(cp, "", "  ")
+	temp := checkpointName(fnw) + ".temp"
+	if err := os.WriteFile(temp, append(b, '\n'), 0644); err != nil {
+		abort(4, "Cannot write checkpoint "+temp)
+	}
+	if err := os.Rename(temp, checkpointName(fnw)); err != nil {
+		abort(4, "Cannot save checkpoint "+checkpointName(fnw))
+	}
+}
+
+// the checkpoint to resume from - which must be for the same (unchanged) input
+func checkpointLoad(fnw string, fnr string) *updateCheckpoint {
+	b, err := os.ReadFile(checkpointName(fnw))
+	if err != nil {
+		abort(6, "No checkpoint to resume from ("+checkpointName(fnw)+" not found)")
+	}
+	var cp updateCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		abort(6, "Checkpoint "+checkpointName(fnw)+" is not valid: "+err.Error())
+	}
+	in, err := os.Stat(fnr)
+	switch {
+	case err != nil || cp.Input != fnr:
+		abort(6, "Checkpoint "+checkpointName(fnw)+" is for input '"+cp.Input+"', not '"+fnr+"'")
+	case in.Size() != cp.InSize || in.ModTime().Unix() != cp.InModt:
+		abort(6, "Input '"+fnr+"' has changed since the checkpoint - cannot resume")
+	}
+	return &cp
+}
+
+// open the output to carry on writing it from the checkpoint (with its counts)
+func checkpointWriter(fnw string, cp *updateCheckpoint) *writeSSF {
+	f, err := os.OpenFile(fnw, os.O_WRONLY, 0)
+	if err != nil {
+		abort(6, "Cannot open "+fnw+" to resume it")
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() < cp.Offset {
+		abort(6, "Output "+fnw+" is shorter than at the checkpoint - cannot resume")
+	}
+	if f.Truncate(cp.Offset) != nil {
+		abort(4, "Cannot truncate "+fnw+" to resume it")
+	}
+	f.Seek(cp.Offset, 0)
+	fmt.Printf("Resuming from checkpoint of %s (%d records dealt with, up to %s)\n", cp.Time, cp.Files+cp.Deleted, cp.Last)
+	return &writeSSF{Writer: bufio.NewWriterSize(f, 64*1024), file: f, flushTime: time.Now().Unix(),
+		tf: cp.Files, tb: cp.Bytes, nnew: cp.New, nchg: cp.Changed, ndel: cp.Deleted, nunc: cp.Unchanged}
+}
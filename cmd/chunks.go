@@ -0,0 +1,160 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ----------------------- Content-defined chunks (--chunks) -----------------------
+
+// Two large files that differ by a few bytes have unrelated SHAs, which says nothing about how much they
+// share.  With --chunks, files over a size are also cut into chunks with FastCDC - where a chunk ends is
+// decided by the content around it, so an insertion only changes the chunks it falls in, rather than
+// shifting every boundary after it - and the chunks are recorded (as the annotation 'chunks=4M:...', each
+// one an XXH64 and a length) so that 'shaman overlap' can say how much of two files is the same.
+
+var cli_chunks string = "" // record the chunks of files this size or over (e.g. 1G)
+var chunkMin int64 = 0     // (parsed)
+
+// chunk sizes: normally 4MiB, never under 1MiB or over 16MiB (the 4M in the annotation)
+const (
+	cdcMin   = 1 << 20
+	cdcAvg   = 4 << 20
+	cdcMax   = 16 << 20
+	cdcLabel = "4M"
+)
+
+// a boundary is where the rolling hash has these (top) bits clear - more of them before the normal size
+// and fewer after it, so that chunk sizes bunch around the normal size
+const (
+	cdcMaskSmall uint64 = (1<<24 - 1) << 40 // 22+2 bits
+	cdcMaskLarge uint64 = (1<<20 - 1) << 44 // 22-2 bits
+)
+
+// the gear table: 256 fixed random values (made by splitmix64, so that every build cuts the same chunks)
+var cdcGear = func() (g [256]uint64) {
+	var s uint64 = 0x5348414d414e4344 // "SHAMANCD"
+	for x := range g {
+		s += 0x9e3779b97f4a7c15
+		z := s
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		g[x] = z ^ (z >> 31)
+	}
+	return g
+}()
+
+// parse --chunks (called with the other annotation switches)
+func chunksValidate() {
+	if cli_chunks == "" {
+		return
+	}
+	n, ok := parseByteSize(cli_chunks)
+	if !ok || n <= 0 {
+		abort(6, "Invalid --chunks '"+cli_chunks+"' (expected the smallest file to chunk, e.g. 1G)")
+	}
+	chunkMin = n
+}
+
+// the length of the chunk at the start of b (all of b if it is the last)
+func cdcCut(b []byte) int {
+	n := len(b)
+	if n <= cdcMin {
+		return n
+	}
+	n = min(n, cdcMax)
+	normal := min(n, cdcAvg)
+	var fp uint64
+	x := cdcMin
+	for ; x < normal; x++ {
+		fp = (fp << 1) + cdcGear[b[x]]
+		if fp&cdcMaskSmall == 0 {
+			return x + 1
+		}
+	}
+	for ; x < n; x++ {
+		fp = (fp << 1) + cdcGear[b[x]]
+		if fp&cdcMaskLarge == 0 {
+			return x + 1
+		}
+	}
+	return n
+}
+
+// a chunk, as recorded
+type fileChunk struct {
+	sum  string // XXH64, base64 (11 characters)
+	size int64
+}
+
+// cut a file into chunks
+func getFileChunks(fn string) ([]fileChunk, bool) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, cdcMax)
+	var chunks []fileChunk
+	for {
+		b, err := r.Peek(cdcMax)
+		if len(b) == 0 {
+			if err != io.EOF {
+				return nil, false
+			}
+			return chunks, true
+		}
+		if err != nil && err != io.EOF {
+			return nil, false
+		}
+		cut := cdcCut(b)
+		x := xxh64New()
+		x.Write(b[:cut])
+		sum := binary.BigEndian.AppendUint64(nil, x.Sum64())
+		chunks = append(chunks, fileChunk{base64.RawStdEncoding.EncodeToString(sum), int64(cut)})
+		r.Discard(cut)
+	}
+}
+
+// the chunks annotation for a file ("" if it is too small, or cannot be read)
+func chunkAnnotation(fn string) string {
+	info, err := os.Stat(fn)
+	if err != nil || !info.Mode().IsRegular() || info.Size() < chunkMin {
+		return ""
+	}
+	chunks, ok := getFileChunks(fn)
+	if !ok {
+		return ""
+	}
+	parts := make([]string, len(chunks))
+	for x, c := range chunks {
+		parts[x] = c.sum + "." + strconv.FormatInt(c.size, 16)
+	}
+	return "chunks=" + cdcLabel + ":" + strings.Join(parts, ",")
+}
+
+// the chunks recorded in an annotation (nil if none, or made with other chunk sizes)
+func chunksAnnotated(annot string) []fileChunk {
+	v, ok := annotationMap(annot)["chunks"]
+	if !ok || !strings.HasPrefix(v, cdcLabel+":") {
+		return nil
+	}
+	var chunks []fileChunk
+	for _, p := range strings.Split(v[len(cdcLabel)+1:], ",") {
+		sum, size, _ := strings.Cut(p, ".")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil || len(sum) != 11 {
+			return nil
+		}
+		chunks = append(chunks, fileChunk{sum, n})
+	}
+	return chunks
+}
@@ -4,11 +4,8 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"log/slog"
-	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -17,9 +14,13 @@ import (
 
 // compareCmd represents the compare command
 var compareCmd = &cobra.Command{
-	Use:     "compare",
-	Short:   "Compare two .ssf files",
-	Long:    `Compares two files (at hash level) and produces bash-type scripts to delete items between.`,
+	Use:   "compare",
+	Short: "Compare two .ssf files",
+	Long: `Compares two files (at hash level) and produces bash-type scripts to delete items between.
+Records with a quick (partial) hash that match are fully hashed from the files under --path first.
+With --names-similar, instead lists the files that were likely renamed, moved or modified: for each SHA
+only in A, a record in B (with a SHA only in B) with the same name, the same base name elsewhere, or a
+similar name in the same directory.`,
 	Aliases: []string{"com"},
 	GroupID: "G2",
 	Args:    cobra.MaximumNArgs(99), // handle in code
@@ -32,8 +33,12 @@ func init() {
 	rootCmd.AddCommand(compareCmd)
 	compareCmd.Flags().BoolVarP(&cli_del_b, "del-b", "", false, "Generate 'rm' for files in B which are present in A")
 	compareCmd.Flags().BoolVarP(&cli_long, "long", "l", false, "Describe deletes in long form (in context)")
+	compareCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to, for confirming quick hashes")
+	compareCmd.Flags().BoolVarP(&cli_similar, "names-similar", "", false, "Report files likely renamed and/or modified (hashes only in one file, similar names)")
 }
 
+var cli_similar bool = false // report similar names rather than overlaps
+
 // ----------------------- Generate function below this line -----------------------
 
 func com(args []string) {
@@ -51,9 +56,18 @@ func com(args []string) {
 		abort(6, "Target SSF file '"+files[1]+"' does not exist")
 	}
 
+	// Confirm any matching quick hashes (the comparison then uses the resolved copies)
+	scan, cleanup := quickResolve(files, cli_path)
+	defer cleanup()
+
+	if cli_similar {
+		comNamesSimilar(scan[0], scan[1], files[0], files[1])
+		return
+	}
+
 	// Work out which smallest
-	len_a := ssfRecCount(files[0])
-	len_b := ssfRecCount(files[1])
+	len_a := ssfRecCount(scan[0])
+	len_b := ssfRecCount(scan[1])
 	var smaller int = 0
 	if len_b < len_a {
 		smaller = 1
@@ -64,11 +78,11 @@ func com(args []string) {
 	var overlap = map[string]bool{} // scoreboard for smaller collection
 
 	// fill scoreboard with 'false' for each file in smaller set
-	shas, rows := ssfScoreboardRead(files[smaller], overlap, false)
+	shas, rows := ssfScoreboardRead(scan[smaller], overlap, false)
 	slog.Debug("read smaller to get uniq shas", "file", files[smaller], "records", rows, "uniques", shas)
 
 	// mark true for any scoreboard keys in larger target
-	shas, rows = ssfScoreboardMark(files[1-smaller], overlap, true)
+	shas, rows = ssfScoreboardMark(scan[1-smaller], overlap, true)
 	slog.Debug("use larger to mark shared", "file", files[1-smaller], "marked", rows, "processed", shas)
 
 	// strip map of non-overlaps
@@ -77,14 +91,15 @@ func com(args []string) {
 
 	// how many overlaps?
 	if shas == 0 {
+		cleanup()
 		abort(0, fmt.Sprintf("There are no overlapping records between '%s' and '%s'", files[0], files[1]))
 	}
 
 	// generate bash command to remove files in B that were in A
 	if !cli_long {
 		// short form (just the overlaps in B)
-		removalSlice := make([]string, 0, 10)                              // shas is the minimum size - likely to grow
-		rows = ssfSelectNameByScoreboard(files[1], overlap, &removalSlice) // not sure
+		removalSlice := make([]string, 0, 10)                             // shas is the minimum size - likely to grow
+		rows = ssfSelectNameByScoreboard(scan[1], overlap, &removalSlice) // not sure
 		slog.Debug("size of removal list", "rows", len(removalSlice))
 
 		fmt.Printf("# Commands to delete %d overlapping files from %s\n", rows, files[1])
@@ -93,8 +108,8 @@ func com(args []string) {
 		}
 	} else {
 		// long form (show all files in B, with the dupes prefixed with "rm"s)
-		var r *os.File
-		r, err := os.Open(files[1])
+		var r *ssfFile
+		r, err := ssfOpen(scan[1])
 		if err != nil {
 			abort(4, "Can't open "+files[1]+" - stuck!")
 		}
@@ -106,7 +121,7 @@ func com(args []string) {
 		fmt.Println("#")
 		var s string
 		var lineno int
-		scanner := bufio.NewScanner(r)
+		scanner := ssfScanner(r)
 		for scanner.Scan() {
 			s = scanner.Text()
 			lineno++
@@ -118,17 +133,15 @@ func com(args []string) {
 			}
 
 			// skip corrupted
-			pos1 := strings.Index(s, " ")
-			if pos1 == -1 || pos1 < 55 {
-				fmt.Printf("Skipping line %d - Invalid format (pos %d)\n", lineno, pos1)
+			rec, ok := parseSSFRecord(s)
+			if !ok || rec.format < 4 {
+				fmt.Printf("Skipping line %d - Invalid format\n", lineno)
 				continue
 			}
 
 			// get rest of fields
-			sha := s[0:43]
-			//id := s[0:pos1]
-			pos2 := strings.Index(s, " :")
-			name := s[pos2+2:]
+			sha := rec.shab64
+			name := rec.name
 
 			// check for display vs delete
 			if overlap[sha] {
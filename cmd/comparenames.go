@@ -0,0 +1,148 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ----------------------- Similar names (compare --names-similar) -----------------------
+
+// Between pure hash matching (same content) and pure name matching (same place) are the files that were
+// renamed or moved *and* modified.  For the records whose SHA is only in A, the records whose SHA is only
+// in B are searched for: the same name (modified in place), the same base name in another directory
+// (moved), or a similar base name in the same directory (renamed) - similarity being the edit distance
+// or the common suffix of the two names, relative to the longer.
+
+const similarMin = 0.7        // similarity needed for a rename
+const similarDirLimit = 2_000 // files only in B in one directory, above which renames are not searched for
+
+type similarMatch struct {
+	a, b  ssfRecord
+	how   string // "same name", "moved" or "renamed"
+	score float64
+}
+
+func comNamesSimilar(fna string, fnb string, labela string, labelb string) {
+	var recsa, recsb []ssfRecord
+	var inA, inB = map[string]bool{}, map[string]bool{}
+	ssfForEachRecord(fna, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+labela+"' is anonymous - names are needed")
+		}
+		recsa = append(recsa, rec)
+		inA[rec.shab64] = true
+	})
+	ssfForEachRecord(fnb, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+labelb+"' is anonymous - names are needed")
+		}
+		recsb = append(recsb, rec)
+		inB[rec.shab64] = true
+	})
+
+	// the B-only records, by name, base name, and directory
+	var byName = map[string]int{}
+	var byBase = map[string][]int{}
+	var byDir = map[string][]int{}
+	var onlyB []ssfRecord
+	for _, rec := range recsb {
+		if inA[rec.shab64] || entryIsSpecial(rec) {
+			continue
+		}
+		x := len(onlyB)
+		onlyB = append(onlyB, rec)
+		byName[rec.name] = x
+		byBase[path.Base(rec.name)] = append(byBase[path.Base(rec.name)], x)
+		byDir[path.Dir(rec.name)] = append(byDir[path.Dir(rec.name)], x)
+	}
+
+	// best unused B-only match for each A-only record, in name order
+	sortRecords(recsa)
+	used := make([]bool, len(onlyB))
+	var matches []similarMatch
+	var nonlyA int
+	for _, a := range recsa {
+		if inB[a.shab64] || entryIsSpecial(a) {
+			continue
+		}
+		nonlyA++
+		best, how, score := -1, "", 0.0
+		if x, ok := byName[a.name]; ok && !used[x] {
+			best, how, score = x, "same name", 1
+		}
+		if best < 0 {
+			for _, x := range byBase[path.Base(a.name)] {
+				if !used[x] {
+					best, how, score = x, "moved", 1
+					break
+				}
+			}
+		}
+		if dir := byDir[path.Dir(a.name)]; best < 0 && len(dir) <= similarDirLimit {
+			for _, x := range dir {
+				if used[x] {
+					continue
+				}
+				if s := similarity(path.Base(a.name), path.Base(onlyB[x].name)); s >= similarMin && s > score {
+					best, how, score = x, "renamed", s
+				}
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			matches = append(matches, similarMatch{a, onlyB[best], how, score})
+		}
+	}
+
+	fmt.Printf("# Files likely renamed and/or modified between %s and %s\n", labela, labelb)
+	for _, m := range matches {
+		switch m.how {
+		case "same name":
+			fmt.Printf("%-10s %s\n", m.how, m.a.name)
+		case "moved":
+			fmt.Printf("%-10s %s -> %s\n", m.how, m.a.name, m.b.name)
+		default:
+			fmt.Printf("%-10s %s -> %s (%.2f)\n", m.how, m.a.name, m.b.name, m.score)
+		}
+	}
+	fmt.Printf("# %d likely matches, from %d files only in %s and %d only in %s\n", len(matches), nonlyA, labela, len(onlyB), labelb)
+}
+
+// similarity of two names, 0..1 - the better of edit distance and common suffix, relative to the longer
+func similarity(a string, b string) float64 {
+	ra, rb := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	longer := max(len(ra), len(rb))
+	if longer == 0 {
+		return 1
+	}
+	var suffix int
+	for suffix < min(len(ra), len(rb)) && ra[len(ra)-1-suffix] == rb[len(rb)-1-suffix] {
+		suffix++
+	}
+	return max(1-float64(levenshtein(ra, rb))/float64(longer), float64(suffix)/float64(longer))
+}
+
+// edit distance (insertions, deletions and substitutions), over two rows
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
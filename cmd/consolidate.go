@@ -4,7 +4,6 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
-	"bufio"
 	"maps"
 	"slices"
 
@@ -23,7 +22,8 @@ var consolidateCmd = &cobra.Command{
 	Long: `shaman consolidate
 De-duplicates an 'anonymous style' file to a format 1/2/3 result (one with SHA and optionally modify 
 time and size). Output is sorted. Where modify times are present, consolidate outputs the earliest 
-modify date. The resulting file is useful as a 'destroy-list', or a 're-patch origin dates' source.
+modify date. The resulting file is useful as a 'destroy-list', or a 're-patch origin dates' source
+(see 'shaman touch').
 Usage examples:
    shaman con input.ssf                           # writes to stdout
    shaman con file.ssf --overwrite                # overwrites file
@@ -32,7 +32,13 @@ Usage examples:
    shaman con input.ssf output.ssf  -f 2          # write to format 2 (SHA + modify time)
    shaman con input.ssf output.ssf  -f 1          # write to format 1 (SHA only - max anonymised)
 The actual output format will be the lowest or user specified over-ridden by format of input files.
-When picking an earlier date, the year 1980 is considered to be the lowest valid limit.`,
+When picking an earlier date, the year 1980 is considered to be the lowest valid limit.
+Comments are dropped, unless --keep-comments is given: then the comments before a record are written
+before the (sorted) line for its SHA, and any at the end stay at the end.
+With --dry-run, the consolidation is done but nothing is written or replaced: the output's size and
+destination are reported instead (a --low-memory sort still uses scratch space in $TMPDIR).
+Inputs over 1GB (or any input with --low-memory) are sorted on disk in chunks, so memory use stays
+bounded however many records there are (temporary files go in $TMPDIR).`,
 	Aliases: []string{"con"},
 	GroupID: "G3",
 
@@ -45,21 +51,21 @@ When picking an earlier date, the year 1980 is considered to be the lowest valid
 func init() {
 	rootCmd.AddCommand(consolidateCmd)
 
-	consolidateCmd.Flags().IntVarP(&cli_format, "format", "f", 0, "Format/anonymisation level 1..3")
+	consolidateCmd.Flags().StringVarP(&cli_format, "format", "f", "", "Format: sha, sha+time or sha+time+size (or 1..3, default 3)")
 	consolidateCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Overwrite input file")
+	consolidateCmd.Flags().BoolVarP(&cli_lowmem, "low-memory", "", false, "Sort on disk rather than in memory (automatic for inputs over 1GB)")
+	consolidateCmd.Flags().BoolVarP(&cli_dryrun, "dry-run", "n", false, "Do everything but write: report what would be written, touching no file")
+	consolidateCmd.Flags().BoolVarP(&cli_keepcomments, "keep-comments", "", false, "Carry comment lines through, with the records they come before")
 }
 
 // ----------------------- Consolidate function below this line -----------------------
 
 func con(args []string) {
-	var w *bufio.Writer // write buffer
+	var w *writeSSF     // write buffer
 	var fnr string = "" // read filename
 	var fnw string = "" // write filename
-	var form int = 3    // format: default is 3 (SHA+modtime+size)
 
-	if cli_format != 0 {
-		form = cli_format
-	}
+	form := formatParse(3, 1, 2, 3) // format: default is 3 (SHA+modtime+size)
 
 	slog.Debug("cons - prep", "cli_format", cli_format, "form", form)
 
@@ -74,10 +80,6 @@ func con(args []string) {
 		abort(8, "Too many .ssf files specified - expected one or two")
 	case !found[0]:
 		abort(6, "Input SSF file '"+files[0]+"' does not exist")
-	case form == 9:
-		abort(6, "Cannot consolidate using sha256sum format")
-	case form < 1 && form > 3:
-		abort(6, fmt.Sprintf("Format %d invalid - consolidate only accepts formats 1, 2 and 3 (default)", form))
 
 	// informational
 	case num == 1 && !cli_overwrite:
@@ -87,9 +89,12 @@ func con(args []string) {
 		fnr = files[0]
 		fnw = fnr + ".temp"
 		fmt.Println("File " + fnr + " will be be overwritten")
-	case num == 2 && found[1]:
+	case num == 2:
+		fnr = files[0]
 		fnw = files[1]
-		fmt.Println("Output SSF file '" + files[1] + "' will be overwritten")
+		if found[1] {
+			fmt.Println("Output SSF file '" + files[1] + "' will be overwritten")
+		}
 	}
 
 	// fmt.Println("fnr=", fnr)
@@ -98,15 +103,37 @@ func con(args []string) {
 	// open writer (stdout or file)
 	w = writeInit(fnw)
 
-	// collect with SHA as key and value as empty string, mod-time, or composite time/size
-	var hits = map[string]string{} // scoreboard for smaller collection
-	shas, rows := ssfCollectRead(fnr, hits, form)
-	slog.Debug("ssfCollectRead", "file", fnr, "records", rows, "uniques", shas)
+	// comments by the SHA of the record they come before ("" for those at the end)
+	var comments map[string][]string
+	if cli_keepcomments {
+		comments = map[string][]string{}
+	}
+
+	if extSortWanted(fnr) {
+		// too big for memory - sort on disk
+		shas, rows := ssfCollectSorted(fnr, w.Writer, comments, form)
+		slog.Debug("ssfCollectSorted", "file", fnr, "records", rows, "uniques", shas)
+	} else {
+		// collect with SHA as key and value as empty string, mod-time, or composite time/size
+		var hits = map[string]string{} // scoreboard for smaller collection
+		shas, rows := ssfCollectRead(fnr, hits, comments, form)
+		slog.Debug("ssfCollectRead", "file", fnr, "records", rows, "uniques", shas)
+
+		// write in key order
+		ordered := slices.Sorted(maps.Keys(hits))
+		for _, k := range ordered {
+			for _, c := range comments[k] {
+				fmt.Fprintln(w, c)
+			}
+			fmt.Fprintln(w, k+hits[k])
+		}
+	}
+	for _, c := range comments[""] {
+		fmt.Fprintln(w, c)
+	}
+	w.close()
 
-	// write in key order
-	ordered := slices.Sorted(maps.Keys(hits))
-	for _, k := range ordered {
-		fmt.Fprintln(w, k+hits[k])
+	if cli_overwrite {
+		ssfReplace(fnw, fnr)
 	}
-	w.Flush()
 }
@@ -0,0 +1,146 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	b64 "encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert in.ssf [out.ssf] --to format",
+	Short: "Convert an SSF (or sha256sum file) to another format",
+	Long: `shaman convert in.ssf [out.ssf] --to format [--keep-comments]
+Rewrites the records of an SSF in another format without going back to the files: down to one with
+less in it (e.g. 'sha' drops names, times and sizes; 'named' drops annotations), or across to sha256sum
+(9) and back.  A conversion that needs something the input does not have - a name for a record of an
+anonymous SSF, or a time and size for a line of a sha256sum file - is refused, saying which line:
+   shaman convert full.ssf anon.ssf --to sha
+   shaman convert full.ssf sums.txt --to sha256sum
+The input can be any SSF format, or a sha256sum file.  Comments are dropped unless --keep-comments is
+given.  The output goes to stdout if no out.ssf is given.`,
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G1",
+	Run: func(cmd *cobra.Command, args []string) {
+		cnv(args)
+	},
+}
+
+var cli_to string = ""            // format to convert to
+var cli_keepcomments bool = false // copy comments across
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&cli_to, "to", "t", "", "Format: sha, sha+time, sha+time+size, named, full or sha256sum (or 1..5, 9)")
+	convertCmd.Flags().BoolVarP(&cli_keepcomments, "keep-comments", "", false, "Copy comment lines to the output")
+	convertCmd.MarkFlagRequired("to")
+}
+
+// ----------------------- Convert function below this line -----------------------
+
+// a sha256sum line as a record (format 9 - the SHA and name only), ok=false if it is not one
+func parseSha256sumLine(s string) (ssfRecord, bool) {
+	var rec ssfRecord
+	escaped := strings.HasPrefix(s, `\`) // (sha256sum's marker for a name with '\' or newline in it)
+	s = strings.TrimPrefix(s, `\`)
+	if len(s) < 67 || (s[64:66] != "  " && s[64:66] != " *") {
+		return rec, false
+	}
+	bin, err := hex.DecodeString(s[0:64])
+	if err != nil {
+		return rec, false
+	}
+	rec.format = 9
+	rec.shab64 = b64.StdEncoding.EncodeToString(bin)[0:43]
+	rec.name = s[66:]
+	if escaped {
+		rec.name = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(rec.name)
+	}
+	return rec, true
+}
+
+// what a record is missing for a format ("" if nothing) - 4 and 5 need everything, 9 a name
+func convertMissing(rec ssfRecord, to int) string {
+	switch {
+	case to >= 4 && rec.format < 4:
+		return "name"
+	case to >= 2 && to <= 5 && (rec.format < 2 || rec.format == 9):
+		return "modify time"
+	case to >= 3 && to <= 5 && (rec.format < 3 || rec.format == 9):
+		return "size"
+	}
+	return ""
+}
+
+func cnv(args []string) {
+	to := formatLookup(cli_to, "--to", 1, 2, 3, 4, 5, 9)
+	fnr, fnw := args[0], ""
+	if len(args) == 2 {
+		fnw = args[1]
+	}
+	if _, err := os.Stat(fnr); err != nil {
+		abort(6, "Input file '"+fnr+"' does not exist")
+	}
+	if _, err := os.Stat(fnw); fnw != "" && err == nil {
+		abort(6, "Output file '"+fnw+"' already exists")
+	}
+
+	r, err := ssfOpen(fnr)
+	if err != nil {
+		abort(4, "Can't open "+fnr+" - stuck!")
+	}
+	defer r.Close()
+
+	// (read everything first, so that a refused conversion writes nothing - a comment is kept as a
+	// record of format 0)
+	var recs []ssfRecord
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			if cli_keepcomments && len(s) > 0 {
+				recs = append(recs, ssfRecord{name: s})
+			}
+			continue
+		}
+		rec, ok := parseSha256sumLine(s)
+		if !ok {
+			rec, ok = parseSSFRecord(s)
+		}
+		if !ok {
+			abort(6, fmt.Sprintf("Line %d of %s is not an SSF or sha256sum record", lineno, fnr))
+		}
+		if missing := convertMissing(rec, to); missing != "" {
+			abort(6, fmt.Sprintf("Cannot convert to format %d: line %d of %s has no %s (regenerate from the files instead)", to, lineno, fnr, missing))
+		}
+		if rec.format == 9 && to != 9 {
+			rec.name = escapeName(rec.name)
+		}
+		recs = append(recs, rec)
+	}
+
+	w := writeInit(fnw)
+	for _, rec := range recs {
+		if rec.format == 0 {
+			fmt.Fprintln(w, rec.name)
+			continue
+		}
+		w.record(true, to, 0, "N", rec.shab64, rec.modtime, rec.size, rec.annot, rec.name, "")
+	}
+	w.close()
+	if fnw != "" {
+		fmt.Printf("Converted %d records of %s to format %d in %s\n", w.files(), fnr, to, fnw)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ----------------------- Encrypted SSFs -----------------------
+
+// A manifest leaks the names in a tree, so it can be written encrypted (--encrypt-to) and is decrypted
+// transparently when read.  The work is done by the age or gpg tools, run as filters so that no plaintext
+// is written to disk:
+//   age   recipients are age1... public keys; decrypting uses the identity file named by SHAMAN_AGE_IDENTITY
+//   gpg   any other recipient (key id, fingerprint or email); decrypting uses gpg's own keyring and agent
+
+var cli_encryptto string = "" // recipient for encrypted output
+
+// the command line to encrypt to a recipient
+func cryptEncryptCommand(recipient string) []string {
+	if strings.HasPrefix(recipient, "age1") {
+		return []string{"age", "--encrypt", "--recipient", recipient}
+	}
+	return []string{"gpg", "--encrypt", "--batch", "--quiet", "--yes", "--trust-model", "always", "--recipient", recipient}
+}
+
+// the command line to decrypt a file starting with the given bytes (nil if it is not encrypted)
+func cryptDecryptCommand(head []byte) []string {
+	switch {
+	case bytes.HasPrefix(head, []byte("age-encryption.org/")), bytes.HasPrefix(head, []byte("-----BEGIN AGE ENCRYPTED FILE-----")):
+		identity := os.Getenv("SHAMAN_AGE_IDENTITY")
+		if identity == "" {
+			abort(6, "SSF is age-encrypted - set SHAMAN_AGE_IDENTITY to the identity (key) file to read it")
+		}
+		return []string{"age", "--decrypt", "--identity", identity}
+	case bytes.HasPrefix(head, []byte("\xef\xbb\xbf")):
+		return nil // (a byte-order mark - an SSF saved by a Windows editor)
+	case bytes.HasPrefix(head, []byte("-----BEGIN PGP MESSAGE-----")), len(head) > 0 && head[0] >= 0x80:
+		// (an SSF is ASCII, so a high first byte can only be a binary OpenPGP packet)
+		return []string{"gpg", "--decrypt", "--batch", "--quiet"}
+	}
+	return nil
+}
+
+// start a filter command reading from in, returning its output
+func cryptStart(c []string, in io.Reader) (*exec.Cmd, io.ReadCloser) {
+	bin, err := exec.LookPath(c[0])
+	if err != nil {
+		abort(9, c[0]+" is not installed (needed for encrypted SSFs)")
+	}
+	cmd := exec.Command(bin, c[1:]...)
+	cmd.Stdin, cmd.Stderr = in, os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		abort(4, "Cannot run "+c[0])
+	}
+	if err := cmd.Start(); err != nil {
+		abort(4, "Cannot run "+c[0]+": "+err.Error())
+	}
+	return cmd, out
+}
+
+// ---- reading
+
+// an SSF being read - plain, or through a decryption filter
+type ssfFile struct {
+	f    *os.File
+	r    io.Reader
+	cmd  *exec.Cmd // decryption filter (or nil)
+	fn   string
+	done bool
+	bom  bool // byte-order mark dropped (see ssfScanner)
+	crlf int  // lines that ended CRLF
+}
+
+// Open an SSF for reading, decrypting it if it is encrypted
+func ssfOpen(fn string) (*ssfFile, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(f, 64*1024)
+	head, _ := br.Peek(64)
+	s := &ssfFile{f: f, r: br, fn: fn}
+	if c := cryptDecryptCommand(head); c != nil {
+		s.cmd, s.r = cryptStart(c, br)
+	}
+	return s, nil
+}
+
+func (s *ssfFile) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF && s.cmd != nil && !s.done {
+		// check the decryption worked before the reader sees the end
+		s.done = true
+		if werr := s.cmd.Wait(); werr != nil {
+			abort(4, "Cannot decrypt "+s.fn+" (is the key available?)")
+		}
+	}
+	return n, err
+}
+
+func (s *ssfFile) Close() error {
+	if s.cmd != nil && !s.done {
+		s.done = true
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+	return s.f.Close()
+}
+
+// ---- writing
+
+// an encryption filter writing to a file
+type cryptWriter struct {
+	in  io.WriteCloser
+	cmd *exec.Cmd
+	f   *os.File
+	fn  string
+}
+
+// create a file (or stdout, for "") written through the encryption filter for --encrypt-to
+func cryptCreate(fn string) *cryptWriter {
+	c := cryptEncryptCommand(cli_encryptto)
+	bin, err := exec.LookPath(c[0])
+	if err != nil {
+		abort(9, c[0]+" is not installed (needed for --encrypt-to)")
+	}
+	f := os.Stdout
+	if fn != "" {
+		f, err = os.Create(fn)
+		if err != nil {
+			abort(4, "Cannot create file "+fn)
+		}
+	}
+	cmd := exec.Command(bin, c[1:]...)
+	cmd.Stdout, cmd.Stderr = f, os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		abort(4, "Cannot run "+c[0])
+	}
+	if err := cmd.Start(); err != nil {
+		abort(4, "Cannot run "+c[0]+": "+err.Error())
+	}
+	return &cryptWriter{in: in, cmd: cmd, f: f, fn: fn}
+}
+
+func (c *cryptWriter) Write(p []byte) (int, error) {
+	return c.in.Write(p)
+}
+
+// finish the encryption (the output is only complete once this has returned)
+func (c *cryptWriter) Close() error {
+	c.in.Close()
+	if err := c.cmd.Wait(); err != nil {
+		if c.fn != "" {
+			c.f.Close()
+			os.Remove(c.fn)
+		}
+		abort(4, "Cannot encrypt for '"+cli_encryptto+"' (is the recipient's key known?)")
+	}
+	if c.fn == "" {
+		return nil
+	}
+	return c.f.Close()
+}
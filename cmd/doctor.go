@@ -0,0 +1,193 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check this machine and tree for problems before a long run",
+	Long: `shaman doctor [-p path]
+Checks the environment that shaman will be running in, for the given tree (default current directory):
+ - inotify watch limit against the number of directories (Linux - needed to watch a tree)
+ - open-file limit against the number of workers that may be used
+ - whether the filesystem is case sensitive (names differing only in case are distinct files)
+ - extended attribute support (Linux)
+ - clock sanity - the system clock, and the filesystem's idea of 'now' (network mounts can differ)
+ - write access to the directory (for SSFs and snapshots)
+Each problem is given with advice on fixing it.  The exit code is 1 if any check fails.`,
+	Args:    cobra.NoArgs,
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		doc()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to check (default is current directory)")
+}
+
+// ----------------------- Doctor function below this line -----------------------
+
+// the result of one check - ok, warn (works, but may cause trouble) or fail
+type doctorResult struct {
+	status string // "OK", "WARN" or "FAIL" ("" if not applicable here)
+	detail string
+	advice string
+}
+
+func doc() {
+	var startpath string = "."
+	if cli_path != "" {
+		startpath = cli_path
+	}
+	if st, err := os.Stat(startpath); err != nil || !st.IsDir() {
+		abort(6, "Directory '"+startpath+"' does not exist")
+	}
+
+	// count the directories (one inotify watch each)
+	var ndirs int64
+	filepath.WalkDir(startpath, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			ndirs++
+		}
+		return nil
+	})
+
+	checks := []struct {
+		name string
+		run  func() doctorResult
+	}{
+		{"inotify watches", func() doctorResult { return doctorInotify(ndirs) }},
+		{"open files", doctorOpenFiles},
+		{"case sensitivity", func() doctorResult { return doctorCase(startpath) }},
+		{"extended attributes", func() doctorResult { return doctorXattr(startpath) }},
+		{"clock", func() doctorResult { return doctorClock(startpath) }},
+		{"write access", func() doctorResult { return doctorWrite(startpath) }},
+	}
+
+	fmt.Printf("Checking %s (%s directories)\n", startpath, intAsString(ndirs))
+	var problems int
+	for _, c := range checks {
+		r := c.run()
+		if r.status == "" {
+			continue
+		}
+		fmt.Printf("  %-4s  %-20s %s\n", r.status, c.name, r.detail)
+		if r.status != "OK" {
+			if r.advice != "" {
+				fmt.Printf("        %-20s -> %s\n", "", r.advice)
+			}
+			if r.status == "FAIL" {
+				problems++
+			}
+		}
+	}
+	if problems > 0 {
+		abort(1, fmt.Sprintf("%d problem(s) found", problems))
+	}
+	fmt.Println("No problems found")
+}
+
+// a scratch file in the directory (removed by the caller), or "" if one cannot be made
+func doctorScratch(dir string, name string) string {
+	fn := path.Join(dir, name+strconv.Itoa(os.Getpid()))
+	f, err := os.Create(fn)
+	if err != nil {
+		return ""
+	}
+	f.Close()
+	return fn
+}
+
+func doctorInotify(ndirs int64) doctorResult {
+	b, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return doctorResult{} // not Linux
+	}
+	limit, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	detail := fmt.Sprintf("limit %s, tree needs %s", intAsString(limit), intAsString(ndirs))
+	advice := fmt.Sprintf("raise it: sysctl fs.inotify.max_user_watches=%d (and add to /etc/sysctl.conf)", max(ndirs*2, 524288))
+	switch {
+	case limit < ndirs:
+		return doctorResult{"FAIL", detail, advice}
+	case limit < ndirs*2:
+		return doctorResult{"WARN", detail + " (little headroom - other programs use watches too)", advice}
+	}
+	return doctorResult{"OK", detail, ""}
+}
+
+// open files needed: a few per worker, plus the SSFs and standard streams
+const doctorFilesWanted = 1024
+
+func doctorOpenFiles() doctorResult {
+	limit, ok := doctorFileLimit()
+	if !ok {
+		return doctorResult{}
+	}
+	detail := "limit " + intAsString(int64(limit))
+	if limit < doctorFilesWanted {
+		return doctorResult{"WARN", detail + " (low for many --workers)", fmt.Sprintf("raise it: ulimit -n %d (or LimitNOFILE= in a systemd unit)", doctorFilesWanted*4)}
+	}
+	return doctorResult{"OK", detail, ""}
+}
+
+func doctorCase(dir string) doctorResult {
+	fn := doctorScratch(dir, ".shaman-doctor-case-")
+	if fn == "" {
+		return doctorResult{"WARN", "not checked (directory not writable)", ""}
+	}
+	defer os.Remove(fn)
+	if _, err := os.Stat(path.Join(dir, strings.ToUpper(path.Base(fn)))); err == nil {
+		return doctorResult{"WARN", "case insensitive", "names differing only in case are the same file here - SSFs from case sensitive systems may not verify"}
+	}
+	return doctorResult{"OK", "case sensitive", ""}
+}
+
+func doctorClock(dir string) doctorResult {
+	now := time.Now()
+	if now.Year() < 2025 {
+		return doctorResult{"FAIL", "system clock says " + now.Format(time.DateTime), "set the clock (e.g. enable NTP) - modify times are compared against it"}
+	}
+	fn := doctorScratch(dir, ".shaman-doctor-clock-")
+	if fn == "" {
+		return doctorResult{"OK", now.Format(time.DateTime) + " (filesystem clock not checked)", ""}
+	}
+	defer os.Remove(fn)
+	st, err := os.Stat(fn)
+	if err != nil {
+		return doctorResult{"OK", now.Format(time.DateTime) + " (filesystem clock not checked)", ""}
+	}
+	skew := st.ModTime().Sub(now).Round(time.Second)
+	detail := fmt.Sprintf("%s, filesystem differs by %s", now.Format(time.DateTime), skew)
+	if skew > 5*time.Second || skew < -5*time.Second {
+		return doctorResult{"WARN", detail, "synchronise the file server's clock - new files will look older or newer than they are"}
+	}
+	return doctorResult{"OK", detail, ""}
+}
+
+func doctorWrite(dir string) doctorResult {
+	fn := doctorScratch(dir, ".shaman-doctor-write-")
+	if fn == "" {
+		return doctorResult{"FAIL", "cannot create files in " + dir, "write SSFs elsewhere (give a path for the output), or fix the permissions"}
+	}
+	os.Remove(fn)
+	return doctorResult{"OK", "can create files", ""}
+}
@@ -0,0 +1,31 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"syscall"
+)
+
+// ----------------------- Doctor checks for Linux
+
+// the soft limit on open files
+func doctorFileLimit() (uint64, bool) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, false
+	}
+	return rl.Cur, true
+}
+
+func doctorXattr(dir string) doctorResult {
+	fn := doctorScratch(dir, ".shaman-doctor-xattr-")
+	if fn == "" {
+		return doctorResult{"WARN", "not checked (directory not writable)", ""}
+	}
+	defer syscall.Unlink(fn)
+	if err := syscall.Setxattr(fn, "user.shaman", []byte("1"), 0); err != nil {
+		return doctorResult{"WARN", "not supported (" + err.Error() + ")", "copies onto this filesystem will lose extended attributes - mount with user_xattr if they matter"}
+	}
+	return doctorResult{"OK", "supported", ""}
+}
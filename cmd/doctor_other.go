@@ -0,0 +1,16 @@
+//go:build !linux
+
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+// ----------------------- Doctor checks for other systems (not checked)
+
+func doctorFileLimit() (uint64, bool) {
+	return 0, false
+}
+
+func doctorXattr(dir string) doctorResult {
+	return doctorResult{}
+}
@@ -4,9 +4,11 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"maps"
+	"os"
 	"slices"
 	"strings"
 
@@ -18,7 +20,35 @@ var duplicatesCmd = &cobra.Command{
 	Use:   "duplicates",
 	Short: "Detect multiple copies of same file / generate 'rm' declutter list",
 	Long: `Scans an SSF file looking for repeated SHAs, and generates a list of the duplicates as commented-out
-bash instructions to delete the files.  Edit this to decide which to delete as appropriate.`,
+bash instructions to delete the files.  Edit this to decide which to delete as appropriate.
+Records with a quick (partial) hash that match are fully hashed from the files under --path first.
+For automation, --output json gives an array of groups {sha, size, files:[...]}, and --output script
+gives an executable script removing all but one file of each group, the one kept being chosen by
+--keep: first (in the SSF, default), shortest or longest (name), oldest or newest (modify time).
+
+shaman dup --trees dirA dirB
+Compares two directories directly, without SSFs, listing the files in dirB whose contents are already
+somewhere in dirA (i.e. the copies in dirB that could go).  Only files whose sizes match one in the other
+tree are hashed, and the two trees are hashed in parallel.  --output script gives the 'rm' commands.
+
+shaman dup --scan dir
+Finds the duplicates within a directory directly, in passes: files are grouped by size, those sharing a
+size are given a fast (non-cryptographic) XXH64, and only those still sharing one are given a SHA256 -
+which is what the duplicates reported are made from.  On a media library this is typically many times
+faster than hashing everything.  --output and --keep are as for an SSF.
+
+With --size-only (from an SSF, or with --scan from a directory), nothing is hashed: the groups of files
+sharing a size are listed as duplicate candidates, biggest first - a quick first look at a cold external
+drive, where reading every byte would take too long.
+
+shaman dup --photos file.ssf
+For an SSF made with '--annotate media', reports the photos that are exact duplicates (same SHA), and
+also those that are probably the same shot - the same pixel size and EXIF date taken, but different
+contents (re-saved, edited or exported again) - as groups to look through.  --output json is supported.
+
+With --drop-known known.ssf (from an SSF, or with --scan), files whose SHA256 is in that reference set of
+known-good hashes are left out of the report - copies of the same operating system or application file
+are expected, and not clutter.`,
 	Aliases: []string{"dup"},
 	GroupID: "G2",
 	Args:    cobra.MaximumNArgs(99), // handle in code
@@ -31,11 +61,45 @@ func init() {
 	rootCmd.AddCommand(duplicatesCmd)
 
 	duplicatesCmd.Flags().BoolVarP(&cli_incsha, "include-sha", "", false, "Include SHA on any output")
+	duplicatesCmd.Flags().StringVarP(&cli_output, "output", "", "text", "Output style: text, json or script")
+	duplicatesCmd.Flags().StringVarP(&cli_keeppolicy, "keep", "", "first", "With --output script, which file to keep: first, shortest, longest, oldest or newest")
+	duplicatesCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to, for confirming quick hashes")
+	duplicatesCmd.Flags().BoolVarP(&cli_trees, "trees", "", false, "Compare two directories (dirA dirB) instead of reading an SSF")
+	duplicatesCmd.Flags().BoolVarP(&cli_scan, "scan", "", false, "Find the duplicates within a directory instead of reading an SSF (size, XXH64, then SHA256)")
+	duplicatesCmd.Flags().BoolVarP(&cli_sizeonly, "size-only", "", false, "List groups of files with the same size as candidates, without hashing")
+	duplicatesCmd.Flags().BoolVarP(&cli_photos, "photos", "", false, "Group photos by SHA, and by pixel size and date taken (probable duplicates)")
+	duplicatesCmd.Flags().IntVarP(&cli_workers, "workers", "w", 1, "With --trees or --scan, number of files to hash in parallel")
+	duplicatesCmd.Flags().StringVarP(&cli_dropknown, "drop-known", "", "", "Leave out files whose hash is in this set of known-good hashes (SSF, hash list or NSRL CSV)")
 }
 
+var cli_output string = "text"      // output style
+var cli_keeppolicy string = "first" // which file of a group a script keeps
+var cli_trees bool = false          // compare two directories directly
+var cli_scan bool = false           // find the duplicates in a directory directly
+var cli_sizeonly bool = false       // candidates by size alone
+var cli_photos bool = false         // exact and probable duplicate photos
+
 // ----------------------- Duplicate function below this line -----------------------
 
 func dup(args []string) {
+	if cli_trees {
+		dupTrees(args)
+		return
+	}
+	if cli_photos {
+		dupPhotos(args)
+		return
+	}
+	if cli_sizeonly {
+		dupSizeOnly(args)
+		return
+	}
+	knownLoad()
+	if cli_scan {
+		dupScan(args)
+		return
+	}
+
 	// Make sure we have a single input file that exists / error appropriately
 	num, files, found := getSSFs(args)
 	slog.Debug("cli handler", "num", num, "files", files, "found", found)
@@ -46,26 +110,60 @@ func dup(args []string) {
 		abort(9, "Need an SSF file to perform dupe-check")
 	case !found[0]:
 		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case !slices.Contains([]string{"text", "json", "script"}, cli_output):
+		abort(6, "Invalid --output '"+cli_output+"' (valid: text, json, script)")
+	case !slices.Contains([]string{"first", "shortest", "longest", "oldest", "newest"}, cli_keeppolicy):
+		abort(6, "Invalid --keep '"+cli_keeppolicy+"' (valid: first, shortest, longest, oldest, newest)")
 	}
 
+	// commentary goes to stderr when stdout is for a machine
+	info := os.Stdout
+	if cli_output != "text" {
+		info = os.Stderr
+	}
+
+	// Confirm any matching quick hashes (the scan then uses the resolved copy)
+	scan, cleanup := quickResolve(files[0:1], cli_path)
+	defer cleanup()
+	fnr := scan[0]
+
 	// How big?
-	len_a := ssfRecCount(files[0])
+	len_a := ssfRecCount(fnr)
 	slog.Debug("validate and count", "len", len_a, "file", files[0])
-	fmt.Printf("Valid file with %d SSF records\n", len_a)
+	fmt.Fprintf(info, "Valid file with %d SSF records\n", len_a)
 
 	// Use scoreboarding to optimize processing
 	var multiple = map[string]bool{} // scoreboard for dupe detect
-	rows, dupes := ssfScoreboardDupRead(files[0], multiple)
+	rows, dupes := ssfScoreboardDupRead(fnr, multiple)
 	slog.Debug("dup scoreboard read", "file", files[0], "records", rows, "dupes", dupes)
-	fmt.Printf("File %s has %d SHAs with duplicate files\n", files[0], dupes)
+	fmt.Fprintf(info, "File %s has %d SHAs with duplicate files\n", files[0], dupes)
+	if n := dupDropKnown(multiple); n > 0 {
+		fmt.Fprintf(info, "Left out %d of them whose SHA is listed in %s\n", n, cli_dropknown)
+	}
 
 	// Strip map of non-duplicates, and quit if none to show
 	shas := ssfScoreboardRemove(multiple, false) // unnec
 	slog.Debug("duplication", "shas", shas)
+	if shas == 0 && cli_output == "json" {
+		fmt.Println("[]")
+		return
+	}
 	if shas == 0 {
+		cleanup()
 		abort(0, fmt.Sprintf("There are no duplicated files in '%s'", files[0]))
 	}
 
+	// machine-readable outputs work from whole records
+	if cli_output != "text" {
+		groups := dupGroups(fnr, multiple)
+		if cli_output == "json" {
+			dupJSON(groups)
+		} else {
+			dupScript(groups)
+		}
+		return
+	}
+
 	// FORMING THE SORTED LIST OF DUPES - HOW IT WORKS
 	// We generate two maps:
 	//   first[]  : key=filename, val=sha  (the first filename to use this sha)
@@ -77,7 +175,7 @@ func dup(args []string) {
 	// Collect data using pair of maps joined by sha...
 	var first = map[string]string{}  // first fn to use sha -> sha
 	var report = map[string]string{} // sha -> report text
-	nreports, nfiles := sshScoreboardReadMapMap(multiple, files[0], first, report)
+	nreports, nfiles := sshScoreboardReadMapMap(multiple, fnr, first, report)
 	fmt.Printf("Found %d duplicate blocks comprising %d files (potentially %d excess files)\n", nreports, nfiles, nfiles-nreports)
 
 	// Create chunks of answers, sorted by first filename, and write out (optional sha)
@@ -95,3 +193,109 @@ func dup(args []string) {
 		fmt.Println("")
 	}
 }
+
+// unmark the duplicated SHAs that are in the --drop-known set, returning how many
+func dupDropKnown(multiple map[string]bool) int {
+	var n int
+	for sha, multi := range multiple {
+		if multi && knownSHAs[sha] {
+			multiple[sha] = false
+			n++
+		}
+	}
+	return n
+}
+
+// collect the records of each duplicated SHA, in order of each group's first name
+func dupGroups(fnr string, multiple map[string]bool) [][]ssfRecord {
+	var groups = map[string][]ssfRecord{}
+	var order []string
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if !multiple[rec.shab64] || entryIsSpecial(rec) {
+			return
+		}
+		if _, ok := groups[rec.shab64]; !ok {
+			order = append(order, rec.shab64)
+		}
+		groups[rec.shab64] = append(groups[rec.shab64], rec)
+	})
+
+	var out [][]ssfRecord
+	for _, sha := range order {
+		out = append(out, groups[sha])
+	}
+	slices.SortFunc(out, func(a, b []ssfRecord) int {
+		return strings.Compare(a[0].name, b[0].name)
+	})
+	return out
+}
+
+func dupJSON(groups [][]ssfRecord) {
+	type dupGroup struct {
+		Sha   string   `json:"sha"`
+		Size  int64    `json:"size"`
+		Files []string `json:"files"`
+	}
+	var out = []dupGroup{}
+	for _, g := range groups {
+		d := dupGroup{Sha: g[0].shab64, Size: decodeHex(g[0].size)}
+		for _, rec := range g {
+			d.Files = append(d.Files, rec.name)
+		}
+		out = append(out, d)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
+
+// the index of the record a script keeps, according to --keep
+func dupKeep(g []ssfRecord) int {
+	keep := 0
+	for x, rec := range g {
+		k := g[keep]
+		switch cli_keeppolicy {
+		case "shortest":
+			if len(rec.name) < len(k.name) {
+				keep = x
+			}
+		case "longest":
+			if len(rec.name) > len(k.name) {
+				keep = x
+			}
+		case "oldest":
+			if rec.modtime < k.modtime {
+				keep = x
+			}
+		case "newest":
+			if rec.modtime > k.modtime {
+				keep = x
+			}
+		}
+	}
+	return keep
+}
+
+func dupScript(groups [][]ssfRecord) {
+	var excess int
+	fmt.Println("#!/bin/bash")
+	fmt.Printf("# Remove duplicates - keeping the %s file of each group\n", cli_keeppolicy)
+	for _, g := range groups {
+		if slices.ContainsFunc(g, func(rec ssfRecord) bool { return quickAnnotated(rec.annot) > 0 }) {
+			// never delete on the strength of a partial hash
+			fmt.Println("")
+			fmt.Println("# skipped - quick hash not confirmed: \"" + bashEscape(g[0].name) + "\"")
+			continue
+		}
+		keep := dupKeep(g)
+		fmt.Println("")
+		fmt.Println("# keep \"" + bashEscape(g[keep].name) + "\"")
+		for x, rec := range g {
+			if x != keep {
+				fmt.Println("rm -- \"" + bashEscape(rec.name) + "\"")
+				excess++
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Script removes %d excess files from %d groups\n", excess, len(groups))
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ----------------------- Live duplicate scan (dup --scan) -----------------------
+
+// Finding the duplicates in a tree does not need a SHA256 of every file.  The scan is in passes, each
+// only looking at the survivors of the one before: files are grouped by size (a file with a size of its
+// own cannot be a duplicate); the candidates are given a fast XXH64 and regrouped; and only those still
+// in a group are given a SHA256, which is what the groups reported are finally made from.
+
+// the XXH64s of the files, worked out in parallel (in the same order - ok is false if it could not be read)
+func dupScanXXH64(files []triplex, workers int) (sums []uint64, ok []bool) {
+	sums, ok = make([]uint64, len(files)), make([]bool, len(files))
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for x, t := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sums[x], ok[x] = getFileXXH64(t.filename); !ok[x] {
+				fmt.Fprintf(os.Stderr, "Skipping unreadable file: %s\n", t.filename)
+			}
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return sums, ok
+}
+
+// the files that share a key with another, in walk order
+func dupScanSurvivors[K comparable](files []triplex, key func(x int) K) []triplex {
+	count := map[K]int{}
+	for x := range files {
+		count[key(x)]++
+	}
+	var out []triplex
+	for x, t := range files {
+		if count[key(x)] > 1 {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func dupScan(args []string) {
+	switch {
+	case len(args) != 1:
+		abort(9, "--scan needs one directory")
+	case !slices.Contains([]string{"text", "json", "script"}, cli_output):
+		abort(6, "Invalid --output '"+cli_output+"' (valid: text, json, script)")
+	case !slices.Contains([]string{"first", "shortest", "longest", "oldest", "newest"}, cli_keeppolicy):
+		abort(6, "Invalid --keep '"+cli_keeppolicy+"' (valid: first, shortest, longest, oldest, newest)")
+	}
+	if st, err := os.Stat(args[0]); err != nil || !st.IsDir() {
+		abort(6, "Directory '"+args[0]+"' does not exist")
+	}
+	info := os.Stdout
+	if cli_output != "text" {
+		info = os.Stderr
+	}
+
+	// pass 1: size (empty files are all the same, and not worth reporting)
+	all := dupTreeWalk(args[0], walkOptionsFromFlags())
+	var files []triplex
+	for _, t := range all {
+		if t.size > 0 {
+			files = append(files, t)
+		}
+	}
+	sized := dupScanSurvivors(files, func(x int) int64 { return files[x].size })
+
+	// pass 2: XXH64 within size
+	sums, ok := dupScanXXH64(sized, cli_workers)
+	type sizeSum struct {
+		size int64
+		sum  uint64
+	}
+	candidates := dupScanSurvivors(sized, func(x int) sizeSum {
+		if !ok[x] {
+			return sizeSum{-1 - int64(x), 0} // (unreadable - a group of its own)
+		}
+		return sizeSum{sized[x].size, sums[x]}
+	})
+	fmt.Fprintf(info, "%d files, %d sharing a size, %d sharing a size and XXH64 - SHA256ing those\n", len(all), len(sized), len(candidates))
+
+	// pass 3: SHA256 of the survivors, grouped
+	in := make(chan triplex, 4096)
+	go func() {
+		defer close(in)
+		for _, t := range candidates {
+			in <- t
+		}
+	}()
+	var groups = map[string][]ssfRecord{}
+	var order []string
+	for h := range hashTriplexes(in, cli_workers) {
+		if _, ok := groups[h.shab64]; !ok {
+			order = append(order, h.shab64)
+		}
+		groups[h.shab64] = append(groups[h.shab64], ssfRecord{5, h.shab64, encodeModTime(h.modified), encodeSize(h.size), "", h.filename})
+	}
+	var dups [][]ssfRecord
+	var excess int
+	var nknown int
+	for _, sha := range order {
+		if len(groups[sha]) > 1 && knownSHAs[sha] {
+			nknown++
+			continue
+		}
+		if len(groups[sha]) > 1 {
+			dups = append(dups, groups[sha])
+			excess += len(groups[sha]) - 1
+		}
+	}
+	slices.SortFunc(dups, func(a, b []ssfRecord) int {
+		return strings.Compare(a[0].name, b[0].name)
+	})
+	if nknown > 0 {
+		fmt.Fprintf(info, "Left out %d duplicated SHAs listed in %s\n", nknown, cli_dropknown)
+	}
+
+	switch cli_output {
+	case "json":
+		dupJSON(dups)
+	case "script":
+		dupScript(dups)
+	default:
+		fmt.Printf("Found %d duplicate blocks comprising %d files (potentially %d excess files)\n", len(dups), len(dups)+excess, excess)
+		for _, g := range dups {
+			if cli_incsha {
+				fmt.Println("# " + g[0].shab64)
+			}
+			for _, rec := range g {
+				fmt.Println("#rm \"" + rec.name + "\"")
+			}
+			fmt.Println("")
+		}
+	}
+}
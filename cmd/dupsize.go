@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ----------------------- Size-only candidates (dup --size-only) -----------------------
+
+// Files can only be duplicates if they are the same size, and sizes come from the directory alone - so
+// on a cold external drive, where reading every byte would take hours, the groups of files sharing a
+// size are a quick first look at what might be duplicated.  Nothing is hashed: they are only candidates.
+
+// the files of each size shared by more than one (empty files, directories and links aside)
+type sizeGroup struct {
+	Size  int64    `json:"size"`
+	Files []string `json:"files"`
+}
+
+func dupSizeOnly(args []string) {
+	if !slices.Contains([]string{"text", "json"}, cli_output) {
+		abort(6, "Invalid --output '"+cli_output+"' with --size-only (valid: text, json - nothing is confirmed to remove)")
+	}
+	info := os.Stdout
+	if cli_output != "text" {
+		info = os.Stderr
+	}
+
+	// from the tree, or from an SSF
+	var names []string
+	var sizes []int64
+	if cli_scan {
+		if len(args) != 1 {
+			abort(9, "--scan needs one directory")
+		}
+		if st, err := os.Stat(args[0]); err != nil || !st.IsDir() {
+			abort(6, "Directory '"+args[0]+"' does not exist")
+		}
+		for _, t := range dupTreeWalk(args[0], walkOptionsFromFlags()) {
+			names, sizes = append(names, t.filename), append(sizes, t.size)
+		}
+	} else {
+		num, files, found := getSSFs(args)
+		slog.Debug("cli handler", "num", num, "files", files, "found", found)
+		switch {
+		case num != 1:
+			abort(9, "Need one SSF file (or --scan dir)")
+		case !found[0]:
+			abort(6, "Input SSF file '"+files[0]+"' does not exist")
+		}
+		ssfForEachRecord(files[0], func(rec ssfRecord) {
+			if rec.format < 4 {
+				abort(6, "SSF '"+files[0]+"' has no sizes or names (format "+fmt.Sprint(rec.format)+")")
+			}
+			if !entryIsSpecial(rec) {
+				names, sizes = append(names, rec.name), append(sizes, decodeHex(rec.size))
+			}
+		})
+	}
+
+	// group - biggest first (the most to gain), then by first name
+	bySize := map[int64]*sizeGroup{}
+	for x, n := range names {
+		if sizes[x] == 0 {
+			continue
+		}
+		if bySize[sizes[x]] == nil {
+			bySize[sizes[x]] = &sizeGroup{Size: sizes[x]}
+		}
+		bySize[sizes[x]].Files = append(bySize[sizes[x]].Files, n)
+	}
+	var groups = []sizeGroup{}
+	var nfiles, excess int64
+	for _, g := range bySize {
+		if len(g.Files) > 1 {
+			groups = append(groups, *g)
+			nfiles += int64(len(g.Files))
+			excess += g.Size * int64(len(g.Files)-1)
+		}
+	}
+	slices.SortFunc(groups, func(a, b sizeGroup) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Files[0], b.Files[0])
+	})
+
+	if cli_output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(groups)
+	} else {
+		for _, g := range groups {
+			fmt.Printf("# %d files of %s\n", len(g.Files), bytesAsString(g.Size))
+			for _, n := range g.Files {
+				fmt.Println(n)
+			}
+			fmt.Println("")
+		}
+	}
+	fmt.Fprintf(info, "%d sizes shared by %d files of %d - at most %s in excess copies (not hashed: candidates only)\n",
+		len(groups), nfiles, len(names), bytesAsString(excess))
+}
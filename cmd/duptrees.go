@@ -0,0 +1,146 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ----------------------- Tree-to-tree duplicates (dup --trees) -----------------------
+
+// walk a tree into a list of its files
+func dupTreeWalk(root string, opts walkOptions) []triplex {
+	c := make(chan triplex, 4096)
+	go func() {
+		defer close(c)
+		walkTreeToChannel(root, opts, c)
+	}()
+	var files []triplex
+	for t := range c {
+		files = append(files, t)
+	}
+	return files
+}
+
+// hash the files of a tree whose sizes are wanted, returning sha -> names
+func dupTreeHash(files []triplex, wanted map[int64]bool) map[string][]string {
+	in := make(chan triplex, 4096)
+	go func() {
+		defer close(in)
+		for _, t := range files {
+			if wanted[t.size] {
+				in <- t
+			}
+		}
+	}()
+	shas := map[string][]string{}
+	for h := range hashTriplexes(in, cli_workers) {
+		shas[h.shab64] = append(shas[h.shab64], h.filename)
+	}
+	return shas
+}
+
+func dupTrees(args []string) {
+	switch {
+	case len(args) != 2:
+		abort(9, "--trees needs two directories: dirA dirB")
+	case !slices.Contains([]string{"text", "json", "script"}, cli_output):
+		abort(6, "Invalid --output '"+cli_output+"' (valid: text, json, script)")
+	}
+	var abs []string
+	for _, d := range args {
+		if st, err := os.Stat(d); err != nil || !st.IsDir() {
+			abort(6, "Directory '"+d+"' does not exist")
+		}
+		a, _ := filepath.Abs(d)
+		abs = append(abs, a+"/")
+	}
+	if strings.HasPrefix(abs[0], abs[1]) || strings.HasPrefix(abs[1], abs[0]) {
+		// (a file would match itself, and the script would remove the only copy)
+		abort(6, "The trees overlap - give two separate directories")
+	}
+	info := os.Stdout
+	if cli_output != "text" {
+		info = os.Stderr
+	}
+
+	// walk both, and find the sizes they have in common (only those files can match)
+	var a, b []triplex
+	var wg sync.WaitGroup
+	wg.Add(2)
+	opts := walkOptionsFromFlags()
+	go func() { defer wg.Done(); a = dupTreeWalk(args[0], opts) }()
+	go func() { defer wg.Done(); b = dupTreeWalk(args[1], opts) }()
+	wg.Wait()
+	sizesA := map[int64]bool{}
+	for _, t := range a {
+		sizesA[t.size] = true
+	}
+	common := map[int64]bool{}
+	var candidates int
+	for _, t := range b {
+		if sizesA[t.size] {
+			common[t.size] = true
+			candidates++
+		}
+	}
+	fmt.Fprintf(info, "%s has %d files, %s has %d files (%d with a size found in %s)\n", args[0], len(a), args[1], len(b), candidates, args[0])
+
+	// hash the candidates of both trees in parallel
+	var shaA, shaB map[string][]string
+	wg.Add(2)
+	go func() { defer wg.Done(); shaA = dupTreeHash(a, common) }()
+	go func() { defer wg.Done(); shaB = dupTreeHash(b, common) }()
+	wg.Wait()
+
+	// the files of B already in A, in B's (walk) order
+	type match struct {
+		File    string   `json:"file"`
+		Size    int64    `json:"size"`
+		Matches []string `json:"matches"`
+	}
+	byName := map[string]string{}
+	for sha, names := range shaB {
+		for _, n := range names {
+			byName[n] = sha
+		}
+	}
+	var found = []match{}
+	var nbytes int64
+	for _, t := range b {
+		sha, ok := byName[t.filename]
+		if !ok || len(shaA[sha]) == 0 {
+			continue
+		}
+		found = append(found, match{t.filename, t.size, shaA[sha]})
+		nbytes += t.size
+	}
+
+	switch cli_output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(found)
+	case "script":
+		fmt.Println("#!/bin/bash")
+		fmt.Printf("# Remove the files in %s that are also in %s\n", args[1], args[0])
+		for _, m := range found {
+			fmt.Println("rm -- \"" + bashEscape(m.File) + "\"  # = \"" + bashEscape(m.Matches[0]) + "\"")
+		}
+	default:
+		for _, m := range found {
+			fmt.Println("#rm \"" + m.File + "\"")
+			for _, other := range m.Matches {
+				fmt.Println("#   = \"" + other + "\"")
+			}
+		}
+	}
+	fmt.Fprintf(info, "%d files (%s bytes) in %s are already in %s\n", len(found), intAsString(nbytes), args[1], args[0])
+}
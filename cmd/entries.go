@@ -0,0 +1,168 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ----------------------- Directory and symlink records -----------------------
+
+// Normally only regular files are recorded.  With --dirs and --links (generate and update), directories
+// and symbolic links get records of their own, so that an empty directory going missing, or a link being
+// pointed somewhere else, shows up as a change:
+//   directory   name ends in '/'; modify time of the directory, size 0, and the hash of its sorted list
+//               of entry names - so adding or removing anything in it changes the hash
+//   symlink     annotated 'link=<target>' (with '%', spaces and line breaks %-escaped); modify time of
+//               the link itself, size is the length of the target, and the hash of the target
+//   special     with --specials, a socket, FIFO or device: annotated 'type=fifo' (or socket, chardev,
+//               blockdev) and, for a device, 'dev=major:minor'; size 0, and the hash of the two
+// The hashes are domain-separated ("shaman:dir", "shaman:link", "shaman:special") so they cannot match a
+// file's contents.
+
+var cli_dirs bool = false     // record directories
+var cli_links bool = false    // record symbolic links
+var cli_specials bool = false // record sockets, FIFOs and devices
+
+// a directory record's name
+func entryDirName(name string) string {
+	return name + "/"
+}
+
+// the target of a link record ("" if the record is not a link)
+func entryLinkTarget(annot string) string {
+	v, ok := annotationMap(annot)["link"]
+	if !ok {
+		return ""
+	}
+	target, err := url.PathUnescape(v)
+	if err != nil {
+		return v
+	}
+	return target
+}
+
+// the annotation recording a link's target (escaped so it has no spaces)
+func entryLinkAnnotation(target string) string {
+	return "link=" + entryEscaper.Replace(target)
+}
+
+var entryEscaper = strings.NewReplacer("%", "%25", " ", "%20", "\t", "%09", "\n", "%0A", "\r", "%0D")
+
+// is the record for a directory, link or special file rather than a (regular) file?
+func entryIsSpecial(rec ssfRecord) bool {
+	return strings.HasSuffix(rec.name, "/") || entryLinkTarget(rec.annot) != "" || entrySpecialType(rec.annot) != ""
+}
+
+// the type of a special file's record ("" if the record is not one)
+func entrySpecialType(annot string) string {
+	return annotationMap(annot)["type"]
+}
+
+// the kind of a special file (and a device's numbers), or "" if mode is not one
+func entrySpecialKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "chardev"
+	case mode&os.ModeDevice != 0:
+		return "blockdev"
+	}
+	return ""
+}
+
+// the kind and device numbers if fn is a special file that is being recorded (--specials), or ""
+func entrySpecial(fn string) (kind string, dev string) {
+	if !cli_specials {
+		return "", ""
+	}
+	st, err := os.Lstat(fn)
+	if err != nil {
+		return "", ""
+	}
+	return entrySpecialInfo(st)
+}
+
+// the kind of a special file and, for a device, its numbers
+func entrySpecialInfo(st os.FileInfo) (kind string, dev string) {
+	if kind = entrySpecialKind(st.Mode()); kind == "chardev" || kind == "blockdev" {
+		dev = entryDevice(st)
+	}
+	return kind, dev
+}
+
+// the annotation of a special file's record
+func entrySpecialAnnotation(kind string, dev string) string {
+	if dev == "" {
+		return "type=" + kind
+	}
+	return "type=" + kind + " dev=" + dev
+}
+
+func entrySha(domain string, content string) string {
+	h := sha256.Sum256([]byte("shaman:" + domain + "\n" + content))
+	return b64.StdEncoding.EncodeToString(h[:])[0:43]
+}
+
+// hash of a directory's (sorted) entry names
+func entryDirSha256(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		abort(13, "Found directory cannot be read: "+dir)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	slices.Sort(names)
+	return entrySha("dir", strings.Join(names, "\n"))
+}
+
+// hash of a link's target
+func entryLinkSha256(target string) string {
+	return entrySha("link", target)
+}
+
+// hash of a special file's kind (and device numbers)
+func entrySpecialSha256(kind string, dev string) string {
+	return entrySha("special", kind+" "+dev)
+}
+
+// the target if fn is a symlink that is being recorded (--links), or ""
+func entryLink(fn string) string {
+	if !cli_links {
+		return ""
+	}
+	if st, err := os.Lstat(fn); err != nil || st.Mode()&os.ModeSymlink == 0 {
+		return ""
+	}
+	target, err := os.Readlink(fn)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// hash of a walked entry - directory (name ending '/'), link (with --links), or file
+func getEntrySha256(fn string) string {
+	if strings.HasSuffix(fn, "/") {
+		return entryDirSha256(fn)
+	}
+	if target := entryLink(fn); target != "" {
+		return entryLinkSha256(target)
+	}
+	if kind, dev := entrySpecial(fn); kind != "" {
+		return entrySpecialSha256(kind, dev)
+	}
+	_, sha := getFileSha256(fn)
+	return sha
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ----------------------- Special files and allocation for Linux
+
+// a device's major:minor numbers ("" if not known)
+func entryDevice(st os.FileInfo) string {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	rdev := uint64(sys.Rdev)
+	return fmt.Sprintf("%d:%d", (rdev>>8)&0xfff|(rdev>>32)&^0xfff, rdev&0xff|(rdev>>12)&^0xff)
+}
+
+// the filesystem a file is on, ok=false if not known
+func fileDevice(st os.FileInfo) (uint64, bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(sys.Dev), true
+}
+
+// a file's device and inode, as a key ("" if not known)
+func fileID(st os.FileInfo) string {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", sys.Dev, sys.Ino)
+}
+
+// the space a file takes on disk (from its blocks), ok=false if not known
+func fileAllocated(st os.FileInfo) (int64, bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return sys.Blocks * 512, true
+}
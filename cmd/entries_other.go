@@ -0,0 +1,28 @@
+//go:build !linux
+
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"os"
+)
+
+// ----------------------- Special files and allocation for other systems (not known)
+
+func entryDevice(st os.FileInfo) string {
+	return ""
+}
+
+func fileDevice(st os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+func fileID(st os.FileInfo) string {
+	return ""
+}
+
+func fileAllocated(st os.FileInfo) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ----------------------- File errors (--errors) -----------------------
+
+// A file that cannot be read (or a directory that cannot be listed) would otherwise only get a line on
+// stderr, and be missing from the SSF without trace.  With --errors, generate and update deal with them
+// by a policy - skip (left out), record (left out, with a '# error:' comment at the end of the SSF) or
+// fail (stop at the first) - and say at the end how many paths had errors, exiting with rc 5 if any did.
+// (A sha256sum file, format 9, has no comments - its errors are only on stderr.)
+
+var cli_errors string = "" // skip, record or fail ("" = not asked - the commands' own behaviour)
+
+const errorsExit = 5 // exit code when paths had errors
+
+var fileErrors = struct {
+	sync.Mutex
+	list []string // "path: reason"
+}{}
+
+// check --errors
+func errorsValidate() {
+	switch cli_errors {
+	case "", "skip", "record", "fail":
+	default:
+		abort(6, "Invalid --errors '"+cli_errors+"' (valid: skip, record, fail)")
+	}
+}
+
+// whether errors are being dealt with by a policy (if not, unreadable files are fatal as they always were)
+func errorsOn() bool {
+	return cli_errors != ""
+}
+
+// note a path that could not be read - what is, is a file, directory or entry
+func fileError(what string, name string, err error) {
+	if !errorsOn() {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", what, name)
+		return
+	}
+	reason := what + " cannot be read"
+	if err != nil {
+		reason = err.Error()
+	}
+	if cli_errors == "fail" {
+		abort(errorsExit, "Error: "+name+": "+reason+" (stopping, as --errors fail)")
+	}
+	fmt.Fprintf(os.Stderr, "Skipping %s: %s (%s)\n", what, name, reason)
+	fileErrors.Lock()
+	fileErrors.list = append(fileErrors.list, name+": "+reason)
+	fileErrors.Unlock()
+}
+
+// the '# error:' comments (with --errors record) for the end of the SSF
+func errorsRecord(w *writeSSF) {
+	if cli_errors != "record" {
+		return
+	}
+	for _, e := range fileErrors.list {
+		fmt.Fprintln(w, "# error: "+e)
+	}
+}
+
+// the count of paths with errors, at the end of the run (true if there were any)
+func errorsReport() bool {
+	n := len(fileErrors.list)
+	switch {
+	case !errorsOn():
+		return false
+	case n == 0:
+		fmt.Fprintln(os.Stderr, "No errors")
+	case n == 1:
+		fmt.Fprintln(os.Stderr, "1 path had an error")
+	default:
+		fmt.Fprintf(os.Stderr, "%d paths had errors\n", n)
+	}
+	return n > 0
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"fmt"
+	"os"
+	"strings"
 )
 
 // -------------------------------- Cobra management -------------------------------
@@ -16,7 +18,10 @@ var estimateCmd = &cobra.Command{
 	Use:   "estimate",
 	Short: "Estimate quickly the size/count for a file tree",
 	Long: `shaman estimate
-Used to count the number of files in the file tree, to allow you to perform informed actions!`,
+Used to count the number of files in the file tree, to allow you to perform informed actions!
+The space the files take on disk (from their allocated blocks) is given beside their total size, as
+sparse (or compressed) files take less than their size suggests - and with --specials, the sockets,
+FIFOs and devices in the tree are counted.`,
 	Aliases: []string{"est"},
 	Args:    cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -28,6 +33,7 @@ func init() {
 	rootCmd.AddCommand(estimateCmd)
 
 	estimateCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to scan (default is current directory)")
+	estimateCmd.Flags().BoolVarP(&cli_specials, "specials", "", false, "Count sockets, FIFOs and devices")
 }
 
 // ----------------------- Estimate function below this line -----------------------
@@ -47,10 +53,11 @@ func est(args []string) {
 	}
 
 	// Call the tree walker to generate a file list (as a channel)
+	opts := walkOptionsFromFlags()
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
 	// process file list to provide stats
@@ -60,7 +67,25 @@ func est(args []string) {
 	var mem_long string
 	var largest int64
 	var mem_large string
+	var allocated, sparse, sparse_bytes int64
+	var alloc_known bool
+	specials := map[string]int64{}
 	for filerec := range fileQueue {
+		if info, err := os.Lstat(filerec.filename); err == nil {
+			if kind := entrySpecialKind(info.Mode()); kind != "" {
+				specials[kind]++
+				continue
+			}
+			if a, ok := fileAllocated(info); ok {
+				alloc_known = true
+				allocated += a
+				if filerec.size-a >= 4096 {
+					// (at least a block short - a hole, or compressed)
+					sparse++
+					sparse_bytes += filerec.size - a
+				}
+			}
+		}
 		if longest < len(filerec.filename) {
 			longest = len(filerec.filename)
 			mem_long = filerec.filename
@@ -74,11 +99,26 @@ func est(args []string) {
 	}
 
 	// Totals
-	fmt.Printf("Total files:  %s", intAsStringWithCommas(total_files))
+	fmt.Printf("Total files:  %s", intAsString(total_files))
 	fmt.Println()
-	fmt.Printf("Total bytes:  %s", intAsStringWithCommas(total_bytes))
+	fmt.Printf("Total bytes:  %s", sizeAsString(total_bytes))
 	fmt.Println()
-	fmt.Printf("Largest file: %s %s", intAsStringWithCommas(largest), mem_large)
+	if alloc_known {
+		fmt.Printf("Allocated:    %s", sizeAsString(allocated))
+		if sparse > 0 {
+			fmt.Printf(" (%s sparse files, %s less than their size)", intAsString(sparse), bytesAsString(sparse_bytes))
+		}
+		fmt.Println()
+	}
+	if cli_specials {
+		var kinds []string
+		for _, k := range []string{"socket", "fifo", "chardev", "blockdev"} {
+			kinds = append(kinds, fmt.Sprintf("%s %s", intAsString(specials[k]), k))
+		}
+		fmt.Printf("Specials:     %s", strings.Join(kinds, ", "))
+		fmt.Println()
+	}
+	fmt.Printf("Largest file: %s %s", sizeAsString(largest), mem_large)
 	fmt.Println()
 	fmt.Printf("Longest name: %d %s", longest, mem_long)
 	fmt.Println()
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// expireCmd represents the expire command
+var expireCmd = &cobra.Command{
+	Use:   "expire file.ssf [out.ssf] --older-than age",
+	Short: "List the records past a retention period, by top-level directory",
+	Long: `shaman expire file.ssf [out.ssf] --older-than age [--output text|script]
+Finds the records whose modify time is older than a retention period - an age such as 90d, 6m or 7y,
+or a date (2018-01-31) - and lists them grouped by their top-level directory, with the number of files
+and bytes in each, for records-retention work:
+   shaman expire archive.ssf --older-than 7y
+With --output script, a bash script to remove them is written instead (to be read before it is run),
+and with out.ssf the expired records are written to an SSF, e.g. as the record of what was removed.
+Directories, symlinks and other special entries are not counted.`,
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		expi(args)
+	},
+}
+
+var cli_olderthan string = "" // retention period (an age or a date)
+
+func init() {
+	rootCmd.AddCommand(expireCmd)
+
+	expireCmd.Flags().StringVarP(&cli_olderthan, "older-than", "", "", "Retention period: an age (e.g. 90d, 6m, 7y) or a date (e.g. 2018-01-31)")
+	expireCmd.Flags().StringVarP(&cli_output, "output", "", "text", "Output style: text or script")
+	expireCmd.MarkFlagRequired("older-than")
+}
+
+// ----------------------- Expire function below this line -----------------------
+
+// the top-level directory of a name ("." for files at the top)
+func expireTop(name string) string {
+	if top, _, ok := strings.Cut(name, "/"); ok {
+		return top + "/"
+	}
+	return "."
+}
+
+func expi(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case !found[0]:
+		abort(6, "SSF file '"+files[0]+"' does not exist")
+	case num == 2 && found[1]:
+		abort(6, "Output file '"+files[1]+"' already exists")
+	case !slices.Contains([]string{"text", "script"}, cli_output):
+		abort(6, "Invalid --output '"+cli_output+"' (valid: text, script)")
+	case cli_olderthan == "":
+		abort(6, "Need a retention period (--older-than)")
+	}
+	cutoff := latDate("--older-than", cli_olderthan)
+	info := os.Stdout
+	if cli_output != "text" {
+		info = os.Stderr
+	}
+
+	// the expired records, by top-level directory
+	groups := map[string][]ssfRecord{}
+	var nfiles, nbytes, nexp, nexpbytes int64
+	ssfForEachRecord(files[0], func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+files[0]+"' is anonymous - names are needed to expire records")
+		}
+		if entryIsSpecial(rec) {
+			return
+		}
+		nfiles++
+		nbytes += decodeHex(rec.size)
+		if decodeHex(rec.modtime) >= cutoff {
+			return
+		}
+		nexp++
+		nexpbytes += decodeHex(rec.size)
+		groups[expireTop(rec.name)] = append(groups[expireTop(rec.name)], rec)
+	})
+
+	var w *writeSSF
+	if num == 2 {
+		w = writeInit(files[1])
+		fmt.Fprintf(w, "# expired: records of %s modified before %s\n", files[0], time.Unix(cutoff, 0).Format("2006-01-02"))
+	}
+	if cli_output == "script" {
+		fmt.Println("#!/bin/bash")
+		fmt.Printf("# Remove the files of %s modified before %s\n", files[0], time.Unix(cutoff, 0).Format("2006-01-02"))
+	}
+	for _, top := range slices.Sorted(maps.Keys(groups)) {
+		var gbytes int64
+		for _, rec := range groups[top] {
+			gbytes += decodeHex(rec.size)
+		}
+		if cli_output == "script" {
+			fmt.Println("")
+			fmt.Printf("# %s - %d files (%s)\n", top, len(groups[top]), bytesAsString(gbytes))
+		} else {
+			fmt.Printf("%10s files %10s  %s\n", intAsString(int64(len(groups[top]))), bytesAsString(gbytes), top)
+		}
+		for _, rec := range groups[top] {
+			if cli_output == "script" {
+				fmt.Println("rm -- \"" + bashEscape(unescapeName(rec.name)) + "\"")
+			}
+			if w != nil {
+				w.record(true, rec.format, 0, "N", rec.shab64, rec.modtime, rec.size, rec.annot, rec.name, "")
+			}
+		}
+	}
+	if w != nil {
+		w.close()
+	}
+
+	fmt.Fprintf(info, "%s of %s files (%s of %s) in %s were modified before %s\n", intAsString(nexp), intAsString(nfiles),
+		bytesAsString(nexpbytes), bytesAsString(nbytes), files[0], time.Unix(cutoff, 0).Format("2006-01-02"))
+}
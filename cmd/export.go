@@ -0,0 +1,165 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export file.ssf report.xlsx|data.parquet",
+	Short: "Export an SSF as a spreadsheet or Parquet file",
+	Long: `shaman export file.ssf report.xlsx|data.parquet [--format xlsx|parquet]
+With xlsx, writes a workbook for people who would rather not read an SSF, with three sheets:
+   Records      every file, with its size, modify time, SHA and annotations
+   Extensions   files and bytes per file extension, biggest first
+   Duplicates   each set of identical files, with the space the extra copies take
+With parquet, writes a columnar file for analytics tools (DuckDB, Spark, pandas) with the columns
+sha (32-byte binary), name (string), size (int64 bytes) and mtime (int64 epoch seconds), e.g.
+   duckdb -c "select sum(size) from 'data.parquet' where name like '%.mp4'"
+The output type is taken from the output file's extension unless --format is given.  In xlsx, SHAs are
+base64 as in the SSF, unless --encoding gives base64url, hex or base32 (parquet has them as binary).`,
+	Args:    cobra.ExactArgs(2),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		exp(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Overwrite the output file if it exists")
+	exportCmd.Flags().StringVarP(&cli_exportformat, "format", "f", "", "Output type: xlsx or parquet (default: from the file extension)")
+	exportCmd.Flags().StringVarP(&cli_encoding, "encoding", "", "base64", "SHA encoding in xlsx: base64, base64url, hex or base32")
+}
+
+var cli_exportformat string = "" // xlsx or parquet
+
+// ----------------------- Export function below this line -----------------------
+
+// extension of a name for summaries (lower case, or "(none)")
+func fileExtension(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" || strings.Contains(ext, " ") {
+		return "(none)"
+	}
+	return ext
+}
+
+func exp(args []string) {
+	num, files, found := getSSFs(args[0:1])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+	shaEncodingValidate()
+	fnr, fnw := files[0], args[1]
+	if _, err := os.Stat(fnw); err == nil && !cli_overwrite {
+		abort(6, "Output file '"+fnw+"' already exists (use --overwrite)")
+	}
+
+	form := cli_exportformat
+	if form == "" {
+		form = strings.TrimPrefix(strings.ToLower(path.Ext(fnw)), ".")
+	}
+	switch form {
+	case "xlsx":
+		exportXLSX(fnr, fnw)
+	case "parquet":
+		exportParquet(fnr, fnw)
+	default:
+		abort(6, "Unknown export type '"+form+"' (valid: xlsx, parquet)")
+	}
+}
+
+func exportXLSX(fnr string, fnw string) {
+	x := xlsxCreate(fnw)
+	shaHeading := "SHA256 (" + cli_encoding + ")" // (as --encoding gives them)
+
+	// 1. records (streamed), collecting the summaries as we go
+	type extTotal struct {
+		ext   string
+		files int64
+		bytes int64
+	}
+	var exts = map[string]*extTotal{}
+	var copies = map[string]int{}
+	var nrecs int
+	x.sheet("Records", []string{"Name", "Size", "Modified", shaHeading, "Annotations"}, []int{60, 16, 20, 48, 30})
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+fnr+"' is anonymous - export needs names")
+		}
+		size := decodeHex(rec.size)
+		x.add(xlsxText(rec.name), xlsxNum(size), xlsxTime(decodeHex(rec.modtime)), xlsxText(shaEncode(rec.shab64)), xlsxText(rec.annot))
+
+		ext := fileExtension(rec.name)
+		if exts[ext] == nil {
+			exts[ext] = &extTotal{ext: ext}
+		}
+		exts[ext].files++
+		exts[ext].bytes += size
+		copies[rec.shab64]++
+		nrecs++
+	})
+
+	// 2. extensions, biggest first
+	x.sheet("Extensions", []string{"Extension", "Files", "Bytes"}, []int{16, 12, 20})
+	summary := slices.Collect(maps.Values(exts))
+	slices.SortFunc(summary, func(a, b *extTotal) int {
+		return cmp.Or(cmp.Compare(b.bytes, a.bytes), strings.Compare(a.ext, b.ext))
+	})
+	for _, e := range summary {
+		x.add(xlsxText(e.ext), xlsxNum(e.files), xlsxNum(e.bytes))
+	}
+
+	// 3. duplicates (a second pass, for just the duplicated SHAs)
+	var groups = map[string][]ssfRecord{}
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if copies[rec.shab64] > 1 {
+			groups[rec.shab64] = append(groups[rec.shab64], rec)
+		}
+	})
+	order := slices.Collect(maps.Values(groups))
+	slices.SortFunc(order, func(a, b []ssfRecord) int {
+		return strings.Compare(a[0].name, b[0].name)
+	})
+	x.sheet("Duplicates", []string{"Set", "Copies", "Size", "Wasted bytes", "Name", shaHeading}, []int{8, 8, 16, 16, 60, 48})
+	for n, g := range order {
+		size := decodeHex(g[0].size)
+		for _, rec := range g {
+			x.add(xlsxNum(int64(n+1)), xlsxNum(int64(len(g))), xlsxNum(size), xlsxNum(size*int64(len(g)-1)), xlsxText(rec.name), xlsxText(shaEncode(rec.shab64)))
+		}
+	}
+
+	x.close()
+	fmt.Printf("Exported %d records, %d extensions, %d duplicate sets to %s\n", nrecs, len(summary), len(order), fnw)
+}
+
+func exportParquet(fnr string, fnw string) {
+	p := parquetCreate(fnw)
+	var nrecs int
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+fnr+"' is anonymous - export needs names")
+		}
+		p.add(shaBase64ToShaBinary(rec.shab64), rec.name, decodeHex(rec.size), decodeHex(rec.modtime))
+		nrecs++
+	})
+	p.close()
+	fmt.Printf("Exported %d records to %s\n", nrecs, fnw)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// ----------------------- External (disk-backed) sort -----------------------
+
+// Consolidating very large SSFs in a map needs memory for every SHA.  The external sort instead keeps
+// at most extSortChunk lines in memory: each full chunk is sorted and written to a temporary file, and
+// the files are then merged (the classic k-way merge) to produce the sorted result.
+
+var cli_lowmem bool = false // force the disk-backed path
+
+const extSortChunk = 1000000  // lines held in memory per chunk (roughly 100MB)
+const extSortThreshold = 1024 // input size (MB) above which the external sort is used automatically
+
+type extSorter struct {
+	chunk []string // current (unsorted) chunk
+	files []string // sorted chunk files written so far
+}
+
+// add a line, spilling the chunk to disk when it is full
+func (x *extSorter) add(line string) {
+	x.chunk = append(x.chunk, line)
+	if len(x.chunk) >= extSortChunk {
+		x.spill()
+	}
+}
+
+// sort the current chunk and write it to a temporary file
+func (x *extSorter) spill() {
+	if len(x.chunk) == 0 {
+		return
+	}
+	slices.Sort(x.chunk)
+	f, err := os.CreateTemp("", "shaman-sort-*")
+	if err != nil {
+		abort(4, "Cannot create temporary file for sorting")
+	}
+	w := bufio.NewWriterSize(f, 64*1024)
+	for _, line := range x.chunk {
+		fmt.Fprintln(w, line)
+	}
+	if err := w.Flush(); err != nil {
+		abort(4, "Cannot write temporary file for sorting (disk full?)")
+	}
+	f.Close()
+	slog.Debug("external sort spill", "file", f.Name(), "lines", len(x.chunk))
+	x.files = append(x.files, f.Name())
+	x.chunk = x.chunk[:0]
+}
+
+// merge the chunks in order, calling emit for each line (the temporary files are removed)
+func (x *extSorter) merge(emit func(string)) {
+	x.spill()
+	defer func() {
+		for _, fn := range x.files {
+			os.Remove(fn)
+		}
+	}()
+
+	h := &extSortHeap{}
+	for _, fn := range x.files {
+		f, err := os.Open(fn)
+		if err != nil {
+			abort(4, "Cannot re-open temporary file "+fn)
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 0, 64*1024), int(ssfMaxLine())+2)
+		if sc.Scan() {
+			heap.Push(h, extSortHead{sc.Text(), sc})
+		}
+	}
+	for h.Len() > 0 {
+		head := (*h)[0]
+		emit(head.line)
+		if head.sc.Scan() {
+			(*h)[0].line = head.sc.Text()
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
+
+// the next line from each chunk file, as a min-heap
+type extSortHead struct {
+	line string
+	sc   *bufio.Scanner
+}
+type extSortHeap []extSortHead
+
+func (h extSortHeap) Len() int           { return len(h) }
+func (h extSortHeap) Less(i, j int) bool { return h[i].line < h[j].line }
+func (h extSortHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *extSortHeap) Push(x any)        { *h = append(*h, x.(extSortHead)) }
+func (h *extSortHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// whether the input is big enough to need the disk-backed path
+func extSortWanted(fns ...string) bool {
+	if cli_lowmem {
+		return true
+	}
+	var total int64
+	for _, fn := range fns {
+		if st, err := os.Stat(fn); err == nil {
+			total += st.Size()
+		}
+	}
+	return total > extSortThreshold*1024*1024
+}
+
+// The external equivalent of ssfCollectRead followed by a sorted write: records are reduced to their
+// format-1/2/3 line, sorted on disk, and the first (i.e. earliest dated) line for each SHA is written.
+func ssfCollectSorted(fnr string, w *bufio.Writer, comments map[string][]string, format int) (int, int) {
+	var x extSorter
+	rows := ssfCollectEach(fnr, format, comments, func(shab64 string, val string) {
+		x.add(shab64 + val)
+	})
+
+	var shas int
+	var last string
+	x.merge(func(line string) {
+		if line[0:43] != last {
+			for _, c := range comments[line[0:43]] {
+				fmt.Fprintln(w, c)
+			}
+			fmt.Fprintln(w, line)
+			last = line[0:43]
+			shas++
+		}
+	})
+	return shas, rows
+}
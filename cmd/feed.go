@@ -0,0 +1,261 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ----------------------- Threat-intel hash feeds (import --feed) -----------------------
+
+// A hash feed is turned into a watchlist: a format 1 SSF of its SHA256s, sorted and de-duplicated, that
+// compare, lookup and the rest can check a tree's SSF against.  The feed can be a file or an http(s) URL
+// (so that a subscription can be re-fetched from cron), and is any of:
+//    a list of hashes, one per line (anything after the hash - a name, a comment - is ignored)
+//    a CSV or TSV with a heading - the SHA-256 column is found by its heading (sha256, SHA-256, ...) or,
+//    failing that, by holding 64-digit hex values
+//    STIX 2 JSON (a bundle, or a list of objects) - from indicator patterns [file:hashes.'SHA-256' = '...']
+//    and the hashes of file objects
+// Feed entries with only an MD5 or SHA-1 cannot be matched against an SSF, and are counted, not kept.
+
+var cli_feed bool = false // the input is a threat-intel hash feed
+
+// what was found in a feed
+type feedCount struct {
+	shas    map[string]bool // usable (SHA256) signatures
+	entries int             // SHA256s seen (including repeats)
+	weak    int             // entries with only an MD5 or SHA-1
+	bad     int             // lines (or values) not understood
+}
+
+var feedHex = regexp.MustCompile(`^[0-9A-Fa-f]+$`)
+
+// the STIX 2 pattern comparison of a file hash, e.g. file:hashes.'SHA-256' = 'abc...'
+var feedStixHash = regexp.MustCompile(`hashes\.'?"?([A-Za-z0-9-]+)'?"?\s*=\s*'([0-9A-Fa-f]+)'`)
+
+// a hash given in a feed - a SHA256 is kept, an MD5 or SHA-1 (32 or 40 hex digits) counted
+func (fc *feedCount) hash(v string) bool {
+	v = strings.TrimSpace(v)
+	if sha := shaDecode(v); sha != "" {
+		fc.shas[sha] = true
+		fc.entries++
+		return true
+	}
+	if (len(v) == 32 || len(v) == 40) && feedHex.MatchString(v) {
+		fc.weak++
+		return true
+	}
+	return false
+}
+
+// read the feed (a file, or a URL)
+func feedRead(fnr string) []byte {
+	if strings.HasPrefix(fnr, "http://") || strings.HasPrefix(fnr, "https://") {
+		client := &http.Client{Timeout: 5 * time.Minute}
+		resp, err := client.Get(fnr)
+		if err != nil {
+			abort(4, "Cannot fetch "+fnr+": "+err.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			abort(4, "Cannot fetch "+fnr+": "+resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			abort(4, "Cannot fetch "+fnr+": "+err.Error())
+		}
+		return data
+	}
+	data, err := os.ReadFile(fnr)
+	if err != nil {
+		abort(6, "Feed '"+fnr+"' does not exist")
+	}
+	return data
+}
+
+func importFeed(fnr string, fnw string) {
+	data := bytes.TrimPrefix(feedRead(fnr), []byte("\xef\xbb\xbf"))
+	fc := &feedCount{shas: map[string]bool{}}
+	var kind string
+	switch trimmed := bytes.TrimSpace(data); {
+	case len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['):
+		kind = "STIX"
+		var v any
+		if err := json.Unmarshal(trimmed, &v); err != nil {
+			abort(6, "Feed '"+fnr+"' is not valid JSON: "+err.Error())
+		}
+		feedStix(v, fc)
+	case feedIsList(data):
+		kind = "hash list"
+		feedList(data, fc)
+	default:
+		kind = "CSV"
+		feedCSV(fnr, data, fc)
+	}
+
+	var recs []ssfRecord
+	for sha := range fc.shas {
+		recs = append(recs, ssfRecord{format: 1, shab64: sha})
+	}
+	sortRecords(recs)
+	w := writeInit(fnw)
+	for _, rec := range recs {
+		fmt.Fprintln(w, ssfRecordLine(rec))
+	}
+	w.close()
+
+	fmt.Fprintf(os.Stderr, "Extracted %d SHA256 signatures from %s (%s)", len(recs), fnr, kind)
+	if fc.entries > len(recs) {
+		fmt.Fprintf(os.Stderr, ", %d repeats dropped", fc.entries-len(recs))
+	}
+	if fc.weak > 0 {
+		fmt.Fprintf(os.Stderr, ", %d MD5/SHA-1 only (not usable)", fc.weak)
+	}
+	if fc.bad > 0 {
+		fmt.Fprintf(os.Stderr, ", %d not understood", fc.bad)
+	}
+	fmt.Fprintln(os.Stderr)
+	if len(recs) == 0 {
+		abort(6, "No usable (SHA256) signatures in '"+fnr+"'")
+	}
+}
+
+// whether a feed is a plain list - each line (bar comments) starting with a hash on its own
+func feedIsList(data []byte) bool {
+	for _, s := range strings.Split(string(data), "\n") {
+		s = strings.TrimSpace(s)
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		first := strings.Fields(s)[0]
+		return !strings.ContainsAny(first, ",;\t") && (shaDecode(first) != "" || feedHex.MatchString(first))
+	}
+	return false
+}
+
+func feedList(data []byte, fc *feedCount) {
+	for _, s := range strings.Split(string(data), "\n") {
+		s = strings.TrimSpace(s)
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		if fields := strings.Fields(s); !fc.hash(fields[0]) {
+			fc.bad++
+		}
+	}
+}
+
+func feedCSV(fnr string, data []byte, fc *feedCount) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.Comment = '#'
+	if strings.HasSuffix(strings.ToLower(fnr), ".tsv") || bytes.Count(data, []byte("\t")) > bytes.Count(data, []byte(",")) {
+		cr.Comma = '\t'
+	}
+	rows, err := cr.ReadAll()
+	if err != nil || len(rows) == 0 {
+		abort(6, "Feed '"+fnr+"' is not a hash list, CSV or STIX")
+	}
+
+	// the SHA-256 column: by heading, else the first holding a SHA256 (as hex) in the first rows
+	col, weak := -1, []int{}
+	for x, h := range rows[0] {
+		switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(h)) {
+		case "sha256", "sha256hash", "hashsha256":
+			col = x
+		case "md5", "sha1", "md5hash", "sha1hash":
+			weak = append(weak, x)
+		}
+	}
+	body := rows[1:]
+	if col == -1 {
+		for _, row := range rows[0:min(len(rows), 10)] {
+			for x, v := range row {
+				if v = strings.TrimSpace(v); len(v) == 64 && feedHex.MatchString(v) && col == -1 {
+					col = x
+				}
+			}
+		}
+		if col == -1 {
+			abort(6, "Feed '"+fnr+"' has no SHA-256 column (by heading or content)")
+		}
+		if shaDecode(strings.TrimSpace(rows[0][min(col, len(rows[0])-1)])) != "" {
+			body = rows // (no heading)
+		}
+	}
+
+	for _, row := range body {
+		if col < len(row) && fc.hash(row[col]) {
+			continue
+		}
+		if col < len(row) && strings.TrimSpace(row[col]) != "" {
+			fc.bad++
+			continue
+		}
+		// (no SHA256 - count those with only a weaker hash)
+		for _, x := range weak {
+			if x < len(row) && strings.TrimSpace(row[x]) != "" {
+				fc.weak++
+				break
+			}
+		}
+	}
+}
+
+// walk STIX 2 JSON for file hashes - in indicator patterns, and the 'hashes' of file objects
+func feedStix(v any, fc *feedCount) {
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			feedStix(e, fc)
+		}
+	case map[string]any:
+		if p, ok := v["pattern"].(string); ok {
+			var strong, weak bool
+			for _, m := range feedStixHash.FindAllStringSubmatch(p, -1) {
+				if feedStixAlgo(m[1]) == "sha256" {
+					strong = fc.hash(m[2]) || strong
+				} else {
+					weak = true
+				}
+			}
+			if weak && !strong {
+				fc.weak++
+			}
+		}
+		if h, ok := v["hashes"].(map[string]any); ok {
+			var strong, weak bool
+			for algo, hv := range h {
+				if s, ok := hv.(string); ok && feedStixAlgo(algo) == "sha256" {
+					strong = fc.hash(s) || strong
+				} else {
+					weak = true
+				}
+			}
+			if weak && !strong {
+				fc.weak++
+			}
+		}
+		for k, e := range v {
+			if k != "hashes" {
+				feedStix(e, fc)
+			}
+		}
+	}
+}
+
+// a STIX hash algorithm name, normalised (SHA-256, SHA256, sha-256 -> sha256)
+func feedStixAlgo(algo string) string {
+	return strings.ReplaceAll(strings.ToLower(algo), "-", "")
+}
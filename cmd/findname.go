@@ -0,0 +1,129 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// findNameCmd represents the find-name command
+var findNameCmd = &cobra.Command{
+	Use:   "find-name pattern file.ssf...",
+	Short: "Search the names of records across many SSFs",
+	Long: `shaman find-name pattern file.ssf [file.ssf...] [-i] [--regex]
+A grep of the record names in SSFs, printing the SSF, size, modify time and name of each match:
+   shaman find-name 'invoice*2023*' *.ssf
+The pattern is a glob (* and ? match any characters, [...] a set) matched against the whole base name
+of each record - or against the whole name if the pattern contains a '/'.  With --regex, the pattern is
+a regular expression searched for anywhere in the name.  -i ignores case.
+The exit code is 1 if nothing matched.`,
+	Aliases: []string{"fn"},
+	Args:    cobra.MinimumNArgs(2),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		fnm(args)
+	},
+}
+
+var cli_ignorecase bool = false // case-insensitive name match
+var cli_regex bool = false      // pattern is a regular expression
+
+func init() {
+	rootCmd.AddCommand(findNameCmd)
+
+	findNameCmd.Flags().BoolVarP(&cli_ignorecase, "ignore-case", "i", false, "Ignore case when matching")
+	findNameCmd.Flags().BoolVarP(&cli_regex, "regex", "", false, "Pattern is a regular expression (searched for anywhere in the name)")
+}
+
+// ----------------------- Find-name function below this line -----------------------
+
+// a glob as a regular expression (* and ? do not stop at '/', as names are matched whole)
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for x := 0; x < len(glob); x++ {
+		switch c := glob[x]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			if end := strings.IndexByte(glob[x+1:], ']'); end > 0 {
+				set := glob[x+1 : x+1+end]
+				if set[0] == '!' {
+					set = "^" + set[1:]
+				}
+				b.WriteString("[" + strings.ReplaceAll(set, `\`, `\\`) + "]")
+				x += end + 1
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func fnm(args []string) {
+	pattern := args[0]
+	num, files, found := getSSFs(args[1:])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "SSF file '"+fn+"' does not exist")
+		}
+	}
+
+	expr := pattern
+	whole := cli_regex || strings.Contains(pattern, "/")
+	if !cli_regex {
+		expr = globToRegexp(pattern)
+	}
+	if cli_ignorecase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		abort(6, "Invalid pattern '"+pattern+"': "+err.Error())
+	}
+
+	var matches int
+	for _, fn := range files {
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			if rec.format < 4 {
+				return
+			}
+			name := rec.name
+			if !whole {
+				name = path.Base(strings.TrimSuffix(name, "/"))
+			}
+			if !re.MatchString(name) {
+				return
+			}
+			matches++
+			size, when := "-", "-"
+			if rec.size != "" {
+				size = sizeAsString(decodeHex(rec.size))
+			}
+			if rec.modtime != "" {
+				when = time.Unix(decodeHex(rec.modtime), 0).Format(time.DateTime)
+			}
+			fmt.Printf("%s  %15s  %19s  %s\n", fn, size, when, rec.name)
+		})
+	}
+	if matches == 0 {
+		abort(1, "No names match '"+pattern+"'")
+	}
+}
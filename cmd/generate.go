@@ -5,11 +5,14 @@ package cmd
 
 import (
 	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
-	"bufio"
 	"fmt"
 )
 
@@ -17,13 +20,48 @@ import (
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
-	Use:   "generate [file.ssf]",
+	Use:   "generate [dir] [file.ssf]",
 	Short: "Generate a sha-manager signature format (.ssf) file",
 	Long: `shaman generate
 Generate a sha-manager format (.ssf) file from specified directory (or current directory if none specified), 
-writing the output to a named file (or stdout if none given)`,
+writing the output to a named file (or stdout if none given).  The directory can be given with --path or
+as an argument:
+   shaman generate ~/photos photos.ssf
+With --device, a block device, disk image or stream ('-' for stdin) is hashed instead, giving a
+single-record SSF that 'shaman verify --device' can check later:
+   shaman generate sdcard.ssf --device /dev/sdb1
+The output order is the same on every filesystem: names sorted within each directory, with a directory's
+contents in its place.  Use --sort full for strict byte order of the whole name (e.g. for textual diffs
+against other tools' sorted output).
+With --max-files and/or --max-bytes, the run stops once the limit is reached, leaving a valid SSF that
+ends with a '# partial:' comment saying where it stopped (a sha256sum file, format 9, has no comments -
+the stop is only reported on stderr).
+With --quick head=N, files over N bytes are hashed on their first N bytes and size only (and annotated
+'quick=head:N'), for fast triage of large media; compare and duplicates fully hash any matching candidates.
+With --dirs and --links, directories and symbolic links get records too (a directory's name ends in '/',
+and a link's record is annotated with its target), so that verify and update can notice an empty directory
+being removed or a link being re-pointed.  With --specials, sockets, FIFOs and devices get typed records
+too (annotated 'type=fifo' etc, and a device's numbers), rather than being left out.
+With --encrypt-to, the SSF is encrypted as it is written (no plaintext copy touches the disk), to an age
+recipient (age1...) using the age tool, or otherwise to a PGP key using gpg.  Every command reads an
+encrypted SSF transparently when the key is available (age: the identity file in SHAMAN_AGE_IDENTITY).
+The directory the names are relative to - the current one, or the path if it is absolute (its names are
+then relative to it) - is recorded at the top of the SSF ('# root: ...'), so that verify, update, missing,
+touch, untracked and guard can find the files from anywhere.
+With --also file:format (repeatable), further outputs in other formats are written from the same walk:
+   shaman generate full.ssf --also anon.ssf:sha --also sums.txt:9
+With --check PORT, the progress (files and bytes done, rates, ETA and current file) is served as JSON at
+/progress, to watch a long run from elsewhere:  curl localhost:8080/progress
+With --progress, a status line shows the directory being read and the file being hashed (and for how
+long each), with the directories done - to tell a slow file from a hung mount.
+With --drop-known known.ssf, files whose SHA256 is in a reference set of known-good hashes (an SSF of a
+clean install, a list of hashes, or an NSRL RDS export with a SHA-256 column) are left out, so that the
+ubiquitous operating system and application files do not fill the manifest.
+If interrupted (Ctrl-C, or a SIGTERM), the records so far are written out and the SSF ends with a
+'# INCOMPLETE:' comment (not in a sha256sum file, format 9, which has no comments - it is said on stderr),
+and the exit code is 130 (SIGINT) or 143 (SIGTERM), so that a script can tell.`,
 	Aliases: []string{"gen"},
-	Args:    cobra.MaximumNArgs(1),
+	Args:    cobra.MaximumNArgs(2),
 	GroupID: "G1",
 	Run: func(cmd *cobra.Command, args []string) {
 		gen(args)
@@ -34,29 +72,104 @@ func init() {
 	rootCmd.AddCommand(generateCmd)
 
 	generateCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to scan (default is current directory)")
-	generateCmd.Flags().IntVarP(&cli_format, "format", "f", 0, "Format/anonymisation level 1..5 or 9")
+	generateCmd.Flags().StringVarP(&cli_format, "format", "f", "", "Format: sha, sha+time, sha+time+size, named, full or sha256sum (or 1..5, 9)")
 	generateCmd.Flags().BoolVarP(&cli_dupes, "dupes", "d", false, "Whether to show dupes (as comments) on completion")
 	generateCmd.Flags().BoolVarP(&cli_grand, "grand-totals", "g", false, "Display grand totals of bytes/files on completion")
 	generateCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "Give running commentary of update")
 	generateCmd.Flags().BoolVarP(&cli_nodot, "no-dot", "", false, "Do not include files/directories beginning '.'")
+	generateCmd.Flags().StringVarP(&cli_excludeext, "exclude-ext", "", "", "Leave out files with these extensions, e.g. iso,vmdk,qcow2")
+	generateCmd.Flags().StringVarP(&cli_onlyext, "only-ext", "", "", "Only include files with these extensions, e.g. jpg,heic,mov")
+	generateCmd.Flags().IntVarP(&cli_workers, "workers", "w", 1, "Number of files to hash in parallel (see 'shaman bench')")
+	generateCmd.Flags().StringVarP(&cli_annotate, "annotate", "a", "", "Add annotations to each record (e.g. 'media' for duration/codec/resolution, 'owner' for ownership/ACL)")
+	generateCmd.Flags().StringVarP(&cli_quick, "quick", "", "", "Partial hash of large files for fast triage, e.g. head=1M (annotated on the record)")
+	generateCmd.Flags().StringVarP(&cli_sort, "sort", "", "dir", "Output order: 'dir' (each directory in turn) or 'full' (strict byte order of name)")
+	generateCmd.Flags().Int64VarP(&cli_maxfiles, "max-files", "", 0, "Stop after this many files, writing a partial SSF")
+	generateCmd.Flags().StringVarP(&cli_maxbytes, "max-bytes", "", "", "Stop after this many bytes (e.g. 500G), writing a partial SSF")
+	generateCmd.Flags().StringVarP(&cli_device, "device", "", "", "Hash a block device or stream ('-' for stdin) as a single record")
+	generateCmd.Flags().BoolVarP(&cli_dirs, "dirs", "", false, "Record directories (name ending '/') as well as files")
+	generateCmd.Flags().BoolVarP(&cli_links, "links", "", false, "Record symbolic links (with their target) as well as files")
+	generateCmd.Flags().IntVarP(&cli_maxdepth, "max-depth", "", 0, "Levels of directory to go down (1 = the top only, default: all)")
+	generateCmd.Flags().BoolVarP(&cli_onefs, "one-file-system", "x", false, "Do not go into directories on other filesystems (mounts)")
+	generateCmd.Flags().BoolVarP(&cli_specials, "specials", "", false, "Record sockets, FIFOs and devices (by type) as well as files")
+	generateCmd.Flags().StringVarP(&cli_errors, "errors", "", "", "Unreadable files: skip, record (as '# error:' comments) or fail - with a count at the end, and rc 5")
+	generateCmd.Flags().StringVarP(&cli_chunks, "chunks", "", "", "Record the content-defined chunks of files this size or over, e.g. 1G (see 'shaman overlap')")
+	generateCmd.Flags().StringArrayVarP(&cli_also, "also", "", nil, "Also write another output, as file:format (e.g. anon.ssf:sha or sums.txt:9) - repeatable")
+	generateCmd.Flags().BoolVarP(&cli_stats, "stats", "", false, "Show throughput, elapsed time and the slowest files on completion")
+	generateCmd.Flags().StringVarP(&cli_encryptto, "encrypt-to", "", "", "Encrypt the output to an age recipient (age1...) or PGP key")
+	generateCmd.Flags().BoolVarP(&cli_progress, "progress", "", false, "Show the directory being read and file being hashed (on stderr)")
+	generateCmd.Flags().StringVarP(&cli_check, "check", "", "", "Serve progress as JSON on this port (e.g. 8080) at /progress")
+	generateCmd.Flags().StringVarP(&cli_dropknown, "drop-known", "", "", "Leave out files whose hash is in this set of known-good hashes (SSF, hash list or NSRL CSV)")
 }
 
 // ----------------------- Generate function below this line -----------------------
 
+var cli_sort string = "dir" // output order (dir or full)
+var cli_also []string       // further outputs from the same walk (file:format)
+
+// a further output (--also)
+type genOutput struct {
+	w    *writeSSF
+	form int
+}
+
+// open the --also outputs, which must not exist already
+func genAlsoOpen() []genOutput {
+	var outs []genOutput
+	for _, spec := range cli_also {
+		x := strings.LastIndex(spec, ":")
+		if x < 1 {
+			abort(6, "Invalid --also '"+spec+"' (expected file:format, e.g. anon.ssf:sha)")
+		}
+		fn, form := spec[:x], formatLookup(spec[x+1:], "--also", 1, 2, 3, 4, 5, 9)
+		if _, err := os.Stat(fn); err == nil {
+			abort(6, "Output file '"+fn+"' already exists")
+		}
+		outs = append(outs, genOutput{writeInit(fn), form})
+	}
+	return outs
+}
+
 // Rate: 167 files per sec (10k/min) for Desktop on MBP A2141
 
 func gen(args []string) {
-	var w *bufio.Writer
+	var w *writeSSF
 	var fn string = "" // Output file (for "" for stdout)
 	var ticker bool = true
-	var form int = 5 // format defaults to 5
+	var form int = formatParse(5, 1, 2, 3, 4, 5, 9) // format defaults to 5
+	annotateValidate()
+	opts := walkOptionsFromFlags()
+	errorsValidate()
+	quickValidate()
+	scanLimitsValidate()
+	knownLoad()
+	if cli_sort != "dir" && cli_sort != "full" {
+		abort(6, "Invalid --sort '"+cli_sort+"' (valid: dir, full)")
+	}
+	if quickHead > 0 && form != 5 {
+		abort(6, "--quick needs format 5 (the record must carry the 'quick' annotation)")
+	}
+	if cli_links && form != 5 {
+		abort(6, "--links needs format 5 (the record must carry the 'link' annotation)")
+	}
+	if cli_specials && form != 5 {
+		abort(6, "--specials needs format 5 (the record must carry the 'type' annotation)")
+	}
 
-	// for update, the format default is 5 (full)
-	if cli_format != 0 {
-		form = cli_format
+	// a directory given as an argument is the tree to scan (shaman gen ~/photos photos.ssf)
+	var ssfargs []string
+	for _, a := range args {
+		if st, err := os.Stat(a); err == nil && st.IsDir() {
+			if cli_path != "" {
+				abort(6, "Give the directory to scan once (as an argument or with --path)")
+			}
+			cli_path = a
+			continue
+		}
+		ssfargs = append(ssfargs, a)
 	}
+
 	// process CLI
-	num, files, found := getSSFs(args)
+	num, files, found := getSSFs(ssfargs)
 	slog.Debug("cli handler", "num", num, "files", files, "found", found)
 	switch true {
 	case num == 0:
@@ -74,27 +187,69 @@ func gen(args []string) {
 
 	// find ends .ssf??
 
+	if cli_device != "" && len(cli_also) > 0 {
+		abort(6, "--also is not available with --device")
+	}
+	also := genAlsoOpen()
+
 	// open writer (stdout or file)
 	w = writeInit(fn)
 
+	if cli_device != "" {
+		if cli_path != "" {
+			abort(6, "Give --path or --device, not both")
+		}
+		genDevice(w, form)
+		return
+	}
+
+	statsStart()
+
 	// Call the tree walker to generate a file list (as a channel)
 	var startpath string = "."
 	if cli_path != "" {
 		startpath = cli_path // add validation here
 	}
+	progressServe("generate", startpath, opts)
+
+	// record what the names are relative to (only with names - not in the anonymous formats, nor in a
+	// sha256sum file, which has no comments)
+	c := rootComment(startpath)
+	if form == 4 || form == 5 {
+		fmt.Fprintln(w, c)
+	}
+	for _, o := range also {
+		if o.form == 4 || o.form == 5 {
+			fmt.Fprintln(o.w, c)
+		}
+	}
+	startpath = rootWalkStart(startpath)
+	if opts.sortFull {
+		if form != 9 {
+			fmt.Fprintln(w, sortFullComment)
+		}
+		for _, o := range also {
+			if o.form != 9 {
+				fmt.Fprintln(o.w, sortFullComment)
+			}
+		}
+	}
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
+	// hash (in parallel if asked)
+	hashQueue := hashTriplexes(fileQueue, cli_workers)
+
 	var verbosity int = 1
 	if cli_verbose {
 		fmt.Println("Generating:")
 		verbosity = 2
 		ticker = false
 	} else {
-		if num == 1 {
+		if num == 1 && !cli_progress {
 			fmt.Print("Processing")
 			ticker = true
 		}
@@ -103,33 +258,112 @@ func gen(args []string) {
 	// process file list to generate SSF records
 	var total_files int64
 	var total_bytes int64
-	for filerec := range fileQueue {
-		// drop if files or directories begins "." and nodot asserted
-		if cli_nodot && (strings.Contains(filerec.filename, "/.") || filerec.filename[0:1] == ".") {
-			continue
+	var stopped string
+	var interrupted os.Signal
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	for {
+		var filerec hashedTriplex
+		var more bool
+		select {
+		case filerec, more = <-hashQueue:
+		case interrupted = <-stop:
+		}
+		if interrupted != nil || !more {
+			break
 		}
 
-		_, sha_b64 := getFileSha256(filerec.filename)
+		if scanLimitReached(total_files, total_bytes) {
+			// budget used up - mark the SSF as partial (it is still valid, just incomplete)
+			stopped = filerec.filename
+			if form != 9 {
+				fmt.Fprintln(w, scanPartialComment("generate", stopped))
+			}
+			for _, o := range also {
+				if o.form != 9 {
+					fmt.Fprintln(o.w, scanPartialComment("generate", stopped))
+				}
+			}
+			break
+		}
+		sha_b64 := filerec.shab64
+		if sha_b64 == "" {
+			continue // (unreadable - see fileError)
+		}
+		if knownDrop(sha_b64, filerec.size) {
+			continue
+		}
 
-		modt := fmt.Sprintf("%8x", filerec.modified)
-		size := fmt.Sprintf("%04x", filerec.size)
-		writeRecord(w, true, form, verbosity, "N", sha_b64, modt, size, filerec.filename, "")
+		modt := encodeModTime(filerec.modified)
+		size := encodeSize(filerec.size)
+		annot := annotationAdd(getAnnotations(filerec.filename), filerec.quick)
+		w.record(true, form, verbosity, "N", sha_b64, modt, size, annot, filerec.filename, "")
+		for _, o := range also {
+			o.w.record(true, o.form, 0, "N", sha_b64, modt, size, annot, filerec.filename, "")
+		}
 
 		// stats and ticks (dot every 100, flush every 500)
 		total_bytes += filerec.size
 		total_files++
 
+		progressNote(filerec.filename, filerec.size)
+
 		if ticker && total_files%100 == 0 {
 			fmt.Print(".")
 		}
 	}
-	w.Flush()
+	progressDone()
+	if form != 9 {
+		errorsRecord(w)
+	}
+	if interrupted != nil && form != 9 {
+		// (the records so far are good - but there should have been more)
+		fmt.Fprintln(w, genIncompleteComment(interrupted, total_files))
+	}
+	w.close()
+	for _, o := range also {
+		if o.form != 9 {
+			errorsRecord(o.w)
+		}
+		if interrupted != nil && o.form != 9 {
+			fmt.Fprintln(o.w, genIncompleteComment(interrupted, total_files))
+		}
+		o.w.close()
+	}
 
 	if ticker {
 		fmt.Println(".")
 	}
 	if cli_verbose {
-		fmt.Printf("Total: %s files, %s bytes\n", intAsStringWithCommas(total_files), intAsStringWithCommas(total_bytes))
+		fmt.Printf("Total: %s files, %s\n", intAsString(total_files), bytesAsString(total_bytes))
+	}
+	if stopped != "" {
+		fmt.Fprintf(os.Stderr, "Limit reached after %s files, %s - stopped before %s\n", intAsString(total_files), bytesAsString(total_bytes), stopped)
+	}
+	if fn == "" {
+		knownReport(os.Stderr)
+		statsReport(os.Stderr, cli_workers) // stdout is the SSF
+	} else {
+		knownReport(os.Stdout)
+		statsReport(os.Stdout, cli_workers)
+	}
+	if errorsReport() && interrupted == nil {
+		os.Exit(errorsExit)
+	}
+	if interrupted != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted after %s files, %s - the output is incomplete\n", intAsString(total_files), bytesAsString(total_bytes))
+		os.Exit(128 + int(interrupted.(syscall.Signal)))
 	}
+}
+
+// the comment ending an SSF whose generate was interrupted
+func genIncompleteComment(sig os.Signal, files int64) string {
+	return fmt.Sprintf("# INCOMPLETE: generate interrupted (%s) after %d files at %s", sig, files, time.Now().UTC().Format(time.RFC3339))
+}
 
+// hash a block device or stream as a single record, named after the device and timed at the capture
+func genDevice(w *writeSSF, form int) {
+	_, sha_b64, nbytes := getStreamSha256(cli_device)
+	w.record(true, form, 0, "N", sha_b64, encodeModTime(time.Now().Unix()), encodeSize(nbytes), "", cli_device, "")
+	w.close()
 }
@@ -0,0 +1,356 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// guardCmd represents the guard command
+var guardCmd = &cobra.Command{
+	Use:   "guard baseline.ssf",
+	Short: "Watch the files of a baseline SSF and alert on any change (integrity monitoring)",
+	Long: `shaman guard baseline.ssf [-p path] [--poll 10s] [--once] [-r] [--interval 6h] [--health :8080]
+Tripwire-style file integrity monitoring: every file in the baseline is watched, and an alert is given
+when one is modified (time, size or hash), deleted, or put back as it was:
+   2025-08-13 10:42:07  Chg: etc/passwd [Time][Hash]
+   2025-08-13 10:42:07  Del: etc/shadow
+   2025-08-13 10:43:17  OK:  etc/shadow (restored)
+The files are polled (stat'ed) every --poll interval, and re-hashed when their modify time or size
+change - so an unchanged file costs one stat per poll.  The first check also re-hashes every file if
+--re-hash is given (otherwise a file whose time and size match the baseline is taken as unchanged).
+The files are looked for from the root recorded in the baseline (see 'shaman generate'), or --root, or
+--path.
+With --interval, every file is also re-hashed on that schedule (or a random sample of them, with
+--re-hash-sample), catching a change that kept the time and size.  --health serves the result of the
+last check as JSON at /health (status 503 if anything differs from the baseline).
+--burst-alert raises a BURST alert when the rate of change passes a threshold - mass creation or
+encryption of files is a ransomware tell - given as events (files changing state) or bytes hashed (of
+files that moved) per second, minute or hour, e.g. --burst-alert 1000/min --burst-alert 5G/min.
+Alerts are also logged as warnings (see --log-file).  With --once, a single check is made and the exit
+code is 1 if anything differs from the baseline.
+On Windows, --install-service registers guard (with the baseline and flags given) as a service started
+at boot, and --remove-service takes it away again; as a service, alerts also go to the Application event
+log, and a change in the directory tree (ReadDirectoryChangesW) brings the next check forward rather than
+waiting for the poll.  --service-name names the service (default shaman-guard), for guarding more than one
+baseline.`,
+	Args:    cobra.RangeArgs(0, 1),
+	GroupID: "G1",
+	Run: func(cmd *cobra.Command, args []string) {
+		grd(args, cmd.Flags())
+	},
+}
+
+var cli_poll time.Duration = 10 * time.Second // how often guard looks at the files
+var cli_once bool = false                     // single check, then exit
+var cli_burst []string = nil                  // rate-of-change thresholds, e.g. 1000/min or 5G/min
+var cli_installsvc bool = false               // register guard as a (Windows) service
+var cli_removesvc bool = false                // unregister it
+var cli_service bool = false                  // running under the service control manager
+var cli_svcname string = "shaman-guard"       // the service's name
+
+func init() {
+	rootCmd.AddCommand(guardCmd)
+
+	guardCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	guardCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to, instead of the recorded root ('.' for the current directory)")
+	guardCmd.Flags().DurationVarP(&cli_poll, "poll", "", 10*time.Second, "How often to look for changes")
+	guardCmd.Flags().BoolVarP(&cli_once, "once", "", false, "Check once and exit (rc=1 if anything has changed)")
+	guardCmd.Flags().BoolVarP(&cli_rehash, "re-hash", "r", false, "Re-hash every file on the first check")
+	guardCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "Report each check")
+	guardCmd.Flags().DurationVarP(&cli_interval, "interval", "", 0, "Also re-hash the files this often, e.g. 6h")
+	guardCmd.Flags().StringVarP(&cli_sample, "re-hash-sample", "", "", "With --interval, re-hash a random percentage of the files, e.g. 5%")
+	guardCmd.Flags().Uint64VarP(&cli_seed, "seed", "", 0, "Random seed for --re-hash-sample (default: different each run)")
+	guardCmd.Flags().StringVarP(&cli_health, "health", "", "", "Serve the last check's result at /health on this address, e.g. :8080")
+	guardCmd.Flags().StringArrayVarP(&cli_burst, "burst-alert", "", nil, "Alert when events (e.g. 1000/min) or bytes hashed (e.g. 5G/min) pass this rate (repeatable)")
+	guardCmd.Flags().BoolVarP(&cli_installsvc, "install-service", "", false, "Register as a service started at boot, with the baseline and flags given (Windows)")
+	guardCmd.Flags().BoolVarP(&cli_removesvc, "remove-service", "", false, "Stop and unregister the service (Windows)")
+	guardCmd.Flags().StringVarP(&cli_svcname, "service-name", "", "shaman-guard", "Name of the service for --install-service and --remove-service")
+	guardCmd.Flags().BoolVarP(&cli_service, "service", "", false, "Run under the service control manager (as installed)")
+	guardCmd.Flags().MarkHidden("service")
+}
+
+// ----------------------- Guard function below this line -----------------------
+
+// a baseline file and what was last seen of it
+type guardFile struct {
+	rec   ssfRecord
+	fn    string // on disk
+	modt  string // last seen modify time ("" if not yet seen)
+	size  string // last seen size
+	state string // "" (as baseline), "Chg" or "Del"
+}
+
+func grd(args []string, flags *pflag.FlagSet) {
+	switch {
+	case cli_removesvc && (len(args) > 0 || cli_installsvc):
+		abort(6, "--remove-service takes no baseline, and cannot be used with --install-service")
+	case cli_removesvc:
+		guardServiceRemove()
+		return
+	case len(args) == 0:
+		abort(6, "A baseline SSF file is needed")
+	case (cli_installsvc || cli_service) && cli_once:
+		abort(6, "--once cannot be used with --install-service")
+	}
+
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case !found[0]:
+		abort(6, "Baseline SSF file '"+files[0]+"' does not exist")
+	case cli_poll < time.Second:
+		abort(6, "--poll must be at least 1s")
+	case cli_interval != 0 && cli_interval < cli_poll:
+		abort(6, "--interval must be longer than --poll")
+	case cli_once && (cli_interval != 0 || cli_health != "" || cli_burst != nil):
+		abort(6, "--once cannot be used with --interval, --health or --burst-alert")
+	}
+	limits := guardBurstLimits(cli_burst)
+
+	startpath := rootStart(files[0])
+
+	var guarded []*guardFile
+	ssfForEachRecord(files[0], func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+files[0]+"' has no names (anonymous format) - nothing to guard")
+		}
+		guarded = append(guarded, &guardFile{rec: rec, fn: rootJoin(startpath, rec.name)})
+	})
+	if len(guarded) == 0 {
+		abort(6, "SSF '"+files[0]+"' has no records to guard")
+	}
+
+	if cli_installsvc {
+		guardServiceInstall(files[0], startpath, flags)
+		return
+	}
+
+	guardRun(func() {
+		scheduleHealth()
+		kind := "poll"
+		if cli_rehash {
+			kind = "full"
+		}
+		changed, missing := guardCheck(guarded, kind, func() bool { return cli_rehash })
+		if cli_once {
+			fmt.Printf("Checked %s files, %d differ from the baseline\n", intAsString(int64(len(guarded))), changed+missing)
+			if changed+missing > 0 {
+				abort(1, "")
+			}
+			return
+		}
+
+		fmt.Printf("Guarding %s files (polling every %s, ^C to stop)\n", intAsString(int64(len(guarded))), cli_poll)
+		poll := time.NewTicker(cli_poll)
+		var scheduled <-chan time.Time // (nil - never - without --interval)
+		kind, sample := scheduleSampler()
+		if cli_interval > 0 {
+			scheduled = time.NewTicker(cli_interval).C
+			fmt.Printf("Re-hashing (%s) every %s\n", kind, cli_interval)
+		}
+		changes := guardWatch(startpath) // (nil - never - where the tree cannot be watched)
+		never := func() bool { return false }
+		guardEvents.Store(0) // (the first check is against the baseline, not a rate)
+		guardHashed.Store(0)
+		for {
+			select {
+			case <-poll.C:
+				guardCheck(guarded, "poll", never)
+			case <-changes:
+				guardCheck(guarded, "poll", never)
+			case <-scheduled:
+				guardCheck(guarded, kind, sample)
+			}
+			guardBurst(limits)
+		}
+	})
+}
+
+// look at every guarded file (re-hashing those chosen by rehash), reporting those whose state has changed -
+// returns how many differ from the baseline
+func guardCheck(guarded []*guardFile, kind string, rehash func() bool) (changed int, missing int) {
+	for _, g := range guarded {
+		state, detail := guardLook(g, rehash())
+		if state != g.state || (state == "Chg" && detail != "") {
+			guardEvents.Add(1)
+			switch state {
+			case "":
+				guardAlert("OK: ", g.rec.name, " (restored)")
+			default:
+				guardAlert(state+":", g.rec.name, detail)
+			}
+			g.state = state
+		}
+		switch g.state {
+		case "Chg":
+			changed++
+		case "Del":
+			missing++
+		}
+	}
+	scheduleRecord(kind, len(guarded), changed, missing)
+	if cli_verbose || (kind != "poll" && !cli_once) {
+		fmt.Printf("%s  checked %d files (%s), %d differ\n", time.Now().Format(time.DateTime), len(guarded), kind, changed+missing)
+	}
+	return changed, missing
+}
+
+// the state of a file ("", "Chg" or "Del") - only re-hashed if its time or size have moved since last seen
+// (the detail of a change is only given when it has just been seen, so that a further change is reported)
+func guardLook(g *guardFile, rehash bool) (state string, detail string) {
+	if entryIsSpecial(g.rec) {
+		switch verEntry(g.rec, g.fn) {
+		case "Mis":
+			return "Del", ""
+		case "Chg":
+			return "Chg", ""
+		}
+		return "", ""
+	}
+
+	st, err := os.Stat(g.fn)
+	if err != nil || !st.Mode().IsRegular() {
+		g.modt, g.size = "", ""
+		return "Del", ""
+	}
+	modt, size := encodeModTime(st.ModTime().Unix()), encodeSize(st.Size())
+	moved := modt != g.modt || size != g.size
+	if !moved && !rehash {
+		return g.state, "" // nothing has moved since last look
+	}
+	g.modt, g.size = modt, size
+
+	var flags []string
+	if modt != g.rec.modtime {
+		flags = append(flags, "[Time]")
+	}
+	if size != g.rec.size {
+		flags = append(flags, "[Size]")
+	}
+	if len(flags) > 0 || rehash || g.state != "" {
+		if _, sha := getFileSha256(g.fn); sha != g.rec.shab64 {
+			flags = append(flags, "[Hash]")
+		}
+		if moved {
+			guardHashed.Add(st.Size())
+		}
+	}
+	if len(flags) == 0 {
+		return "", ""
+	}
+	if !moved && g.state == "Chg" {
+		return "Chg", "" // (already reported)
+	}
+	return "Chg", " " + strings.Join(flags, "")
+}
+
+func guardAlert(tag string, name string, detail string) {
+	fmt.Printf("%s  %s %s%s\n", time.Now().Format(time.DateTime), tag, name, detail)
+	slog.Warn("guard", "event", strings.TrimSpace(strings.TrimSuffix(tag, ":")), "name", name, "detail", strings.TrimSpace(detail))
+	guardEventLog(tag, name+detail)
+}
+
+// ----------------------- Burst alert (--burst-alert)
+
+// A single changed file is an alert; thousands of them a minute is something else - mass creation or
+// encryption of files, as ransomware does, shows first as a rate.  Each check adds the events it raised
+// (files changing state) and the bytes it hashed (of files that had moved - not those re-hashed on
+// schedule) to a window of the last minute (or poll, if longer), and a BURST alert is raised when the rate
+// passes a threshold - once, until it drops back under it.  The rates are also served at /health.
+
+type guardLimit struct {
+	spec     string  // as given, e.g. 1000/min
+	bytes    bool    // a rate of bytes hashed (rather than of events)
+	perMin   float64 // the threshold per minute
+	bursting bool    // over it, and alerted
+}
+
+// a check's worth of activity
+type guardTick struct {
+	at     time.Time
+	events int64
+	bytes  int64
+}
+
+var guardEvents, guardHashed atomic.Int64 // since the last tick
+var guardTicks []guardTick                // within the window
+
+// the thresholds given (checking them) - a count or a size, per s, min or h
+func guardBurstLimits(specs []string) []*guardLimit {
+	var limits []*guardLimit
+	for _, spec := range specs {
+		n, per, _ := strings.Cut(strings.ToLower(spec), "/")
+		l := &guardLimit{spec: spec}
+		switch per {
+		case "s", "sec":
+			l.perMin = 60
+		case "m", "min":
+			l.perMin = 1
+		case "h", "hour":
+			l.perMin = 1.0 / 60
+		default:
+			abort(6, "Invalid --burst-alert '"+spec+"' (expected e.g. 1000/min or 5G/min)")
+		}
+		if c, err := strconv.ParseInt(n, 10, 64); err == nil && c > 0 {
+			l.perMin *= float64(c)
+		} else if b, ok := parseByteSize(n); ok {
+			l.perMin *= float64(b)
+			l.bytes = true
+		} else {
+			abort(6, "Invalid --burst-alert '"+spec+"' (expected e.g. 1000/min or 5G/min)")
+		}
+		limits = append(limits, l)
+	}
+	return limits
+}
+
+// add the last check's activity to the window, and alert on any threshold crossed
+func guardBurst(limits []*guardLimit) {
+	now := time.Now()
+	guardTicks = append(guardTicks, guardTick{now, guardEvents.Swap(0), guardHashed.Swap(0)})
+	window := max(time.Minute, cli_poll)
+	for len(guardTicks) > 0 && now.Sub(guardTicks[0].at) >= window {
+		guardTicks = guardTicks[1:]
+	}
+	var events, bytes int64
+	for _, t := range guardTicks {
+		events += t.events
+		bytes += t.bytes
+	}
+	scale := float64(time.Minute) / float64(window)
+	eventsPerMin, bytesPerMin := int64(float64(events)*scale), int64(float64(bytes)*scale)
+	scheduleRates(eventsPerMin, bytesPerMin)
+
+	var bursts []string
+	for _, l := range limits {
+		what, rate, show := "events", eventsPerMin, intAsString(eventsPerMin)
+		if l.bytes {
+			what, rate, show = "hashed", bytesPerMin, bytesAsString(bytesPerMin)
+		}
+		over := float64(rate) > l.perMin
+		switch {
+		case over && !l.bursting:
+			guardAlert("BURST:", what, " "+show+"/min (over "+l.spec+" - mass file change?)")
+		case !over && l.bursting:
+			guardAlert("OK: ", what, " "+show+"/min (burst over)")
+		}
+		l.bursting = over
+		if over {
+			bursts = append(bursts, what+" over "+l.spec)
+		}
+	}
+	scheduleBurst(strings.Join(bursts, ", "))
+}
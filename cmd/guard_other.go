@@ -0,0 +1,33 @@
+//go:build !windows
+
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import "github.com/spf13/pflag"
+
+// ----------------------- Guard as a service for other systems (not available - use systemd, launchd, ...)
+
+func guardServiceInstall(baseline string, startpath string, flags *pflag.FlagSet) {
+	abort(6, "--install-service is only available on Windows (elsewhere, run guard from systemd, launchd or similar)")
+}
+
+func guardServiceRemove() {
+	abort(6, "--remove-service is only available on Windows")
+}
+
+// run guard's checks (in the foreground)
+func guardRun(checks func()) {
+	if cli_service {
+		abort(6, "--service is only available on Windows")
+	}
+	checks()
+}
+
+func guardEventLog(tag string, msg string) {}
+
+// (changes to the tree are found by polling)
+func guardWatch(dir string) <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,200 @@
+//go:build windows
+
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// ----------------------- Guard as a Windows service (--install-service)
+
+// guard --install-service registers a service whose command line is this guard, with the baseline and
+// flags given (paths made absolute - a service starts in System32), and the hidden --service flag.  Run
+// by the service control manager, guard's checks go on while it reports itself running, and stop when it
+// is told to; alerts also go to the Application event log (the source is registered with EventCreate's
+// messages, so that the text shows as given), and a ReadDirectoryChangesW watch on the tree brings a check
+// forward when anything in it changes.
+
+// the event source (nil if not a service)
+var guardElog *eventlog.Log
+
+func svcManager() *mgr.Mgr {
+	m, err := mgr.Connect()
+	if err != nil {
+		abort(4, "Cannot open the service control manager (run as Administrator): "+err.Error())
+	}
+	return m
+}
+
+func guardServiceInstall(baseline string, startpath string, flags *pflag.FlagSet) {
+	exe, err := os.Executable()
+	if err != nil {
+		abort(4, "Cannot find this program's path: "+err.Error())
+	}
+	abs := func(fn string) string {
+		a, err := filepath.Abs(fn)
+		if err != nil {
+			abort(6, "Cannot make '"+fn+"' absolute: "+err.Error())
+		}
+		return a
+	}
+	args := []string{"guard", abs(baseline), "--service", "--service-name", cli_svcname, "--path", abs(startpath)}
+	flags.Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "install-service", "service", "service-name", "path", "root": // (the path resolved)
+			return
+		case "log-file":
+			args = append(args, "--log-file", abs(f.Value.String()))
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+
+	m := svcManager()
+	defer m.Disconnect()
+	s, err := m.CreateService(cli_svcname, exe, mgr.Config{
+		DisplayName: "shaman guard (" + cli_svcname + ")",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		abort(4, "Cannot install service '"+cli_svcname+"': "+err.Error())
+	}
+	defer s.Close()
+
+	// the event source - with EventCreate's messages, which show an event's text as given
+	if err := eventlog.InstallAsEventCreate(cli_svcname, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot register the event source (alerts will show without their text): %s\n", err)
+	}
+
+	cmdline := []string{syscall.EscapeArg(exe)}
+	for _, a := range args {
+		cmdline = append(cmdline, syscall.EscapeArg(a))
+	}
+	fmt.Printf("Installed service %s: %s\n", cli_svcname, strings.Join(cmdline, " "))
+	if err := s.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Service %s not started (it starts at boot): %s\n", cli_svcname, err)
+		return
+	}
+	fmt.Printf("Started service %s\n", cli_svcname)
+}
+
+func guardServiceRemove() {
+	m := svcManager()
+	defer m.Disconnect()
+	s, err := m.OpenService(cli_svcname)
+	if err != nil {
+		abort(6, "Cannot open service '"+cli_svcname+"': "+err.Error())
+	}
+	defer s.Close()
+
+	s.Control(svc.Stop) // (it may not be running)
+	if err := s.Delete(); err != nil {
+		abort(4, "Cannot remove service '"+cli_svcname+"': "+err.Error())
+	}
+	eventlog.Remove(cli_svcname)
+	fmt.Printf("Removed service %s\n", cli_svcname)
+}
+
+// run guard's checks - in the foreground, or (with --service) under the service control manager
+func guardRun(checks func()) {
+	if !cli_service {
+		checks()
+		return
+	}
+	if err := svc.Run(cli_svcname, guardService{checks}); err != nil {
+		abort(4, "Cannot run as a service (--service is for the service control manager): "+err.Error())
+	}
+}
+
+// the service - report running, check until told to stop
+type guardService struct {
+	checks func() // guard's checks (which do not return)
+}
+
+func (g guardService) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	if elog, err := eventlog.Open(cli_svcname); err == nil {
+		guardElog = elog
+		defer elog.Close()
+	}
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	go g.checks()
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			s <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			s <- svc.Status{State: svc.StopPending, WaitHint: 5000}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// an alert, to the event log (when a service)
+func guardEventLog(tag string, msg string) {
+	if guardElog == nil {
+		return
+	}
+	text := strings.TrimSpace(tag) + " " + msg
+	if strings.HasPrefix(tag, "OK") {
+		guardElog.Info(1, text)
+	} else {
+		guardElog.Warning(1, text)
+	}
+}
+
+// a signal for each change in the tree under dir (at most one a second) - nil if it cannot be watched
+func guardWatch(dir string) <-chan struct{} {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		abort(6, "Invalid path '"+dir+"'")
+	}
+	h, err := windows.CreateFile(p, windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		slog.Warn("guard", "watch", dir, "error", err.Error(), "detail", "polling only")
+		return nil
+	}
+	const mask = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME |
+		windows.FILE_NOTIFY_CHANGE_ATTRIBUTES | windows.FILE_NOTIFY_CHANGE_SIZE | windows.FILE_NOTIFY_CHANGE_LAST_WRITE
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer windows.CloseHandle(h)
+		buf := make([]byte, 64*1024)
+		for {
+			var n uint32
+			if err := windows.ReadDirectoryChanges(h, &buf[0], uint32(len(buf)), true, mask, &n, nil, 0); err != nil {
+				slog.Warn("guard", "watch", dir, "error", err.Error(), "detail", "polling only")
+				return
+			}
+			select {
+			case changes <- struct{}{}:
+			default: // (a check is already due)
+			}
+			time.Sleep(time.Second) // (changes meanwhile are kept by the handle, and come with the next read)
+		}
+	}()
+	return changes
+}
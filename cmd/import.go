@@ -0,0 +1,231 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import data.csv [out.ssf] | --feed feed [out.ssf]",
+	Short: "Convert a CSV/TSV inventory into an SSF",
+	Long: `shaman import data.csv [out.ssf] --map sha=2,name=5,size=3,mtime=4
+Converts a spreadsheet-managed inventory into SSF records, so it can be used with the rest of the tools.
+--map gives the (1-based) column of each field; only sha is required:
+   sha     SHA256 as 64 hex digits, base64, base64url or base32 (detected per value)
+   name    file name (gives a format 4 SSF - needs size and mtime as well)
+   size    size in bytes (decimal)
+   mtime   modify time as epoch seconds, 0x-prefixed hex, or a date such as 2025-08-13 09:30:00
+Files ending .tsv are read as tab-separated.  A header line is skipped automatically, and other lines
+that cannot be converted are reported.  The output is sorted, and goes to stdout if no out.ssf is given.
+
+shaman import --feed feed [out.ssf]
+Turns a threat-intel hash feed (a file, or an http(s) URL to fetch) into a watchlist - a format 1 SSF
+of its SHA256s, sorted and de-duplicated - to check other SSFs against with compare or lookup:
+   shaman import --feed https://example.org/iocs/sha256.txt watch.ssf
+   shaman compare watch.ssf home.ssf
+The feed can be a list of hashes (one per line), a CSV/TSV (the SHA-256 column is chosen automatically,
+by its heading or its contents) or STIX 2 JSON (indicator patterns and file objects' hashes).  How many
+usable signatures were extracted is reported, with those given only as MD5 or SHA-1 (which cannot be
+matched) counted separately.`,
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		imp(args)
+	},
+}
+
+var cli_map string = "" // column mapping for import
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&cli_map, "map", "m", "", "Column mapping, e.g. sha=2,name=5,size=3,mtime=4")
+	importCmd.Flags().BoolVarP(&cli_feed, "feed", "", false, "The input is a hash feed (list, CSV or STIX, file or URL) - make a watchlist of its SHA256s")
+}
+
+// ----------------------- Import function below this line -----------------------
+
+// decode a SHA256 given as hex, base64 (standard or URL-safe) or base32 into the SSF's 43-character
+// base64 (or "" if it is none of them)
+func importSha(v string) string {
+	return shaDecode(strings.TrimSpace(v))
+}
+
+// decode a modify time (epoch seconds, 0x hex or a date/time) into epoch seconds
+func importTime(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "0x") {
+		n, err := strconv.ParseInt(v[2:], 16, 64)
+		return n, err == nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, true
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t.Unix(), true
+		}
+	}
+	return 0, false
+}
+
+// parse --map into field -> 0-based column
+func importMap(spec string) map[string]int {
+	cols := map[string]int{}
+	for _, kv := range strings.Split(spec, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			abort(6, "Invalid column in --map: '"+kv+"'")
+		}
+		switch k {
+		case "sha", "name", "size", "mtime":
+			cols[k] = n - 1
+		default:
+			abort(6, "Unknown field in --map: '"+k+"' (valid: sha, name, size, mtime)")
+		}
+	}
+	return cols
+}
+
+func imp(args []string) {
+	fnr := args[0]
+	fnw := ""
+	if len(args) == 2 {
+		num, files, found := getSSFs(args[1:])
+		slog.Debug("cli handler", "num", num, "files", files, "found", found)
+		if found[0] {
+			abort(6, "Output file '"+files[0]+"' already exists")
+		}
+		fnw = files[0]
+	}
+
+	switch {
+	case cli_feed && cli_map != "":
+		abort(6, "Give --map or --feed, not both")
+	case cli_feed:
+		importFeed(fnr, fnw)
+		return
+	case cli_map == "":
+		abort(6, "--map is needed (or --feed for a hash feed)")
+	}
+
+	// what can we make?
+	cols := importMap(cli_map)
+	_, hasSha := cols["sha"]
+	_, hasName := cols["name"]
+	_, hasSize := cols["size"]
+	_, hasTime := cols["mtime"]
+	var form int
+	switch {
+	case !hasSha:
+		abort(6, "--map must give the sha column")
+	case hasName && (!hasSize || !hasTime):
+		abort(6, "A named SSF (format 4) needs size and mtime columns too")
+	case hasName:
+		form = 4
+	case hasSize && !hasTime:
+		abort(6, "A size column needs an mtime column too (format 3)")
+	case hasSize:
+		form = 3
+	case hasTime:
+		form = 2
+	default:
+		form = 1
+	}
+
+	r, err := os.Open(fnr)
+	if err != nil {
+		abort(4, "Can't open "+fnr+" - stuck!")
+	}
+	defer r.Close()
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	if strings.HasSuffix(strings.ToLower(fnr), ".tsv") {
+		cr.Comma = '\t'
+	}
+
+	var recs []ssfRecord
+	var lineno, bad int
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		lineno++
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Line %d: %v\n", lineno, err)
+			bad++
+			continue
+		}
+
+		get := func(field string) string {
+			x, ok := cols[field]
+			if !ok || x >= len(row) {
+				return ""
+			}
+			return row[x]
+		}
+		rec := ssfRecord{format: form, shab64: importSha(get("sha"))}
+		problem := ""
+		if rec.shab64 == "" {
+			problem = "sha is not 64 hex digits, base64 or base32"
+		}
+		if hasTime {
+			if secs, ok := importTime(get("mtime")); ok {
+				rec.modtime = encodeModTime(secs)
+			} else {
+				problem = "mtime not understood"
+			}
+		}
+		if hasSize {
+			if n, err := strconv.ParseInt(strings.ReplaceAll(strings.TrimSpace(get("size")), ",", ""), 10, 64); err == nil && n >= 0 {
+				rec.size = encodeSize(n)
+			} else {
+				problem = "size not understood"
+			}
+		}
+		if hasName {
+			rec.name = escapeName(get("name"))
+			if rec.name == "" {
+				problem = "no name"
+			}
+		}
+		if problem != "" {
+			if lineno > 1 {
+				// (a bad first line is taken to be the header)
+				fmt.Fprintf(os.Stderr, "Line %d: %s - skipped\n", lineno, problem)
+				bad++
+			}
+			continue
+		}
+		recs = append(recs, rec)
+	}
+
+	sortRecords(recs)
+	w := writeInit(fnw)
+	if hasName {
+		fmt.Fprintln(w, sortFullComment) // (byte order, not walk order - see sortRecords)
+	}
+	for _, rec := range recs {
+		fmt.Fprintln(w, ssfRecordLine(rec))
+	}
+	w.close()
+
+	fmt.Fprintf(os.Stderr, "Imported %d records (format %d), %d lines skipped\n", len(recs), form, bad)
+}
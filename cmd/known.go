@@ -0,0 +1,119 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ----------------------- Known files (--drop-known) -----------------------
+
+// Most of a system disk is the operating system and applications - the same files on every machine, and
+// of no interest in a manifest, a duplicates report or a scan for what is new.  --drop-known leaves out
+// any file whose SHA256 is in a reference set of known-good hashes, which can be:
+//    an SSF (of any format) or a sha256sum file, e.g. one made of a clean install
+//    a list of hashes, one per line (hex, base64 or base32)
+//    a CSV with a SHA-256 column (found by its heading) - e.g. an NSRL RDS, or the sha256 column of
+//    its FILE table, exported from the RDS database
+// (The older NSRL RDS, with only SHA-1 and MD5, cannot be used - the files' SHA256 is needed.)
+
+var cli_dropknown string = ""      // reference set of known-good hashes
+var knownSHAs map[string]bool      // its SHAs (nil without --drop-known)
+var knownDropped, knownBytes int64 // files left out, and their size
+
+// load the --drop-known set (if given)
+func knownLoad() {
+	if cli_dropknown == "" {
+		return
+	}
+	r, err := ssfOpen(cli_dropknown)
+	if err != nil {
+		abort(6, "Known hashes file '"+cli_dropknown+"' does not exist")
+	}
+	defer r.Close()
+
+	knownSHAs = map[string]bool{}
+	shaCol := -1 // the SHA-256 column of a CSV (-1 if the file is not one)
+	var lineno, bad int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			continue
+		}
+		if shaCol >= 0 {
+			fields, err := csv.NewReader(strings.NewReader(s)).Read()
+			if err == nil && shaCol < len(fields) {
+				if sha := shaDecode(strings.TrimSpace(fields[shaCol])); sha != "" {
+					knownSHAs[sha] = true
+					continue
+				}
+			}
+			bad++
+			continue
+		}
+		// (a bare hash first - 64 hex digits would otherwise pass for a format 3 record)
+		if sha := shaDecode(strings.TrimSpace(s)); sha != "" {
+			knownSHAs[sha] = true
+		} else if rec, ok := parseSSFRecord(s); ok {
+			knownSHAs[rec.shab64] = true
+		} else if rec, ok := parseSha256sumLine(s); ok {
+			knownSHAs[rec.shab64] = true
+		} else if lineno == 1 || len(knownSHAs) == 0 {
+			shaCol = knownHeading(s)
+		} else {
+			bad++
+		}
+	}
+	if len(knownSHAs) == 0 {
+		abort(6, "No SHA256 hashes found in '"+cli_dropknown+"' (an SSF, sha256sum file, list of hashes or CSV with a SHA-256 column is needed)")
+	}
+	if bad > 0 {
+		fmt.Fprintf(os.Stderr, "Ignored %d lines of %s without a SHA256\n", bad, cli_dropknown)
+	}
+}
+
+// the column of a CSV heading that holds the SHA-256 (aborting if there is none)
+func knownHeading(s string) int {
+	fields, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		abort(6, "Cannot read '"+cli_dropknown+"' - not an SSF, list of hashes or CSV")
+	}
+	var sha1 bool
+	for x, f := range fields {
+		switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(f)) {
+		case "sha256":
+			return x
+		case "sha1":
+			sha1 = true
+		}
+	}
+	if sha1 {
+		abort(6, "'"+cli_dropknown+"' has SHA-1 hashes but no SHA-256 column (an older NSRL RDS?) - SHA256 is needed")
+	}
+	abort(6, "'"+cli_dropknown+"' has no SHA-256 column (expected a heading such as SHA-256 or sha256)")
+	return -1
+}
+
+// whether a file is in the known set - counting it as dropped if so
+func knownDrop(sha string, size int64) bool {
+	if !knownSHAs[sha] {
+		return false
+	}
+	knownDropped++
+	knownBytes += size
+	return true
+}
+
+// report what was left out (if anything)
+func knownReport(out io.Writer) {
+	if knownDropped > 0 {
+		fmt.Fprintf(out, "Left out %s known files (%s) listed in %s\n", intAsString(knownDropped), bytesAsString(knownBytes), cli_dropknown)
+	}
+}
@@ -4,20 +4,28 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"log/slog"
-	"os"
-	"strings"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 // latestCmd represents the latest command
 var latestCmd = &cobra.Command{
-	Use:     "latest",
-	Short:   "Show the names of the latest files",
-	Long:    `Finds the top-50 latest files in an .ssf file`,
+	Use:   "latest",
+	Short: "Show the names of the latest files",
+	Long: `Finds the top-50 latest files in an .ssf file
+Given several SSFs (up to eight), finds the latest across all of them, each name prefixed with the file
+it came from:
+   shaman latest backup1.ssf backup2.ssf backup3.ssf
+--reverse lists the oldest first instead, and --after/--before only consider files modified in a window
+- a date (2020-01-31, or with a time as 2020-01-31T12:00:00), or an age such as 90d, 6m or 5y ago:
+   shaman latest archive.ssf --reverse --before 5y      # what has not been touched in five years
+Times are shown as ISO 8601 in local time, or in UTC with --utc (the same on every machine), or with
+--relative as how long ago ('3 days ago').`,
 	Aliases: []string{"lat"},
 	Args:    cobra.MaximumNArgs(10), // handle in code
 	GroupID: "G2",
@@ -31,44 +39,66 @@ func init() {
 	rootCmd.AddCommand(latestCmd)
 
 	latestCmd.Flags().IntVarP(&cli_count, "count", "c", 20, "Specify number of files to show (default: 20)")
-	latestCmd.Flags().StringVarP(&cli_discard, "discard", "", "", "Path to exclude from results")
+	latestCmd.Flags().StringArrayVarP(&cli_discard, "discard", "", nil, "Path prefix to exclude from results (repeatable)")
 	latestCmd.Flags().BoolVarP(&cli_ellipsis, "ellipsis", "e", false, "Replace repeated time with '...'")
 	latestCmd.Flags().BoolVarP(&cli_nodot, "no-dot", "", false, "Do not include files/directories beginning '.'")
+	latestCmd.Flags().BoolVarP(&cli_reverse, "reverse", "r", false, "Show the oldest files first")
+	latestCmd.Flags().StringVarP(&cli_after, "after", "", "", "Only files modified after this date or age (e.g. 2020-01-31, 90d, 5y)")
+	latestCmd.Flags().StringVarP(&cli_before, "before", "", "", "Only files modified before this date or age (e.g. 2020-01-31, 90d, 5y)")
+	latestCmd.Flags().BoolVarP(&cli_relative, "relative", "", false, "Show times as how long ago ('3 days ago')")
+	latestCmd.Flags().BoolVarP(&cli_utc, "utc", "", false, "Show times in UTC rather than local time")
 }
 
+var cli_reverse bool = false  // oldest first
+var cli_after string = ""     // only files modified after this
+var cli_before string = ""    // only files modified before this
+var cli_relative bool = false // times as ages
+var cli_utc bool = false      // times in UTC
+
 // ----------------------- "Latest" function below this line -----------------------
 
-func lat(args []string) {
-	// Make sure we have a single input file that exists / error appropriately
-	num, files, found := getSSFs(args)
-	slog.Debug("cli handler", "num", num, "files", files, "found", found)
-	switch true {
-	case num > 8:
-		abort(8, "Too many .ssf files specified - eight is enough")
-	case num < 1:
-		abort(9, "Need an SSF file to perform largest file check")
-	case !found[0]:
-		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+// a --after/--before value as a Unix time: a date (local time), or an age in days, weeks, months or years
+func latDate(opt string, v string) int64 {
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t.Unix()
+		}
+	}
+	if n, err := strconv.Atoi(v[0 : len(v)-1]); err == nil && n >= 0 {
+		now := time.Now()
+		switch v[len(v)-1] {
+		case 'd':
+			return now.AddDate(0, 0, -n).Unix()
+		case 'w':
+			return now.AddDate(0, 0, -7*n).Unix()
+		case 'm':
+			return now.AddDate(0, -n, 0).Unix()
+		case 'y':
+			return now.AddDate(-n, 0, 0).Unix()
+		}
 	}
-	fn := files[0]
+	abort(6, "Invalid "+opt+" '"+v+"' (expected a date, e.g. 2020-01-31, or an age, e.g. 90d, 6m, 5y)")
+	return 0
+}
 
-	// Default 20, user over-ride with '--count', maximum 999
-	var thresh string = "00000000" // modtime is 08x format
-	cli_count = min(cli_count, 999)
-	title := fmt.Sprintf("LATEST %d CHANGED FILES", cli_count)
-	topInit(cli_count, true, thresh)
+// the window of modify times to consider (inclusive)
+var latFrom, latTo int64 = 0, math.MaxInt64
 
+func latFile(fn string, prefix string) int {
 	// fixed use of .ssf file (no local)
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
 	defer r.Close()
 
+	// get the threshold
+	thresh := topThreshold()
+
 	var s string
 	var lineno int
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 
 	for scanner.Scan() {
 		s = scanner.Text()
@@ -79,29 +109,89 @@ func lat(args []string) {
 		}
 
 		// check size with least kerfuffle
-		pos1 := strings.Index(s, " ")
-		if pos1 == -1 || pos1 < 55 {
-			fmt.Printf("Skipping line %d - Invalid format (pos %d)\n", lineno, pos1)
+		rec, ok := parseSSFRecord(s)
+		if !ok || rec.format < 4 {
+			fmt.Printf("Skipping line %d of %s - Invalid format\n", lineno, fn)
+			continue
+		}
+		key := rec.modtime // 8ch
+		if t := decodeHex(key); t < latFrom || t > latTo {
 			continue
 		}
-		key := s[43:51] // 8ch
+		if cli_reverse {
+			// (the table keeps the highest keys - so for the oldest, the times are turned upside down)
+			key = fmt.Sprintf("%08x", 0xffffffff-decodeHex(key))
+		}
 		if key < thresh {
 			// off the bottom - no need to do a Add attempt
 			continue
 		}
 
 		// get rest of fields
-		id := s[0:pos1]
-		pos2 := strings.Index(s, " :")
-		name := s[pos2+2:]
+		id := rec.shab64 + rec.modtime + rec.size
+		name := prefix + rec.name
 
 		// check for discard
-		if cli_discard != "" && len(name) >= len(cli_discard) && name[:len(cli_discard)] == cli_discard {
+		if discarded(rec.name) {
 			continue
 		}
 
 		thresh = topAdd(key, id, name)
 	}
+	return lineno
+}
+
+func lat(args []string) {
+	// Make sure the input files exist / error appropriately
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case num > 8:
+		abort(8, "Too many .ssf files specified - eight is enough")
+	case num < 1:
+		abort(9, "Need an SSF file to perform latest file check")
+	}
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "Input SSF file '"+fn+"' does not exist")
+		}
+	}
+
+	if cli_after != "" {
+		latFrom = latDate("--after", cli_after) + 1
+	}
+	if cli_before != "" {
+		latTo = latDate("--before", cli_before) - 1
+	}
+	if latFrom > latTo {
+		abort(6, "Nothing can be both --after "+cli_after+" and --before "+cli_before)
+	}
+
+	// Default 20, user over-ride with '--count', maximum 999
+	var thresh string = "00000000" // modtime is 08x format
+	cli_count = min(cli_count, 999)
+	title := fmt.Sprintf("LATEST %d CHANGED FILES", cli_count)
+	if cli_reverse {
+		title = fmt.Sprintf("OLDEST %d FILES", cli_count)
+	}
+	if cli_after != "" {
+		title += " after " + topDate(time.Unix(latFrom-1, 0))
+	}
+	if cli_before != "" {
+		title += " before " + topDate(time.Unix(latTo+1, 0))
+	}
+	topInit(cli_count, true, thresh)
+
+	// (with more than one SSF, each name is prefixed with the file it came from)
+	if num == 1 {
+		latFile(files[0], "")
+	} else {
+		title += " for "
+		for _, fn := range files {
+			lines := latFile(fn, fn+": ")
+			title += fmt.Sprintf(" %s (%d)", fn, lines)
+		}
+	}
 
 	topReportByDate(title)
 }
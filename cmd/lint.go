@@ -0,0 +1,324 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint file.ssf",
+	Short: "Check an SSF for ordering, duplication and encoding problems",
+	Long: `shaman lint file.ssf [--fix]
+Checks an SSF and reports each problem with a warning code:
+   L01  record out of order (names must be in walk order - see below)     fixable
+   L02  duplicate (sha, name) pair                                         fixable
+   L03  mixed formats within one file
+   L04  zero-size file (often a failed copy or placeholder)
+   L05  modify time in the future
+   L06  un-escaped control character in name                               fixable
+   L07  non-canonical size or modify time encoding                         fixable
+   L08  line that cannot be parsed
+   L09  byte-order mark or CRLF line endings (e.g. edited on Windows)      fixable
+   L10  grand totals comment ('# N files, N bytes') does not match the records
+   L11  duplicates comments do not match the records
+With --fix, a corrected copy is written (to out.ssf if given, or over the input with --overwrite) having
+sorted, de-duplicated, escaped and normalised records.  Unparseable lines are dropped by --fix.
+Names must be in the order generate writes them: sorted within each directory, with a directory's contents
+in its place (so "a/x" comes before "a.txt") - or, for an SSF made with 'generate --sort full' (which says
+so at the top, '# sort: full'), in strict byte order.  --fix sorts them the same way.
+The totals and duplicates comments at the end of an SSF are recounted from the records, so a file that
+was hand-edited or truncated after they were written shows up (L10, L11).
+Exit code is 0 if clean, 1 if there were warnings.`,
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		lin(args)
+	},
+}
+
+var cli_fix bool = false // repair the problems that can be safely repaired
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().BoolVarP(&cli_fix, "fix", "", false, "Write a corrected file (where safe)")
+	lintCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "With --fix, overwrite the input file")
+}
+
+// ----------------------- Lint function below this line -----------------------
+
+// escape control characters in a name the way the SSF specification requires
+func escapeName(name string) string {
+	var b strings.Builder
+	for _, c := range []byte(name) {
+		if c < 0x20 || c == 0x7f {
+			fmt.Fprintf(&b, "\\0x%02x", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func lin(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case num == 2 && !cli_fix:
+		abort(6, "An output file is only used with --fix")
+	case num == 2 && cli_overwrite:
+		abort(6, "Give an output file or --overwrite, not both")
+	}
+	fnr := files[0]
+
+	r, err := ssfOpen(fnr)
+	if err != nil {
+		abort(4, "Can't open "+fnr+" - stuck!")
+	}
+	defer r.Close()
+
+	var counts = map[string]int{}
+	warn := func(code string, lineno int, msg string) {
+		counts[code]++
+		fmt.Printf("%s line %d: %s\n", code, lineno, msg)
+	}
+
+	now := time.Now().Unix()
+	var recs []ssfRecord
+	var header, comments []string
+	var seen = map[string]int{} // sha+name -> first line
+	var formats = map[int]int{} // format -> first line
+	var lastName string
+	var lineno int
+	var trailer lintTrailer
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineno++
+		if len(s) == 0 {
+			continue
+		}
+		if s[0:1] == "#" {
+			trailer.comment(lineno, s)
+			if len(recs) == 0 {
+				header = append(header, s)
+			} else {
+				comments = append(comments, s)
+			}
+			continue
+		}
+
+		rec, ok := parseSSFRecord(s)
+		if !ok {
+			warn("L08", lineno, "cannot be parsed")
+			continue
+		}
+		trailer.record(rec)
+
+		// formats 4 and 5 are the same layout (5 just has annotations on some records)
+		if _, ok := formats[min(rec.format, 4)]; !ok {
+			if len(formats) > 0 {
+				warn("L03", lineno, fmt.Sprintf("format %d record in a file that already has other formats", rec.format))
+			}
+			formats[min(rec.format, 4)] = lineno
+		}
+		if ssfRecordLine(rec) != s {
+			warn("L07", lineno, "non-canonical size or modify time")
+		}
+		if escaped := escapeName(rec.name); escaped != rec.name {
+			warn("L06", lineno, "un-escaped control character in name "+escaped)
+			rec.name = escaped
+		}
+		if rec.size != "" && decodeHex(rec.size) == 0 {
+			warn("L04", lineno, "zero-size file "+rec.name)
+		}
+		if rec.modtime != "" && decodeHex(rec.modtime) > now {
+			warn("L05", lineno, "modify time in the future ("+time.Unix(decodeHex(rec.modtime), 0).Format(time.DateTime)+")")
+		}
+		if rec.format >= 4 {
+			if lastName != "" && lintCompare(header, rec.name, lastName) < 0 {
+				warn("L01", lineno, "out of order: "+rec.name+" after "+lastName)
+			}
+			lastName = rec.name
+		}
+		key := rec.shab64 + " :" + rec.name
+		if first, ok := seen[key]; ok {
+			warn("L02", lineno, fmt.Sprintf("duplicate of line %d", first))
+			continue
+		}
+		seen[key] = lineno
+		recs = append(recs, rec)
+	}
+
+	trailer.check(warn)
+	if r.bom {
+		warn("L09", 1, "byte-order mark at start of file")
+	}
+	if r.crlf > 0 {
+		warn("L09", lineno, fmt.Sprintf("%d lines end CRLF rather than LF", r.crlf))
+	}
+
+	// summary
+	var total int
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		fmt.Printf("%s: %d records, no problems found\n", fnr, len(recs))
+		return
+	}
+	fmt.Printf("%s: %d records, %d warnings\n", fnr, len(recs), total)
+
+	if cli_fix {
+		if counts["L03"] > 0 {
+			fmt.Println("Not fixing: the file has mixed formats")
+		} else {
+			fnw := fnr + ".temp"
+			if num == 2 {
+				fnw = files[1]
+			} else if !cli_overwrite {
+				abort(6, "--fix needs an output file or --overwrite")
+			}
+			lintFix(fnw, header, comments, recs)
+			if num == 1 {
+				ssfReplace(fnw, fnr)
+				fnw = fnr
+			}
+			fmt.Println("Fixed file written to " + fnw)
+		}
+	}
+	abort(1, "")
+}
+
+// compare two names in the order the SSF should be in - walk order, or byte order if it says it was made
+// with --sort full
+func lintCompare(header []string, a string, b string) int {
+	if slices.Contains(header, sortFullComment) {
+		return strings.Compare(a, b)
+	}
+	return walkCompare(a, b)
+}
+
+// write the repaired records in order - leading comments stay at the top, any others go to the end
+func lintFix(fnw string, header []string, comments []string, recs []ssfRecord) {
+	w := writeInit(fnw)
+	for _, c := range header {
+		fmt.Fprintln(w, c)
+	}
+	slices.SortStableFunc(recs, func(a, b ssfRecord) int {
+		if c := lintCompare(header, a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.shab64, b.shab64)
+	})
+	for _, rec := range recs {
+		fmt.Fprintln(w, ssfRecordLine(rec))
+	}
+	for _, c := range comments {
+		fmt.Fprintln(w, c)
+	}
+	w.close()
+}
+
+// ----------------------- Totals and duplicates comments (L10, L11)
+
+var lintTotalsComment = regexp.MustCompile(`^# (\d+) files, (\d+) bytes$`)
+var lintDupeComment = regexp.MustCompile(`^# ([A-Za-z0-9+/]{43}) x(\d+)$`)
+
+// what the records add up to, and what the comments say they do
+type lintTrailer struct {
+	files  int64
+	bytes  int64
+	shas   map[string]int // sha -> records
+	totals []int          // lines of totals comments
+	said   []string       // what each says
+	dupes  map[string]int // sha -> line of its duplicates comment
+	dupeN  map[string]int // sha -> the count it gives
+	dupeAt int            // line of the duplicates heading or 'no duplicates' comment (0 if none)
+	nodupe bool           // the comment says there were none
+}
+
+func (t *lintTrailer) record(rec ssfRecord) {
+	if t.shas == nil {
+		t.shas = map[string]int{}
+	}
+	t.files++
+	t.bytes += decodeHex(rec.size)
+	t.shas[rec.shab64]++
+}
+
+func (t *lintTrailer) comment(lineno int, s string) {
+	if t.dupes == nil {
+		t.dupes, t.dupeN = map[string]int{}, map[string]int{}
+	}
+	switch {
+	case lintTotalsComment.MatchString(s):
+		t.totals = append(t.totals, lineno)
+		t.said = append(t.said, s)
+	case s == "# There were no duplicates":
+		t.dupeAt, t.nodupe = lineno, true
+	case strings.HasPrefix(s, "# ---") && strings.Contains(s, " Duplicates "):
+		t.dupeAt = lineno
+	default:
+		if m := lintDupeComment.FindStringSubmatch(s); m != nil {
+			t.dupes[m[1]] = lineno
+			t.dupeN[m[1]], _ = strconv.Atoi(m[2])
+		}
+	}
+}
+
+// compare the comments with the records
+func (t *lintTrailer) check(warn func(code string, lineno int, msg string)) {
+	for x, lineno := range t.totals {
+		m := lintTotalsComment.FindStringSubmatch(t.said[x])
+		files, _ := strconv.ParseInt(m[1], 10, 64)
+		bytes, _ := strconv.ParseInt(m[2], 10, 64)
+		if files != t.files || bytes != t.bytes {
+			warn("L10", lineno, fmt.Sprintf("totals say %d files, %d bytes - the records add up to %d files, %d bytes", files, bytes, t.files, t.bytes))
+		}
+	}
+
+	if t.dupeAt == 0 && len(t.dupes) == 0 {
+		return
+	}
+	if t.dupeAt == 0 {
+		t.dupeAt = slices.Min(slices.Collect(maps.Values(t.dupes))) // (a list with no heading)
+	}
+	var multi []string // shas held more than once
+	for sha, n := range t.shas {
+		if n > 1 {
+			multi = append(multi, sha)
+		}
+	}
+	slices.Sort(multi)
+	if t.nodupe && len(multi) > 0 {
+		warn("L11", t.dupeAt, fmt.Sprintf("says there were no duplicates - %d SHAs have more than one record", len(multi)))
+		return
+	}
+	for _, sha := range slices.Sorted(maps.Keys(t.dupes)) {
+		if n := t.shas[sha]; n != t.dupeN[sha] {
+			warn("L11", t.dupes[sha], fmt.Sprintf("duplicate %s x%d - it has %d records", sha, t.dupeN[sha], n))
+		}
+	}
+	for _, sha := range multi {
+		if _, ok := t.dupes[sha]; !ok {
+			warn("L11", t.dupeAt, fmt.Sprintf("duplicate %s x%d is not listed", sha, t.shas[sha]))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// lookupCmd represents the lookup command
+var lookupCmd = &cobra.Command{
+	Use:   "lookup sha file.ssf...",
+	Short: "Show the records with a SHA (given as hex, base64 or a prefix) in SSFs",
+	Long: `shaman lookup sha file.ssf [file.ssf...]
+Finds a SHA in the SSFs and shows it in both encodings, with each record that has it (SSF, size, modify
+time and name).  The SHA can be given as hex (as made by sha256sum), as base64 (as in an SSF), or as a
+prefix of either (at least 6 characters) as long as it matches only one SHA:
+   shaman lookup 9f86d081884c7d65 *.ssf
+The exit code is 1 if the SHA is not found.`,
+	Args:    cobra.MinimumNArgs(2),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		loo(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lookupCmd)
+}
+
+// ----------------------- Lookup function below this line -----------------------
+
+func loo(args []string) {
+	q := shaQueryParse(args[0])
+	num, files, found := getSSFs(args[1:])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "SSF file '"+fn+"' does not exist")
+		}
+	}
+
+	hits := shaQueryFind(q, files)
+	if len(hits) == 0 {
+		abort(1, "SHA '"+q.raw+"' not found")
+	}
+	sha := hits[0].rec.shab64
+	fmt.Println("sha256: " + hex.EncodeToString(shaBase64ToShaBinary(sha)))
+	fmt.Println("base64: " + sha)
+	for _, h := range hits {
+		size, when, name := "-", "-", "(anonymous)"
+		if h.rec.size != "" {
+			size = sizeAsString(decodeHex(h.rec.size))
+		}
+		if h.rec.modtime != "" {
+			when = time.Unix(decodeHex(h.rec.modtime), 0).Format(time.DateTime)
+		}
+		if h.rec.format >= 4 {
+			name = h.rec.name
+		}
+		fmt.Printf("  %s  %15s  %19s  %s\n", h.ssf, size, when, name)
+	}
+}
@@ -0,0 +1,646 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// mediaCmd represents the media command
+var mediaCmd = &cobra.Command{
+	Use:   "media file.ssf",
+	Short: "List audio/video files using their media annotations",
+	Long: `shaman media file.ssf
+Lists the records in an SSF that carry media annotations (created with 'generate --annotate media'), showing
+duration, resolution and codecs.  The list can be filtered by duration and codec, e.g.
+   shaman media file.ssf --shorter 10s            # videos/tracks under ten seconds
+   shaman media file.ssf --not-codec h264         # anything whose video or audio is not h264
+Codec names are normalised (h264, h265, vp9, av1, aac, mp3, opus...) regardless of container.`,
+	Args:    cobra.MaximumNArgs(1),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		med(args)
+	},
+}
+
+var cli_shorter string = ""  // only show media shorter than this duration
+var cli_longer string = ""   // only show media longer than this duration
+var cli_codec string = ""    // only show media using this codec
+var cli_notcodec string = "" // only show media not using this codec
+
+func init() {
+	rootCmd.AddCommand(mediaCmd)
+
+	mediaCmd.Flags().StringVarP(&cli_shorter, "shorter", "", "", "Only show media shorter than duration (e.g. 10s, 5m)")
+	mediaCmd.Flags().StringVarP(&cli_longer, "longer", "", "", "Only show media longer than duration (e.g. 10s, 5m)")
+	mediaCmd.Flags().StringVarP(&cli_codec, "codec", "", "", "Only show media with this video or audio codec")
+	mediaCmd.Flags().StringVarP(&cli_notcodec, "not-codec", "", "", "Only show media without this video or audio codec")
+}
+
+// ----------------------- Media function below this line -----------------------
+
+func med(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case num < 1:
+		abort(9, "Need an SSF file to list media")
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+
+	// duration limits (in seconds, -1 meaning unused)
+	shorter := -1.0
+	longer := -1.0
+	if cli_shorter != "" {
+		d, err := time.ParseDuration(cli_shorter)
+		if err != nil {
+			abort(6, "Invalid --shorter duration '"+cli_shorter+"'")
+		}
+		shorter = d.Seconds()
+	}
+	if cli_longer != "" {
+		d, err := time.ParseDuration(cli_longer)
+		if err != nil {
+			abort(6, "Invalid --longer duration '"+cli_longer+"'")
+		}
+		longer = d.Seconds()
+	}
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+
+	fmt.Println("  DURATION  RESOLUTION  VIDEO     AUDIO     FILENAME")
+	var s string
+	var hits int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s = scanner.Text()
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+
+		m := annotationMap(ssfAnnotations(s))
+		vcodec, acodec := m["vcodec"], m["acodec"]
+		if vcodec == "" && acodec == "" && m["dur"] == "" {
+			// not a media record
+			continue
+		}
+		dur, err := strconv.ParseFloat(m["dur"], 64)
+		if err != nil {
+			dur = -1
+		}
+
+		// filters
+		if shorter >= 0 && (dur < 0 || dur >= shorter) {
+			continue
+		}
+		if longer >= 0 && (dur < 0 || dur <= longer) {
+			continue
+		}
+		if cli_codec != "" && vcodec != cli_codec && acodec != cli_codec {
+			continue
+		}
+		if cli_notcodec != "" && (vcodec == cli_notcodec || acodec == cli_notcodec) {
+			continue
+		}
+
+		durs := "-"
+		if dur >= 0 {
+			durs = (time.Duration(dur*1000) * time.Millisecond).Round(time.Millisecond).String()
+		}
+		res := m["res"]
+		if res == "" {
+			res = "-"
+		}
+		if vcodec == "" {
+			vcodec = "-"
+		}
+		if acodec == "" {
+			acodec = "-"
+		}
+		_, _, _, _, name := splitSSFLine(s)
+		fmt.Printf("%10s  %-10s  %-8s  %-8s  %s\n", durs, res, vcodec, acodec, name)
+		hits++
+	}
+	fmt.Printf("%d media records listed\n", hits)
+}
+
+// ----------------------- Media header parsing (annotator) -----------------------
+
+// What we can find out cheaply from the container headers - no decoding of the streams is done
+type mediaInfo struct {
+	duration float64 // seconds (0 if unknown)
+	vcodec   string  // normalised video codec name
+	acodec   string  // normalised audio codec name
+	width    int     // video pixel width
+	height   int     // video pixel height
+	taken    string  // when a photo was taken (EXIF)
+}
+
+// mediaAnnotations returns dur/res/vcodec/acodec annotations for mp4/mov/mkv/webm/mp3 files, and res/taken
+// for jpg/png/webp images (or nil)
+func mediaAnnotations(fn string) []string {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+
+	var mi mediaInfo
+	var ok bool
+	switch strings.ToLower(path.Ext(fn)) {
+	case ".mp4", ".m4v", ".m4a", ".mov", ".3gp":
+		mi, ok = mp4Info(f, st.Size())
+	case ".mkv", ".webm", ".mka":
+		mi, ok = mkvInfo(f, st.Size())
+	case ".mp3":
+		mi, ok = mp3Info(f, st.Size())
+	case ".jpg", ".jpeg", ".png", ".webp":
+		mi, ok = photoInfo(f, fn)
+	}
+	if !ok {
+		return nil
+	}
+
+	var annots []string
+	if mi.duration > 0 {
+		annots = append(annots, fmt.Sprintf("dur=%.3f", mi.duration))
+	}
+	if mi.width > 0 && mi.height > 0 {
+		annots = append(annots, fmt.Sprintf("res=%dx%d", mi.width, mi.height))
+	}
+	if mi.vcodec != "" {
+		annots = append(annots, "vcodec="+annotationValue(mi.vcodec))
+	}
+	if mi.acodec != "" {
+		annots = append(annots, "acodec="+annotationValue(mi.acodec))
+	}
+	if mi.taken != "" {
+		annots = append(annots, "taken="+mi.taken)
+	}
+	slog.Debug("media annotations", "file", fn, "annotations", annots)
+	return annots
+}
+
+// map container-specific codec identifiers onto common names (unknown ones pass through lowercased)
+func mediaCodecName(id string) string {
+	switch id {
+	case "avc1", "avc3", "V_MPEG4/ISO/AVC":
+		return "h264"
+	case "hvc1", "hev1", "V_MPEGH/ISO/HEVC":
+		return "h265"
+	case "vp08", "V_VP8":
+		return "vp8"
+	case "vp09", "V_VP9":
+		return "vp9"
+	case "av01", "V_AV1":
+		return "av1"
+	case "mp4v", "V_MPEG4/ISO/ASP", "V_MPEG4/ISO/SP":
+		return "mpeg4"
+	case "mp4a", "A_AAC", "A_AAC/MPEG4/LC", "A_AAC/MPEG2/LC":
+		return "aac"
+	case "ac-3", "A_AC3":
+		return "ac3"
+	case "ec-3", "A_EAC3":
+		return "eac3"
+	case "Opus", "A_OPUS":
+		return "opus"
+	case "A_VORBIS":
+		return "vorbis"
+	case "fLaC", "A_FLAC":
+		return "flac"
+	case "A_MPEG/L3":
+		return "mp3"
+	}
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+// ----------------------- MP4 / QuickTime (ISO BMFF)
+
+// mp4Info finds the 'moov' box among the top-level boxes (it may be after 'mdat') and parses it
+func mp4Info(f *os.File, size int64) (mediaInfo, bool) {
+	var mi mediaInfo
+	var pos int64
+	hdr := make([]byte, 16)
+	for pos+8 <= size {
+		if _, err := f.ReadAt(hdr[0:8], pos); err != nil {
+			return mi, false
+		}
+		bsize := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		typ := string(hdr[4:8])
+		hlen := int64(8)
+		switch bsize {
+		case 0:
+			bsize = size - pos
+		case 1:
+			if _, err := f.ReadAt(hdr[8:16], pos+8); err != nil {
+				return mi, false
+			}
+			bsize = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			hlen = 16
+		}
+		if bsize < hlen {
+			return mi, false
+		}
+		if typ == "moov" {
+			if bsize > 64*1024*1024 {
+				// implausible - don't try to load it
+				return mi, false
+			}
+			body := make([]byte, bsize-hlen)
+			if _, err := f.ReadAt(body, pos+hlen); err != nil {
+				return mi, false
+			}
+			mp4Moov(body, &mi)
+			return mi, true
+		}
+		pos += bsize
+	}
+	return mi, false
+}
+
+// step through the child boxes in b, calling fn with the type and body of each
+func mp4Boxes(b []byte, fn func(typ string, body []byte)) {
+	for len(b) >= 8 {
+		bsize := uint64(binary.BigEndian.Uint32(b[0:4]))
+		hlen := uint64(8)
+		switch bsize {
+		case 0:
+			bsize = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return
+			}
+			bsize = binary.BigEndian.Uint64(b[8:16])
+			hlen = 16
+		}
+		if bsize < hlen || bsize > uint64(len(b)) {
+			return
+		}
+		fn(string(b[4:8]), b[hlen:bsize])
+		b = b[bsize:]
+	}
+}
+
+func mp4Moov(moov []byte, mi *mediaInfo) {
+	mp4Boxes(moov, func(typ string, body []byte) {
+		switch typ {
+		case "mvhd":
+			// movie header - overall duration
+			if len(body) >= 32 && body[0] == 1 {
+				timescale := binary.BigEndian.Uint32(body[20:24])
+				duration := binary.BigEndian.Uint64(body[24:32])
+				if timescale > 0 {
+					mi.duration = float64(duration) / float64(timescale)
+				}
+			} else if len(body) >= 20 {
+				timescale := binary.BigEndian.Uint32(body[12:16])
+				duration := binary.BigEndian.Uint32(body[16:20])
+				if timescale > 0 {
+					mi.duration = float64(duration) / float64(timescale)
+				}
+			}
+		case "trak":
+			mp4Trak(body, mi)
+		}
+	})
+}
+
+func mp4Trak(trak []byte, mi *mediaInfo) {
+	var handler string
+	var format string
+	var width, height int
+	var walk func(b []byte)
+	walk = func(b []byte) {
+		mp4Boxes(b, func(typ string, body []byte) {
+			switch typ {
+			case "mdia", "minf", "stbl":
+				walk(body)
+			case "hdlr":
+				if len(body) >= 12 {
+					handler = string(body[8:12])
+				}
+			case "stsd":
+				// first sample entry holds the codec fourcc (and picture size for video)
+				if len(body) >= 16 {
+					format = string(body[12:16])
+				}
+				if len(body) >= 8+36 {
+					width = int(binary.BigEndian.Uint16(body[8+32 : 8+34]))
+					height = int(binary.BigEndian.Uint16(body[8+34 : 8+36]))
+				}
+			}
+		})
+	}
+	walk(trak)
+
+	switch handler {
+	case "vide":
+		if mi.vcodec == "" {
+			mi.vcodec = mediaCodecName(format)
+			mi.width, mi.height = width, height
+		}
+	case "soun":
+		if mi.acodec == "" {
+			mi.acodec = mediaCodecName(format)
+		}
+	}
+}
+
+// ----------------------- Matroska / WebM (EBML)
+
+const (
+	ebmlHeader        = 0x1A45DFA3
+	mkvSegment        = 0x18538067
+	mkvInfoID         = 0x1549A966
+	mkvTimecodeScale  = 0x2AD7B1
+	mkvDuration       = 0x4489
+	mkvTracks         = 0x1654AE6B
+	mkvTrackEntry     = 0xAE
+	mkvTrackType      = 0x83
+	mkvCodecID        = 0x86
+	mkvVideo          = 0xE0
+	mkvPixelWidth     = 0xB0
+	mkvPixelHeight    = 0xBA
+	mkvCluster        = 0x1F43B675
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+)
+
+// read an EBML variable-length integer at pos - returns value, length and whether it was 'unknown' (all ones)
+func ebmlVint(f io.ReaderAt, pos int64, keepMarker bool) (uint64, int, bool, error) {
+	b := make([]byte, 8)
+	if _, err := f.ReadAt(b[0:1], pos); err != nil {
+		return 0, 0, false, err
+	}
+	n := 1
+	for mask := byte(0x80); n <= 8 && b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 8 {
+		return 0, 0, false, fmt.Errorf("bad vint")
+	}
+	if n > 1 {
+		if _, err := f.ReadAt(b[1:n], pos+1); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> n)
+	}
+	allOnes := v == uint64(0xFF>>n)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+		allOnes = allOnes && b[i] == 0xFF
+	}
+	return v, n, allOnes, nil
+}
+
+func mkvInfo(f *os.File, size int64) (mediaInfo, bool) {
+	var mi mediaInfo
+	id, _, _, err := ebmlVint(f, 0, true)
+	if err != nil || id != ebmlHeader {
+		return mi, false
+	}
+
+	var scale uint64 = 1000000 // default timecode scale (ns)
+	var duration float64
+	var seenInfo, seenTracks bool
+	var track struct {
+		kind   uint64
+		codec  string
+		width  int
+		height int
+	}
+
+	// element payload readers (the size is from the file - a number is at most 8 bytes, and anything
+	// bigger is corrupt, so is skipped rather than read)
+	readUint := func(pos int64, n int64) uint64 {
+		if n < 1 || n > 8 {
+			return 0
+		}
+		b := make([]byte, n)
+		f.ReadAt(b, pos)
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v
+	}
+	readFloat := func(pos int64, n int64) float64 {
+		if n != 4 && n != 8 {
+			return 0
+		}
+		b := make([]byte, n)
+		f.ReadAt(b, pos)
+		switch n {
+		case 4:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		case 8:
+			return math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+		return 0
+	}
+	readString := func(pos int64, n int64) string {
+		if n < 1 {
+			return ""
+		}
+		b := make([]byte, min(n, 256))
+		f.ReadAt(b, pos)
+		return strings.TrimRight(string(b), "\x00")
+	}
+
+	// walk elements between start and end, descending only into the masters we care about
+	var walk func(start, end int64) bool
+	walk = func(start, end int64) bool {
+		pos := start
+		for pos < end {
+			id, idn, _, err := ebmlVint(f, pos, true)
+			if err != nil {
+				return false
+			}
+			sz, szn, unknown, err := ebmlVint(f, pos+int64(idn), false)
+			if err != nil {
+				return false
+			}
+			data := pos + int64(idn) + int64(szn)
+			dend := data + int64(sz)
+			if unknown || dend > end {
+				dend = end
+			}
+
+			switch id {
+			case mkvSegment, mkvTracks, mkvVideo:
+				if !walk(data, dend) {
+					return false
+				}
+				if id == mkvTracks {
+					seenTracks = true
+				}
+			case mkvInfoID:
+				walk(data, dend)
+				seenInfo = true
+			case mkvTrackEntry:
+				track.kind, track.codec, track.width, track.height = 0, "", 0, 0
+				walk(data, dend)
+				switch track.kind {
+				case mkvTrackTypeVideo:
+					if mi.vcodec == "" {
+						mi.vcodec = mediaCodecName(track.codec)
+						mi.width, mi.height = track.width, track.height
+					}
+				case mkvTrackTypeAudio:
+					if mi.acodec == "" {
+						mi.acodec = mediaCodecName(track.codec)
+					}
+				}
+			case mkvTimecodeScale:
+				scale = readUint(data, int64(sz))
+			case mkvDuration:
+				duration = readFloat(data, int64(sz))
+			case mkvTrackType:
+				track.kind = readUint(data, int64(sz))
+			case mkvCodecID:
+				track.codec = readString(data, int64(sz))
+			case mkvPixelWidth:
+				track.width = int(readUint(data, int64(sz)))
+			case mkvPixelHeight:
+				track.height = int(readUint(data, int64(sz)))
+			case mkvCluster:
+				// media data from here on - stop if we have what we need, or can't skip it
+				if (seenInfo && seenTracks) || unknown {
+					return false
+				}
+			}
+			pos = dend
+		}
+		return true
+	}
+	walk(0, size)
+
+	if !seenInfo && !seenTracks {
+		return mi, false
+	}
+	mi.duration = duration * float64(scale) / 1e9
+	return mi, true
+}
+
+// ----------------------- MPEG audio (mp3)
+
+var mp3Bitrates = [2][3][16]int{
+	{ // MPEG-1: layer I, II, III
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{ // MPEG-2/2.5: layer I, II, III
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{0, 0, 0},             // reserved
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+func mp3Info(f *os.File, size int64) (mediaInfo, bool) {
+	var mi mediaInfo
+
+	// skip any ID3v2 tag (syncsafe length)
+	var start int64
+	hdr := make([]byte, 10)
+	if _, err := f.ReadAt(hdr, 0); err != nil {
+		return mi, false
+	}
+	if string(hdr[0:3]) == "ID3" {
+		start = 10 + (int64(hdr[6])<<21 | int64(hdr[7])<<14 | int64(hdr[8])<<7 | int64(hdr[9]))
+		if hdr[5]&0x10 != 0 {
+			start += 10 // footer present
+		}
+	}
+
+	// look for the first frame sync in the next 64k
+	buf := make([]byte, 64*1024)
+	n, _ := f.ReadAt(buf, start)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := (buf[i+1] >> 3) & 3 // 0=2.5, 2=2, 3=1
+		layer := (buf[i+1] >> 1) & 3   // 1=III, 2=II, 3=I
+		bitIdx := buf[i+2] >> 4
+		srIdx := (buf[i+2] >> 2) & 3
+		if version == 1 || layer == 0 || bitIdx == 0 || bitIdx == 15 || srIdx == 3 {
+			continue
+		}
+		mpeg := 1
+		if version == 3 {
+			mpeg = 0
+		}
+		bitrate := mp3Bitrates[mpeg][3-layer][bitIdx] * 1000
+		samplerate := mp3SampleRates[version][srIdx]
+		samples := 1152
+		switch {
+		case layer == 3:
+			samples = 384
+		case layer == 1 && mpeg == 1:
+			samples = 576
+		}
+		mono := (buf[i+3] >> 6) == 3
+
+		// Xing/Info (VBR) header sits after the side information
+		side := 32
+		switch {
+		case mpeg == 0 && mono:
+			side = 17
+		case mpeg == 1 && mono:
+			side = 9
+		case mpeg == 1:
+			side = 17
+		}
+		x := i + 4 + side
+		if x+12 <= len(buf) && (string(buf[x:x+4]) == "Xing" || string(buf[x:x+4]) == "Info") && buf[x+7]&1 != 0 {
+			frames := binary.BigEndian.Uint32(buf[x+8 : x+12])
+			mi.duration = float64(frames) * float64(samples) / float64(samplerate)
+		} else if v := i + 4 + 32; v+18 <= len(buf) && string(buf[v:v+4]) == "VBRI" {
+			frames := binary.BigEndian.Uint32(buf[v+14 : v+18])
+			mi.duration = float64(frames) * float64(samples) / float64(samplerate)
+		} else if bitrate > 0 {
+			// constant bitrate - estimate from the audio payload length
+			mi.duration = float64(size-start-int64(i)) * 8 / float64(bitrate)
+		}
+
+		mi.acodec = [4]string{"", "mp3", "mp2", "mp1"}[layer]
+		return mi, true
+	}
+	return mi, false
+}
@@ -4,15 +4,30 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
 	"github.com/spf13/cobra"
 )
 
-// tsvCmd represents the tsv command
+// -------------------------------- Cobra management -------------------------------
+
+// mergeCmd represents the merge command
 var mergeCmd = &cobra.Command{
-	Use:     "merge",
-	Short:   "Merge two SSF files",
-	Long:    `Merge two SSF files - with optional path 'mount point'`,
-	Args:    cobra.MaximumNArgs(2),
+	Use:   "merge in.ssf[:=prefix/]... out.ssf",
+	Short: "Merge SSF files into one - with optional path 'mount points'",
+	Long: `shaman merge in.ssf[:=prefix/] [in.ssf[:=prefix/]...] out.ssf
+Merges the records of several (named) SSFs into one, sorted by name.  Each input can be given a prefix,
+like a mount point, that is put in front of its names - so that a fleet-wide 'union' SSF keeps each
+record's origin, and whereis, compare etc show which machine a hit came from:
+   shaman merge web1.ssf:=web1/ web2.ssf:=web2/ db.ssf:=db/ fleet.ssf
+The last argument is the output ('-' for stdout), which must not exist.  A name found in more than one
+input is kept from the first, and reported.  Comments are dropped (the inputs are listed at the top of
+the output instead).  With --dry-run, the merge is done but nothing is written.`,
+	Args:    cobra.MinimumNArgs(2),
 	GroupID: "G3",
 	Run: func(cmd *cobra.Command, args []string) {
 		mer(args)
@@ -20,12 +35,88 @@ var mergeCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.AddCommand(tsvCmd)
+	rootCmd.AddCommand(mergeCmd)
 
-	mergeCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Optional path that mergefile to be prefixed with")
+	mergeCmd.Flags().BoolVarP(&cli_dryrun, "dry-run", "n", false, "Do everything but write: report what would be written")
 }
 
 // ----------------------- Merge function below this line -----------------------
 
+// an input's prefix as a directory ("" for none)
+func mergePrefix(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
 func mer(args []string) {
+	// split off the prefixes (in.ssf:=prefix/) and the output
+	fnw := args[len(args)-1]
+	if strings.Contains(fnw, ":=") {
+		abort(9, "The last argument must be the output (or '-' for stdout), not an input")
+	}
+	var inputs, prefixes []string
+	for _, a := range args[:len(args)-1] {
+		fn, prefix, _ := strings.Cut(a, ":=")
+		inputs = append(inputs, fn)
+		prefixes = append(prefixes, mergePrefix(prefix))
+	}
+	num, files, found := getSSFs(inputs)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found, "prefixes", prefixes)
+	for x := range files {
+		if !found[x] {
+			abort(6, "Input SSF file '"+files[x]+"' does not exist")
+		}
+	}
+	if fnw == "-" {
+		fnw = ""
+	} else if _, err := os.Stat(fnw); err == nil {
+		abort(6, "Output file '"+fnw+"' already exists (the last argument is the output - '-' for stdout)")
+	} else {
+		getSSFs([]string{fnw})
+	}
+
+	// gather the records, prefixed - the first of a name is kept
+	var recs []ssfRecord
+	origin := map[string]int{} // name -> input it came from
+	var ndup int
+	for x, fn := range files {
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			if rec.format < 4 {
+				abort(6, "SSF '"+fn+"' is anonymous - names are needed to merge (see 'shaman consolidate')")
+			}
+			rec.name = prefixes[x] + strings.TrimPrefix(rec.name, "/")
+			if first, ok := origin[rec.name]; ok {
+				fmt.Fprintf(os.Stderr, "Duplicate name %s in %s - kept the record from %s\n", rec.name, fn, files[first])
+				ndup++
+				return
+			}
+			origin[rec.name] = x
+			recs = append(recs, rec)
+		})
+	}
+	slices.SortStableFunc(recs, func(a, b ssfRecord) int { return walkCompare(a.name, b.name) })
+
+	w := writeInit(fnw)
+	for x, fn := range files {
+		if prefixes[x] != "" {
+			fmt.Fprintf(w, "# merged: %s as %s\n", fn, prefixes[x])
+		} else {
+			fmt.Fprintf(w, "# merged: %s\n", fn)
+		}
+	}
+	for _, r := range recs {
+		w.record(true, r.format, 0, "N", r.shab64, r.modtime, r.size, r.annot, r.name, "")
+	}
+	w.close()
+
+	if fnw != "" {
+		fmt.Printf("Merged %d records from %d SSFs into %s", len(recs), len(files), fnw)
+		if ndup > 0 {
+			fmt.Printf(" (%d duplicate names left out)", ndup)
+		}
+		fmt.Println()
+	}
 }
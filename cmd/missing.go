@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// missingCmd represents the missing command
+var missingCmd = &cobra.Command{
+	Use:   "missing file.ssf [restore.ssf]",
+	Short: "List files in an SSF that no longer exist on disk",
+	Long: `shaman missing file.ssf [restore.ssf] [-p path]
+Lists the records whose named file is no longer present (nothing is hashed, and the SSF is not changed),
+e.g. to check nothing was lost in a migration.  If restore.ssf is given, the missing records are also
+written to it, ready for 'shaman cas restore'.
+The files are looked for from the root recorded in the SSF (see 'shaman generate'), or --root, or --path.
+Exit code is 0 if nothing is missing, 1 otherwise.`,
+	Aliases: []string{"mis"},
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		mis(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(missingCmd)
+
+	missingCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	missingCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to, instead of the recorded root ('.' for the current directory)")
+}
+
+// ----------------------- Missing function below this line -----------------------
+
+func mis(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case num == 2 && found[1]:
+		abort(6, "Output file '"+files[1]+"' already exists")
+	}
+
+	startpath := rootStart(files[0])
+
+	var missing []ssfRecord
+	var total int
+	var anonymous bool
+	ssfForEachRecord(files[0], func(rec ssfRecord) {
+		if rec.format < 4 {
+			anonymous = true
+			return
+		}
+		total++
+		if _, err := os.Lstat(rootJoin(startpath, rec.name)); err != nil {
+			fmt.Println(rec.name)
+			missing = append(missing, rec)
+		}
+	})
+	if anonymous && total == 0 {
+		abort(6, "SSF '"+files[0]+"' has no names (anonymous format) - nothing to look for")
+	}
+
+	if num == 2 && len(missing) > 0 {
+		w := writeInit(files[1])
+		for _, rec := range missing {
+			fmt.Fprintln(w, ssfRecordLine(rec))
+		}
+		if err := w.Flush(); err != nil {
+			abort(4, "Cannot write "+files[1]+": "+err.Error())
+		}
+		w.close()
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d files missing\n", len(missing), total)
+	if len(missing) > 0 {
+		abort(1, "")
+	}
+}
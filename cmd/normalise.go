@@ -0,0 +1,110 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// normaliseCmd represents the normalise command
+var normaliseCmd = &cobra.Command{
+	Use:   "normalise file.ssf [out.ssf]",
+	Short: "Rewrite an SSF with canonical modify-time and size fields",
+	Long: `shaman normalise file.ssf [out.ssf]
+Converts an SSF written by older versions (or by hand) so that every record uses the canonical encoding:
+an 8-digit lower-case hex modify time, and a lower-case hex size of at least 4 digits with no further
+leading zeros (so files over 4GB just have a longer size field, ending at the following space).
+Comments are kept, and lines that cannot be understood are passed through with a warning.
+Writes to stdout, to out.ssf if given, or back to file.ssf with --overwrite.`,
+	Aliases: []string{"normalize", "nor"},
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		nor(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(normaliseCmd)
+
+	normaliseCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Overwrite input file")
+}
+
+// ----------------------- Normalise function below this line -----------------------
+
+func nor(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case num == 2 && cli_overwrite:
+		abort(6, "Give an output file or --overwrite, not both")
+	}
+
+	fnr := files[0]
+	fnw := ""
+	switch {
+	case num == 2:
+		fnw = files[1]
+	case cli_overwrite:
+		fnw = fnr + ".temp"
+	}
+
+	r, err := ssfOpen(fnr)
+	if err != nil {
+		abort(4, "Can't open "+fnr+" - stuck!")
+	}
+	defer r.Close()
+	w := writeInit(fnw)
+
+	var changed, bad, lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			fmt.Fprintln(w, s)
+			continue
+		}
+
+		// very old versions space-padded the modify time
+		t := s
+		if len(t) >= 51 && strings.HasPrefix(t[43:51], " ") {
+			t = t[0:43] + strings.ReplaceAll(t[43:51], " ", "0") + t[51:]
+		}
+
+		rec, ok := parseSSFRecord(t)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Line %d: not understood - passed through unchanged\n", lineno)
+			fmt.Fprintln(w, s)
+			bad++
+			continue
+		}
+		out := ssfRecordLine(rec)
+		if out != s {
+			changed++
+		}
+		fmt.Fprintln(w, out)
+	}
+	w.Flush()
+
+	if fnw != "" {
+		fmt.Printf("%d records normalised, %d lines not understood\n", changed, bad)
+	}
+	if cli_overwrite {
+		if changed == 0 {
+			os.Remove(fnw)
+		} else {
+			os.Rename(fnw, fnr)
+		}
+	}
+}
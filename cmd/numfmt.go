@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ----------------------- Number formatting (shared by all reports)
+
+// Counts and sizes in reports go through here, so that they all look the same: digits grouped in
+// thousands, and sizes either exact (the default), in binary units (--units iec, or --human: 1.4 GiB)
+// or in decimal ones (--units si: 1.5 GB).  The separators are English style (1,234,567.8) unless
+// --locale gives another - the machine's own locale is not used, so that reports read the same wherever
+// they are made.  SSFs and JSON always have plain numbers.
+
+var cli_units string = ""  // exact, iec or si
+var cli_locale string = "" // separator style, e.g. de (default en)
+
+// the separators for a style of writing numbers
+type numStyle struct {
+	group   string // between each three digits
+	decimal string // before the fraction
+}
+
+var numStyles = map[string]numStyle{
+	"en":   {",", "."},
+	"de":   {".", ","},
+	"fr":   {" ", ","}, // (narrow no-break space)
+	"ch":   {"'", "."},
+	"none": {"", "."},
+}
+
+// the languages written in each style other than English's
+var numStyleLanguages = map[string]string{
+	"de": "de", "nl": "de", "it": "de", "es": "de", "pt": "de", "da": "de", "id": "de", "tr": "de", "el": "de",
+	"fr": "fr", "ru": "fr", "pl": "fr", "cs": "fr", "sk": "fr", "sv": "fr", "fi": "fr", "nb": "fr", "no": "fr", "uk": "fr", "hu": "fr",
+	"c": "none", "posix": "none",
+}
+
+var numFormat = numStyles["en"]
+var numUnits = "exact"
+
+// check and apply --units, --human and --locale
+func numFormatSetup() {
+	numUnits = strings.ToLower(cli_units)
+	switch {
+	case numUnits == "" && cli_human:
+		numUnits = "iec"
+	case numUnits == "":
+		numUnits = "exact"
+	case numUnits != "exact" && numUnits != "iec" && numUnits != "si":
+		abort(6, "Invalid --units '"+cli_units+"' (valid: exact, iec, si)")
+	case cli_human && numUnits != "iec":
+		abort(6, "--human is --units iec - it cannot be used with --units "+cli_units)
+	}
+	cli_human = numUnits != "exact" // (for the commands that ask whether sizes are exact)
+
+	if cli_locale == "" {
+		return
+	}
+	// a style by name, or a locale such as de_CH.UTF-8 (its country, then its language)
+	loc := strings.ToLower(cli_locale)
+	loc, _, _ = strings.Cut(loc, ".")
+	lang, country, _ := strings.Cut(strings.ReplaceAll(loc, "_", "-"), "-")
+	style, ok := numStyles[loc]
+	switch {
+	case ok:
+	case country == "ch" || country == "li":
+		style = numStyles["ch"]
+	case numStyleLanguages[lang] != "":
+		style = numStyles[numStyleLanguages[lang]]
+	case len(lang) == 2 || len(lang) == 3:
+		style = numStyles["en"] // (any other language: English style)
+	default:
+		abort(6, "Invalid --locale '"+cli_locale+"' (e.g. en, de, fr, ch, none, or a locale such as de_DE)")
+	}
+	numFormat = style
+}
+
+// an integer with its digits grouped in thousands, e.g. 1,234,567
+func intAsString(i int64) string {
+	s := strconv.FormatInt(i, 10)
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= 3 || numFormat.group == "" {
+		return sign + s
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	head := len(s) % 3
+	if head > 0 {
+		b.WriteString(s[0:head])
+	}
+	for x := head; x < len(s); x += 3 {
+		if x > 0 {
+			b.WriteString(numFormat.group)
+		}
+		b.WriteString(s[x : x+3])
+	}
+	return b.String()
+}
+
+// a number with one decimal place, e.g. 1.4 (or 1,4)
+func decimalAsString(f float64) string {
+	return strings.Replace(fmt.Sprintf("%.1f", f), ".", numFormat.decimal, 1)
+}
+
+// a byte count for a column - exact, or in units, e.g. 1.4 GiB (--units iec) or 1.5 GB (--units si)
+func sizeAsString(n int64) string {
+	base, units := 1024.0, []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	switch numUnits {
+	case "exact":
+		return intAsString(n)
+	case "si":
+		base, units = 1000.0, []string{"kB", "MB", "GB", "TB", "PB", "EB"}
+	}
+	if n < int64(base) && n > -int64(base) {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	var unit string
+	for _, unit = range units {
+		f /= base
+		if f < base && f > -base {
+			break
+		}
+	}
+	return decimalAsString(f) + " " + unit
+}
+
+// a byte count in a sentence - "1,234,567 bytes", or in units "1.2 MiB"
+func bytesAsString(n int64) string {
+	if numUnits != "exact" {
+		return sizeAsString(n)
+	}
+	return intAsString(n) + " bytes"
+}
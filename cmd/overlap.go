@@ -0,0 +1,125 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// overlapCmd represents the overlap command
+var overlapCmd = &cobra.Command{
+	Use:   "overlap file.ssf...",
+	Short: "Report how much large files share, from their recorded chunks",
+	Long: `shaman overlap file.ssf [file.ssf...]
+For the files whose chunks were recorded (generate or update with --chunks), lists each pair of different
+files that have chunks in common, with the bytes they share - most alike first:
+   shaman generate --chunks 1G vms.ssf
+   shaman overlap vms.ssf
+The percentage is of the larger file, so 90% means at most a tenth of either is different.  Identical
+files are left out (see 'shaman duplicates').  The exit code is 1 if no files share chunks.`,
+	Args:    cobra.MinimumNArgs(1),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		ove(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(overlapCmd)
+}
+
+// ----------------------- Overlap function below this line -----------------------
+
+func ove(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "SSF file '"+fn+"' does not exist")
+		}
+	}
+
+	// the chunked records, and for each chunk the records it is in (and how many times)
+	type chunked struct {
+		name string
+		sha  string
+		size int64
+	}
+	type holder struct {
+		rec   int
+		count int64
+	}
+	var recs []chunked
+	var holders = map[string][]holder{}
+	var chunkSize = map[string]int64{}
+	for _, fn := range files {
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			chunks := chunksAnnotated(rec.annot)
+			if chunks == nil {
+				return
+			}
+			name := rec.name
+			if num > 1 {
+				name = fn + ": " + name
+			}
+			counts := map[string]int64{}
+			for _, c := range chunks {
+				counts[c.sum]++
+				chunkSize[c.sum] = c.size
+			}
+			for sum, n := range counts {
+				holders[sum] = append(holders[sum], holder{len(recs), n})
+			}
+			recs = append(recs, chunked{name, rec.shab64, decodeHex(rec.size)})
+		})
+	}
+	if len(recs) == 0 {
+		abort(1, "No records have chunks (record them with 'generate --chunks' or 'update --chunks')")
+	}
+
+	// bytes shared by each pair
+	type pair struct{ a, b int }
+	shared := map[pair]int64{}
+	for sum, hs := range holders {
+		for x := 0; x < len(hs); x++ {
+			for y := x + 1; y < len(hs); y++ {
+				if recs[hs[x].rec].sha != recs[hs[y].rec].sha {
+					shared[pair{hs[x].rec, hs[y].rec}] += min(hs[x].count, hs[y].count) * chunkSize[sum]
+				}
+			}
+		}
+	}
+	if len(shared) == 0 {
+		abort(1, fmt.Sprintf("None of the %d chunked files share any chunks", len(recs)))
+	}
+
+	type result struct {
+		p      pair
+		nbytes int64
+		pct    float64
+	}
+	var results []result
+	for p, n := range shared {
+		results = append(results, result{p, n, float64(n) * 100 / float64(max(recs[p.a].size, recs[p.b].size, 1))})
+	}
+	slices.SortFunc(results, func(a, b result) int {
+		if c := cmp.Compare(b.pct, a.pct); c != 0 {
+			return c
+		}
+		return cmp.Compare(recs[a.p.a].name, recs[b.p.a].name)
+	})
+
+	fmt.Printf("# %d pairs of the %d chunked files share chunks\n", len(results), len(recs))
+	for _, r := range results {
+		a, b := recs[r.p.a], recs[r.p.b]
+		fmt.Printf("%5.1f%%  %s shared  %s (%s)  <->  %s (%s)\n", r.pct, bytesAsString(r.nbytes), a.name, sizeAsString(a.size), b.name, sizeAsString(b.size))
+	}
+}
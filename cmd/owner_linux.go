@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// ----------------------- Owner annotations for Linux
+
+// a file's owner, group, mode and extended ACL
+func ownerOf(fn string) (ownerInfo, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(fn, &st); err != nil {
+		return ownerInfo{}, false
+	}
+	return ownerInfo{
+		owner: ownerUserName(st.Uid),
+		group: ownerGroupName(st.Gid),
+		mode:  fmt.Sprintf("%04o", st.Mode&07777),
+		acl:   ownerACL(fn),
+	}, true
+}
+
+// the named-user, named-group and mask entries of a POSIX ACL ("" if it has none - the rest is the mode)
+func ownerACL(fn string) string {
+	n, err := syscall.Getxattr(fn, "system.posix_acl_access", nil)
+	if err != nil || n < 4 {
+		return ""
+	}
+	buf := make([]byte, n)
+	n, err = syscall.Getxattr(fn, "system.posix_acl_access", buf)
+	if err != nil || n < 4 || binary.LittleEndian.Uint32(buf[0:4]) != 2 {
+		return ""
+	}
+	// (after the version, each entry is a tag, permissions and id: 2+2+4 bytes)
+	var entries []string
+	for e := 4; e+8 <= n; e += 8 {
+		tag := binary.LittleEndian.Uint16(buf[e:])
+		perm := binary.LittleEndian.Uint16(buf[e+2:])
+		id := binary.LittleEndian.Uint32(buf[e+4:])
+		rwx := []byte("---")
+		for x, c := range "rwx" {
+			if perm&(4>>x) != 0 {
+				rwx[x] = byte(c)
+			}
+		}
+		switch tag {
+		case 0x02:
+			entries = append(entries, "user:"+ownerUserName(id)+":"+string(rwx))
+		case 0x08:
+			entries = append(entries, "group:"+ownerGroupName(id)+":"+string(rwx))
+		case 0x10:
+			entries = append(entries, "mask::"+string(rwx))
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return strings.Join(entries, ",")
+}
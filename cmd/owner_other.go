@@ -0,0 +1,12 @@
+//go:build !linux
+
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+// ----------------------- Owner annotations for other systems (not recorded)
+
+func ownerOf(fn string) (ownerInfo, bool) {
+	return ownerInfo{}, false
+}
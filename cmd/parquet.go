@@ -0,0 +1,291 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+// ----------------------- Minimal Parquet writer -----------------------
+
+// Writes SSF records as a Parquet file with the schema
+//     sha    FIXED_LEN_BYTE_ARRAY(32)   the binary SHA256
+//     name   BYTE_ARRAY (UTF8)
+//     size   INT64                      bytes
+//     mtime  INT64                      seconds since the epoch
+// All columns are REQUIRED, PLAIN encoded and uncompressed, with one data page per column per row group,
+// which is all that readers such as DuckDB and Spark need.  The metadata is Thrift compact protocol,
+// written by the small encoder below.
+
+const parquetRowGroup = 256 * 1024 // rows held in memory before a row group is written
+
+// Parquet enumerations (from parquet.thrift)
+const (
+	pqInt64        = 2
+	pqByteArray    = 6
+	pqFixedLen     = 7
+	pqRequired     = 0
+	pqUTF8         = 0
+	pqPlain        = 0
+	pqRLE          = 3
+	pqUncompressed = 0
+	pqDataPage     = 0
+)
+
+type parquetColumn struct {
+	name   string
+	ptype  int
+	length int // for FIXED_LEN_BYTE_ARRAY
+	utf8   bool
+	data   bytes.Buffer // PLAIN-encoded values of the current row group
+}
+
+type parquetChunk struct {
+	offset int64 // of the page header
+	size   int64 // header and page
+	values int64
+}
+
+type parquetWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	pos    int64
+	cols   []*parquetColumn
+	rows   int64            // rows in the current row group
+	total  int64            // rows written in all
+	groups [][]parquetChunk // per row group, per column
+	sizes  []int64          // bytes per row group
+	nrows  []int64          // rows per row group
+}
+
+func parquetCreate(fn string) *parquetWriter {
+	f, err := os.Create(fn)
+	if err != nil {
+		abort(4, "Cannot create file "+fn)
+	}
+	p := &parquetWriter{f: f, w: bufio.NewWriterSize(f, 256*1024)}
+	p.cols = []*parquetColumn{
+		{name: "sha", ptype: pqFixedLen, length: 32},
+		{name: "name", ptype: pqByteArray, utf8: true},
+		{name: "size", ptype: pqInt64},
+		{name: "mtime", ptype: pqInt64},
+	}
+	p.write([]byte("PAR1"))
+	return p
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if _, err := p.w.Write(b); err != nil {
+		abort(4, "Cannot write parquet file (disk full?)")
+	}
+	p.pos += int64(len(b))
+}
+
+// add a record (sha is the 32-byte binary hash)
+func (p *parquetWriter) add(sha []byte, name string, size int64, mtime int64) {
+	p.cols[0].data.Write(sha)
+	binary.Write(&p.cols[1].data, binary.LittleEndian, uint32(len(name)))
+	p.cols[1].data.WriteString(name)
+	binary.Write(&p.cols[2].data, binary.LittleEndian, size)
+	binary.Write(&p.cols[3].data, binary.LittleEndian, mtime)
+	p.rows++
+	if p.rows >= parquetRowGroup {
+		p.flushGroup()
+	}
+}
+
+// write the buffered rows as a row group (one data page per column)
+func (p *parquetWriter) flushGroup() {
+	if p.rows == 0 {
+		return
+	}
+	var chunks []parquetChunk
+	var groupSize int64
+	for _, c := range p.cols {
+		var t thriftCompact
+		t.i32(1, pqDataPage)
+		t.i32(2, int32(c.data.Len()))
+		t.i32(3, int32(c.data.Len()))
+		t.structBegin(5)
+		t.i32(1, int32(p.rows))
+		t.i32(2, pqPlain)
+		t.i32(3, pqRLE)
+		t.i32(4, pqRLE)
+		t.structEnd()
+		t.stop()
+
+		chunk := parquetChunk{offset: p.pos, values: p.rows}
+		p.write(t.buf.Bytes())
+		p.write(c.data.Bytes())
+		chunk.size = p.pos - chunk.offset
+		groupSize += chunk.size
+		chunks = append(chunks, chunk)
+		c.data.Reset()
+	}
+	p.groups = append(p.groups, chunks)
+	p.sizes = append(p.sizes, groupSize)
+	p.nrows = append(p.nrows, p.rows)
+	p.total += p.rows
+	p.rows = 0
+}
+
+// write the footer (FileMetaData) and close
+func (p *parquetWriter) close() {
+	p.flushGroup()
+
+	var t thriftCompact
+	t.i32(1, 1) // version
+
+	// schema: a root with the columns as children
+	t.listBegin(2, thriftStruct, len(p.cols)+1)
+	t.elemBegin()
+	t.binary(4, []byte("schema"))
+	t.i32(5, int32(len(p.cols)))
+	t.structEnd()
+	for _, c := range p.cols {
+		t.elemBegin()
+		t.i32(1, int32(c.ptype))
+		if c.length > 0 {
+			t.i32(2, int32(c.length))
+		}
+		t.i32(3, pqRequired)
+		t.binary(4, []byte(c.name))
+		if c.utf8 {
+			t.i32(6, pqUTF8)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, p.total)
+
+	// row groups
+	t.listBegin(4, thriftStruct, len(p.groups))
+	for g, chunks := range p.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(chunks))
+		for x, ch := range chunks {
+			c := p.cols[x]
+			t.elemBegin()
+			t.i64(2, ch.offset)
+			t.structBegin(3)
+			t.i32(1, int32(c.ptype))
+			t.listBegin(2, thriftI32, 1)
+			t.zigzag(pqPlain)
+			t.listBegin(3, thriftBinary, 1)
+			t.rawBinary([]byte(c.name))
+			t.i32(4, pqUncompressed)
+			t.i64(5, ch.values)
+			t.i64(6, ch.size)
+			t.i64(7, ch.size)
+			t.i64(9, ch.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, p.sizes[g])
+		t.i64(3, p.nrows[g])
+		t.structEnd()
+	}
+	t.binary(6, []byte("shaman"))
+	t.stop()
+
+	p.write(t.buf.Bytes())
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(t.buf.Len()))
+	p.write(n[:])
+	p.write([]byte("PAR1"))
+	if err := p.w.Flush(); err != nil {
+		abort(4, "Cannot write parquet file (disk full?)")
+	}
+	p.f.Close()
+}
+
+// ----------------------- Thrift compact protocol (just what the Parquet footer needs)
+
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type thriftCompact struct {
+	buf  bytes.Buffer
+	last []int16 // last field id, per nesting level
+	id   int16   // last field id at the current level
+}
+
+func (t *thriftCompact) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thriftCompact) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	if d := id - t.id; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.id = id
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftCompact) rawBinary(b []byte) {
+	t.varint(uint64(len(b)))
+	t.buf.Write(b)
+}
+
+func (t *thriftCompact) binary(id int16, b []byte) {
+	t.field(id, thriftBinary)
+	t.rawBinary(b)
+}
+
+func (t *thriftCompact) listBegin(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.varint(uint64(n))
+	}
+}
+
+// a struct-valued field
+func (t *thriftCompact) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+// a struct as a list element (no field header)
+func (t *thriftCompact) elemBegin() {
+	t.last = append(t.last, t.id)
+	t.id = 0
+}
+
+func (t *thriftCompact) structEnd() {
+	t.stop()
+	t.id = t.last[len(t.last)-1]
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftCompact) stop() {
+	t.buf.WriteByte(0)
+}
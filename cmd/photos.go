@@ -0,0 +1,228 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ----------------------- Photo annotations (part of the media annotator) -----------------------
+
+// For jpg/png/webp images, the media annotator records the pixel size (res=WxH) and, for a JPEG with
+// EXIF, when it was taken (taken=2006-01-02T15:04:05, from DateTimeOriginal, else DateTime).  Only the
+// headers are read.
+
+// the pixel size (and EXIF date) of an image, ok=false if it is not one we can read
+func photoInfo(f *os.File, fn string) (mediaInfo, bool) {
+	var mi mediaInfo
+	var err error
+	switch strings.ToLower(path.Ext(fn)) {
+	case ".jpg", ".jpeg":
+		err, mi.width, mi.height = decodeJPEG(fn)
+		mi.taken = jpegExifTaken(f)
+	case ".png":
+		err, mi.width, mi.height = decodePNG(fn)
+	case ".webp":
+		err, mi.width, mi.height = decodeWEBP(fn)
+	}
+	return mi, err == nil && mi.width > 0
+}
+
+// the date a JPEG was taken, from the EXIF in its APP1 segment (or "" if it has none)
+func jpegExifTaken(f io.ReaderAt) string {
+	hdr := make([]byte, 4)
+	if _, err := f.ReadAt(hdr[0:2], 0); err != nil || hdr[0] != 0xFF || hdr[1] != 0xD8 {
+		return ""
+	}
+	pos := int64(2)
+	for {
+		if _, err := f.ReadAt(hdr, pos); err != nil || hdr[0] != 0xFF {
+			return ""
+		}
+		marker, seglen := hdr[1], int64(binary.BigEndian.Uint16(hdr[2:4]))
+		if marker == 0xDA || marker == 0xD9 || seglen < 2 {
+			// (the image data has started - EXIF comes before it)
+			return ""
+		}
+		if marker == 0xE1 && seglen > 8 {
+			seg := make([]byte, seglen-2)
+			if _, err := f.ReadAt(seg, pos+4); err != nil {
+				return ""
+			}
+			if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+				return exifTaken(seg[6:])
+			}
+		}
+		pos += 2 + seglen
+	}
+}
+
+// DateTimeOriginal (in the EXIF IFD), else DateTime (in IFD0), from a TIFF-structured EXIF block
+func exifTaken(tiff []byte) string {
+	var bo binary.ByteOrder
+	switch {
+	case len(tiff) < 8:
+		return ""
+	case string(tiff[0:2]) == "II":
+		bo = binary.LittleEndian
+	case string(tiff[0:2]) == "MM":
+		bo = binary.BigEndian
+	default:
+		return ""
+	}
+
+	// a tag's count and value (or offset to it) in the IFD at off
+	find := func(off uint32, tag uint16) (count uint32, val uint32, ok bool) {
+		if int64(off)+2 > int64(len(tiff)) {
+			return 0, 0, false
+		}
+		n := int64(bo.Uint16(tiff[off:]))
+		for x := int64(0); x < n; x++ {
+			e := int64(off) + 2 + x*12
+			if e+12 > int64(len(tiff)) {
+				break
+			}
+			if bo.Uint16(tiff[e:]) == tag {
+				return bo.Uint32(tiff[e+4:]), bo.Uint32(tiff[e+8:]), true
+			}
+		}
+		return 0, 0, false
+	}
+	// an EXIF date ("2006:01:02 15:04:05") as ISO 8601
+	date := func(count uint32, val uint32) string {
+		if count < 19 || int64(val)+19 > int64(len(tiff)) {
+			return ""
+		}
+		t, err := time.Parse("2006:01:02 15:04:05", string(tiff[val:val+19]))
+		if err != nil {
+			return ""
+		}
+		return t.Format("2006-01-02T15:04:05")
+	}
+
+	ifd0 := bo.Uint32(tiff[4:8])
+	if _, sub, ok := find(ifd0, 0x8769); ok {
+		if count, val, ok := find(sub, 0x9003); ok {
+			if s := date(count, val); s != "" {
+				return s
+			}
+		}
+	}
+	if count, val, ok := find(ifd0, 0x0132); ok {
+		return date(count, val)
+	}
+	return ""
+}
+
+// ----------------------- Photo duplicates (dup --photos) -----------------------
+
+// Exact copies of a photo share a SHA, but the same shot is often kept in several versions that do not -
+// re-saved, with its metadata edited, or exported again.  Those still have the same pixel size and the
+// same EXIF date, so photos matching on both are reported as probable duplicates, for a person to judge.
+
+// photos sharing a SHA (exact) or a pixel size and date taken (probable)
+type photoGroup struct {
+	Sha   string   `json:"sha,omitempty"`
+	Res   string   `json:"res,omitempty"`
+	Taken string   `json:"taken,omitempty"`
+	Shas  int      `json:"shas,omitempty"` // different contents in a probable group
+	Files []string `json:"files"`
+}
+
+func dupPhotos(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case num != 1:
+		abort(9, "Need one SSF file for --photos")
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case !slices.Contains([]string{"text", "json"}, cli_output):
+		abort(6, "Invalid --output '"+cli_output+"' with --photos (valid: text, json - probable duplicates need a person to judge)")
+	}
+
+	// the photos (records with a pixel size but no duration or codec), by SHA and by size/date
+	var nphotos int
+	bySha := map[string][]string{}
+	byShot := map[string][]ssfRecord{}
+	ssfForEachRecord(files[0], func(rec ssfRecord) {
+		m := annotationMap(rec.annot)
+		if m["res"] == "" || m["dur"] != "" || m["vcodec"] != "" || entryIsSpecial(rec) {
+			return
+		}
+		nphotos++
+		bySha[rec.shab64] = append(bySha[rec.shab64], rec.name)
+		if m["taken"] != "" {
+			byShot[m["res"]+" "+m["taken"]] = append(byShot[m["res"]+" "+m["taken"]], rec)
+		}
+	})
+	if nphotos == 0 {
+		abort(6, "SSF '"+files[0]+"' has no photo annotations (generate it with --annotate media)")
+	}
+
+	var exact, probable = []photoGroup{}, []photoGroup{}
+	for _, sha := range slices.Sorted(maps.Keys(bySha)) {
+		if len(bySha[sha]) > 1 {
+			exact = append(exact, photoGroup{Sha: sha, Files: bySha[sha]})
+		}
+	}
+	for _, shot := range slices.Sorted(maps.Keys(byShot)) {
+		recs := byShot[shot]
+		shas := map[string]bool{}
+		for _, rec := range recs {
+			shas[rec.shab64] = true
+		}
+		if len(shas) < 2 {
+			continue // (all the same - already an exact group, if more than one)
+		}
+		res, taken, _ := strings.Cut(shot, " ")
+		g := photoGroup{Res: res, Taken: taken, Shas: len(shas)}
+		for _, rec := range recs {
+			g.Files = append(g.Files, rec.name)
+		}
+		probable = append(probable, g)
+	}
+
+	if cli_output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string][]photoGroup{"exact": exact, "probable": probable})
+		return
+	}
+
+	fmt.Printf("%d photos in %s: %d exact duplicate groups, %d probable\n", nphotos, files[0], len(exact), len(probable))
+	if len(exact) > 0 {
+		fmt.Println("Exact duplicates (same SHA):")
+		for _, g := range exact {
+			if cli_incsha {
+				fmt.Printf("  %d copies  # %s\n", len(g.Files), g.Sha)
+			} else {
+				fmt.Printf("  %d copies\n", len(g.Files))
+			}
+			for _, n := range g.Files {
+				fmt.Println("    " + n)
+			}
+		}
+	}
+	if len(probable) > 0 {
+		fmt.Println("Probable duplicates (same pixel size and date taken, different SHA):")
+		for _, g := range probable {
+			fmt.Printf("  %s taken %s (%d versions)\n", g.Res, g.Taken, g.Shas)
+			for _, n := range g.Files {
+				fmt.Println("    " + n)
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ----------------------- Progress endpoint (--check) -----------------------
+
+// A generate or update of a big server can take hours, so with --check the progress is served as JSON,
+// to be watched from elsewhere rather than as dots over SSH, e.g.
+//    curl localhost:8080/progress   =>  {"command":"generate","files_done":1234,"bytes_done":...,"eta":...}
+// The ETA is from a quick count of the tree (with the same walk options), made in the background (so it
+// is an estimate - and absent until the count is done).  Only --check shows an ETA, so only it counts.
+// With --progress, a status line on stderr gives the directory being read and the file being hashed, each
+// with how long it has taken so far, and the directories done - so that a long hash of a big file can be
+// told from a walk stuck on a dead (NFS) mount.
+
+var cli_check string = ""     // port (or address) to serve progress on, e.g. 8080
+var cli_progress bool = false // show the current directory and file on stderr
+
+type progressStatus struct {
+	Command    string  `json:"command"`
+	State      string  `json:"state"` // "running" or "done"
+	Started    string  `json:"started"`
+	Elapsed    float64 `json:"elapsed_secs"`
+	FilesDone  int64   `json:"files_done"`
+	BytesDone  int64   `json:"bytes_done"`
+	FilesRate  float64 `json:"files_per_sec"`
+	BytesRate  float64 `json:"bytes_per_sec"`
+	FilesTotal int64   `json:"files_total,omitempty"` // (estimated)
+	BytesTotal int64   `json:"bytes_total,omitempty"`
+	ETA        string  `json:"eta,omitempty"`
+	Current    string  `json:"current"`
+	DirsDone   int64   `json:"dirs_done"`
+	Dir        string  `json:"dir"`      // being read by the walker
+	DirSecs    float64 `json:"dir_secs"` // (for how long)
+	Hashing    string  `json:"hashing"`  // being hashed (the latest started, with several workers)
+	HashSecs   float64 `json:"hashing_secs"`
+}
+
+var progress = struct {
+	sync.Mutex
+	progressStatus
+	on       bool
+	start    time.Time
+	dirStart time.Time
+	hashFrom time.Time
+}{}
+
+// serve (or show) the progress, if asked for - in the background, for the life of the process
+func progressServe(command string, startpath string, opts walkOptions) {
+	if cli_check == "" && !cli_progress {
+		return
+	}
+	progress.on = true
+	progress.start = time.Now()
+	progress.Command, progress.State, progress.Started = command, "running", progress.start.UTC().Format(time.RFC3339)
+
+	if cli_progress {
+		go progressShow()
+	}
+	if cli_check == "" {
+		return
+	}
+
+	// count the tree, for the ETA (as the walk will find it)
+	go func() {
+		var files, nbytes int64
+		c := make(chan triplex, 4096)
+		go func() {
+			defer close(c)
+			opts.quiet = true
+			walkTreeToChannel(startpath, opts, c)
+		}()
+		for t := range c {
+			files++
+			nbytes += t.size
+		}
+		progress.Lock()
+		progress.FilesTotal, progress.BytesTotal = files, nbytes
+		progress.Unlock()
+	}()
+
+	addr := cli_check
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(progressNow())
+	})
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			abort(4, "Cannot serve --check on "+addr+": "+err.Error())
+		}
+	}()
+}
+
+// note a file dealt with
+func progressNote(name string, size int64) {
+	if !progress.on {
+		return
+	}
+	progress.Lock()
+	progress.FilesDone++
+	progress.BytesDone += size
+	progress.Current = name
+	progress.Unlock()
+}
+
+// note the walker starting to read a directory, or ("") finishing one
+func progressDir(name string) {
+	if !progress.on {
+		return
+	}
+	progress.Lock()
+	if name == "" {
+		progress.DirsDone++
+		progress.Dir = ""
+	} else {
+		progress.Dir, progress.dirStart = name, time.Now()
+	}
+	progress.Unlock()
+}
+
+// note a file starting to be hashed
+func progressHashing(name string) {
+	if !progress.on {
+		return
+	}
+	progress.Lock()
+	progress.Hashing, progress.hashFrom = name, time.Now()
+	progress.Unlock()
+}
+
+// and finishing (if another has not started since)
+func progressHashed(name string) {
+	if !progress.on {
+		return
+	}
+	progress.Lock()
+	if progress.Hashing == name {
+		progress.Hashing = ""
+	}
+	progress.Unlock()
+}
+
+func progressDone() {
+	if !progress.on {
+		return
+	}
+	progress.Lock()
+	progress.State, progress.Current, progress.Dir, progress.Hashing = "done", "", "", ""
+	progress.Unlock()
+	if cli_progress {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
+
+// the status line (every second, until done)
+func progressShow() {
+	// (the end of a long name is the part that says most)
+	short := func(name string) string {
+		if len(name) > 40 {
+			return "..." + name[len(name)-37:]
+		}
+		return name
+	}
+	for range time.Tick(time.Second) {
+		st := progressNow()
+		if st.State == "done" {
+			return
+		}
+		line := fmt.Sprintf("%s dirs, %s files, %s", intAsString(st.DirsDone), intAsString(st.FilesDone), bytesAsString(st.BytesDone))
+		if st.Dir != "" {
+			line += fmt.Sprintf(" | reading %s (%.0fs)", short(st.Dir), st.DirSecs)
+		}
+		if st.Hashing != "" {
+			line += fmt.Sprintf(" | hashing %s (%.0fs)", short(st.Hashing), st.HashSecs)
+		}
+		fmt.Fprint(os.Stderr, "\r\033[K"+line)
+	}
+}
+
+// the progress so far, with the rates and ETA worked out
+func progressNow() progressStatus {
+	progress.Lock()
+	st := progress.progressStatus
+	if st.Dir != "" {
+		st.DirSecs = float64(int64(time.Since(progress.dirStart).Seconds()*10)) / 10
+	}
+	if st.Hashing != "" {
+		st.HashSecs = float64(int64(time.Since(progress.hashFrom).Seconds()*10)) / 10
+	}
+	progress.Unlock()
+
+	elapsed := time.Since(progress.start).Seconds()
+	st.Elapsed = float64(int64(elapsed*10)) / 10
+	if elapsed > 0 {
+		st.FilesRate = float64(int64(float64(st.FilesDone)/elapsed*10)) / 10
+		st.BytesRate = float64(int64(float64(st.BytesDone) / elapsed))
+	}
+	if st.State == "running" && st.BytesTotal > 0 && st.BytesRate > 0 {
+		left := max(st.BytesTotal-st.BytesDone, 0)
+		st.ETA = time.Now().Add(time.Duration(float64(left)/st.BytesRate) * time.Second).UTC().Format(time.RFC3339)
+	}
+	return st
+}
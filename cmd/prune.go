@@ -0,0 +1,161 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune file.ssf [out.ssf] --drop glob...",
+	Short: "Remove the records matching path globs from an SSF",
+	Long: `shaman prune file.ssf [out.ssf] --drop glob [--drop glob...]
+Writes a copy of an SSF without the records whose names match any of the globs, and says how many
+records (and bytes) were dropped - the SSF side of leaving things out of a scan:
+   shaman prune home.ssf lean.ssf --drop '**/cache/**' --drop '*.tmp'
+In a glob, * and ? match within a part of the path, ** matches any number of parts, and [...] a set.
+A glob with a '/' in it is matched against the whole name, one without against the base name (so
+'*.tmp' drops .tmp files anywhere).  Without out.ssf, the records that would be dropped are listed and
+nothing is written.`,
+	Args:    cobra.RangeArgs(1, 2),
+	GroupID: "G1",
+	Run: func(cmd *cobra.Command, args []string) {
+		pru(args)
+	},
+}
+
+var cli_drop []string // globs of records to drop
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().StringArrayVarP(&cli_drop, "drop", "d", nil, "Drop records matching this glob (repeatable)")
+	pruneCmd.MarkFlagRequired("drop")
+}
+
+// ----------------------- Prune function below this line -----------------------
+
+// a path glob as a regular expression - * and ? stop at '/', ** does not (and '**/' can match nothing)
+func pathGlobToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for x := 0; x < len(glob); x++ {
+		switch c := glob[x]; {
+		case strings.HasPrefix(glob[x:], "**/"):
+			b.WriteString("(.*/)?")
+			x += 2
+		case strings.HasPrefix(glob[x:], "**"):
+			b.WriteString(".*")
+			x++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[x+1:], ']'); end > 0 {
+				set := glob[x+1 : x+1+end]
+				if set[0] == '!' {
+					set = "^" + set[1:]
+				}
+				b.WriteString("[" + strings.ReplaceAll(set, `\`, `\\`) + "]")
+				x += end + 1
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func pru(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case !found[0]:
+		abort(6, "SSF file '"+files[0]+"' does not exist")
+	case num == 2 && found[1]:
+		abort(6, "Output file '"+files[1]+"' already exists")
+	}
+
+	// each glob, and whether it is for the whole name
+	type dropGlob struct {
+		re    *regexp.Regexp
+		whole bool
+	}
+	var globs []dropGlob
+	for _, g := range cli_drop {
+		re, err := regexp.Compile(pathGlobToRegexp(g))
+		if err != nil {
+			abort(6, "Invalid --drop '"+g+"': "+err.Error())
+		}
+		globs = append(globs, dropGlob{re, strings.Contains(g, "/")})
+	}
+	dropped := func(name string) bool {
+		name = strings.TrimSuffix(name, "/")
+		for _, g := range globs {
+			if (g.whole && g.re.MatchString(name)) || (!g.whole && g.re.MatchString(path.Base(name))) {
+				return true
+			}
+		}
+		return false
+	}
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+	var w *writeSSF
+	if num == 2 {
+		w = writeInit(files[1])
+	}
+
+	// kept records (and comments) are copied as they are
+	var ndrop, nkeep, nbytes int64
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if len(s) == 0 || s[0:1] == "#" {
+			if w != nil {
+				fmt.Fprintln(w, s)
+			}
+			continue
+		}
+		rec, ok := parseSSFRecord(s)
+		if ok && rec.format < 4 {
+			abort(6, "SSF '"+files[0]+"' is anonymous - names are needed to prune")
+		}
+		if !ok || !dropped(rec.name) {
+			nkeep++
+			if w != nil {
+				fmt.Fprintln(w, s)
+			}
+			continue
+		}
+		ndrop++
+		nbytes += decodeHex(rec.size)
+		if w == nil {
+			fmt.Println("Drop: " + rec.name)
+		}
+	}
+
+	if w != nil {
+		w.close()
+		fmt.Printf("Dropped %d records (%s) from %s - %d kept in %s\n", ndrop, bytesAsString(nbytes), files[0], nkeep, files[1])
+	} else {
+		fmt.Printf("Would drop %d records (%s), keeping %d (nothing written - give out.ssf)\n", ndrop, bytesAsString(nbytes), nkeep)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ----------------------- Quick (partial) hashing -----------------------
+
+// With --quick head=N, files larger than N bytes are hashed on their first N bytes plus their size only,
+// and the record carries a 'quick=head:N' annotation saying so.  Such a hash is only good for finding
+// candidates: compare and duplicates compute the full hash (from the files on disk) for any quick hash
+// that matches another, and leave the rest alone.  Files of N bytes or less are always hashed in full.
+
+var cli_quick string = "" // partial hashing specification, e.g. "head=1M"
+var quickHead int64 = 0   // bytes to hash when --quick is in use (0=off)
+
+// check and apply the --quick switch
+func quickValidate() {
+	if cli_quick == "" {
+		return
+	}
+	k, v, _ := strings.Cut(cli_quick, "=")
+	n, ok := int64(0), false
+	if k == "head" && v != "" {
+		n, ok = parseByteSize(v)
+	}
+	if !ok {
+		abort(6, "Invalid --quick '"+cli_quick+"' (expected e.g. head=1M)")
+	}
+	quickHead = n
+}
+
+// the annotation marking a record's hash as partial
+func quickAnnotation(head int64) string {
+	return "quick=head:" + strconv.FormatInt(head, 10)
+}
+
+// the head size from a record's annotations (0 if it has a full hash)
+func quickAnnotated(annot string) int64 {
+	v, ok := annotationMap(annot)["quick"]
+	if !ok || !strings.HasPrefix(v, "head:") {
+		return 0
+	}
+	n, _ := strconv.ParseInt(v[5:], 10, 64)
+	return n
+}
+
+// hash the first 'head' bytes of a file followed by its size (big-endian, 8 bytes)
+func getFileQuickSha256(fn string, head int64, size int64) string {
+	progressHashing(fn)
+	defer progressHashed(fn)
+	f, err := os.Open(fn)
+	if err != nil && errorsOn() {
+		fileError("file", fn, err)
+		return ""
+	} else if err != nil {
+		abort(13, "Found file cannot be opened: "+fn)
+	}
+	defer f.Close()
+
+	start := time.Now()
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, head); err != nil && errorsOn() {
+		fileError("file", fn, err)
+		return ""
+	} else if err != nil {
+		abort(14, "Found file cannot be processed: "+fn)
+	}
+	if hashStats.on {
+		statsHashed(fn, head, time.Since(start))
+	}
+	binary.Write(h, binary.BigEndian, size)
+	return b64.StdEncoding.EncodeToString(h.Sum(nil))[0:43]
+}
+
+// hash a file the way --quick asks - returns the hash and the annotation to add ("" for a full hash)
+func getFileSha256Quick(fn string, size int64, head int64) (string, string) {
+	if cli_dirs || cli_links || cli_specials {
+		// (directory, link and special records are never quick)
+		if kind, _ := entrySpecial(fn); strings.HasSuffix(fn, "/") || entryLink(fn) != "" || kind != "" {
+			return getEntrySha256(fn), ""
+		}
+	}
+	if head == 0 || size <= head {
+		_, sha := getFileSha256(fn)
+		return sha, ""
+	}
+	sha := getFileQuickSha256(fn, head, size)
+	if sha == "" {
+		return "", "" // (unreadable - see fileError)
+	}
+	return sha, quickAnnotation(head)
+}
+
+// add an annotation to an annotation string
+func annotationAdd(annot string, extra string) string {
+	if annot == "" || extra == "" {
+		return annot + extra
+	}
+	return annot + " " + extra
+}
+
+// Replace quick hashes that match another record (in any of the SSFs) by full hashes computed from the
+// files under root, writing the results to temporary SSFs.  Files without quick records are returned as is,
+// and the cleanup function removes any temporary files.
+func quickResolve(files []string, root string) ([]string, func()) {
+	// count the quick hashes across all the files
+	var count = map[string]int{}
+	var any bool
+	for _, fn := range files {
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			if quickAnnotated(rec.annot) > 0 {
+				any = true
+			}
+			count[rec.shab64]++
+		})
+	}
+	if !any {
+		return files, func() {}
+	}
+
+	var out []string
+	var resolved, unresolved int
+	for _, fn := range files {
+		tmp, err := os.CreateTemp("", "shaman-*.ssf")
+		if err != nil {
+			abort(4, "Cannot create temporary file")
+		}
+		w := bufio.NewWriter(tmp)
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			if head := quickAnnotated(rec.annot); head > 0 && count[rec.shab64] > 1 {
+				name := path.Join(root, rec.name)
+				if _, err := os.Stat(name); err == nil {
+					_, rec.shab64 = getFileSha256(name)
+					rec.annot = strings.TrimSpace(strings.Replace(rec.annot, quickAnnotation(head), "", 1))
+					resolved++
+				} else {
+					fmt.Fprintln(os.Stderr, "Quick hash cannot be confirmed (file not found): "+rec.name)
+					unresolved++
+				}
+			}
+			fmt.Fprintln(w, ssfRecordLine(rec))
+		})
+		w.Flush()
+		tmp.Close()
+		out = append(out, tmp.Name())
+	}
+	fmt.Fprintf(os.Stderr, "Quick hashes: %d candidates fully hashed, %d could not be confirmed\n", resolved, unresolved)
+
+	return out, func() {
+		for _, fn := range out {
+			os.Remove(fn)
+		}
+	}
+}
+
+// call fn for every parseable record of an SSF
+func ssfForEachRecord(fn string, f func(rec ssfRecord)) {
+	r, err := ssfOpen(fn)
+	if err != nil {
+		abort(4, "Can't open "+fn+" - stuck!")
+	}
+	defer r.Close()
+
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if len(s) == 0 || s[0:1] == "#" {
+			continue
+		}
+		if rec, ok := parseSSFRecord(s); ok {
+			f(rec)
+		}
+	}
+}
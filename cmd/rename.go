@@ -100,10 +100,15 @@ func ren(args []string) {
 	if cli_path != "" {
 		startpath = cli_path // add validation here
 	}
+	// (--cwd is the top directory only)
+	opts := walkOptionsFromFlags()
+	if cli_cwd {
+		opts.maxDepth = 1
+	}
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
 	// count and compute length of longest line
@@ -112,15 +117,6 @@ func ren(args []string) {
 	var fn string
 	for filerec := range fileQueue {
 		fn = filerec.filename
-		// reject - no dot
-		if cli_nodot && (fn[0:1] == "." || strings.Index(fn, "/.") > 0) {
-			continue
-		}
-		// reject - cwd only
-		if cli_cwd && strings.Index(fn, "/") > 0 {
-			continue
-		}
-
 		numFiles++
 		fn = "\"" + strings.Replace(fn, "\"", "\\\"", -1) + "\""
 		if len(fn) > longest {
@@ -137,7 +133,7 @@ func ren(args []string) {
 	fileQueue = make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
 	// create move list *FIXME* needs pre-sizing
@@ -146,15 +142,6 @@ func ren(args []string) {
 	for filerec := range fileQueue {
 		fn = filerec.filename
 
-		// no dot
-		if cli_nodot && (fn[0:1] == "." || strings.Index(fn, "/.") > 0) {
-			continue
-		}
-
-		// cwd only
-		if cli_cwd && strings.Index(fn, "/") > 0 {
-			continue
-		}
 		// fmt.Println(fn)
 
 		source := "\"" + strings.Replace(fn, "\"", "\\\"", -1) + "\""
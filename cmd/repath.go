@@ -6,10 +6,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
-	"bufio"
 	"fmt"
-	"os"
-	"strings"
 )
 
 // -------------------------------- Cobra management -------------------------------
@@ -22,6 +19,7 @@ var repathCmd = &cobra.Command{
 Produces a modified version of the ssf file with the filenames prefixed by the given string.
 Performs the "unfix" first, and the "prefix" second.
 Writes to stdout if no second file.  Writes errors for any lines that 'unfix' cannot process.
+With --dry-run, nothing is written: the number of lines that would be, and where, is reported instead.
 `,
 	Aliases: []string{"repath"},
 	Args:    cobra.MaximumNArgs(2),
@@ -36,6 +34,7 @@ func init() {
 
 	repathCmd.Flags().StringVarP(&cli_unfix, "unfix", "", "", "Path to remove from filenames")
 	repathCmd.Flags().StringVarP(&cli_prefix, "prefix", "", "", "Path to add to filenames")
+	repathCmd.Flags().BoolVarP(&cli_dryrun, "dry-run", "n", false, "Do everything but write: report what would be written, touching no file")
 }
 
 // ----------------------- Repath function below this line -----------------------
@@ -60,6 +59,13 @@ func repath(args []string) {
 	if !found[0] {
 		abort(8, "Cannot find "+fnr)
 	}
+	fnw := ""
+	if num == 2 {
+		fnw = files[1]
+		if found[1] {
+			abort(6, "Output file '"+fnw+"' already exists")
+		}
+	}
 
 	len_unfix := len(cli_unfix)
 	len_prefix := len(cli_prefix)
@@ -67,16 +73,17 @@ func repath(args []string) {
 		abort(4, "No action to be performed!")
 	}
 
-	var r *os.File
-	r, err := os.Open(fnr)
+	var r *ssfFile
+	r, err := ssfOpen(fnr)
 	if err != nil {
 		abort(4, "Can't open "+fnr+" - stuck!")
 	}
 	defer r.Close()
+	w := writeInit(fnw)
 
 	var s string
 	var lineno int
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 
 	for scanner.Scan() {
 		s = scanner.Text()
@@ -87,11 +94,17 @@ func repath(args []string) {
 			continue
 		}
 
-		// get rest of fields
-		pos1 := strings.Index(s, " ")
-		id := s[0:pos1]
-		pos2 := strings.Index(s, " :")
-		name := s[pos2+2:]
+		// get rest of fields (id keeps any annotations)
+		rec, ok := parseSSFRecord(s)
+		if !ok || rec.format < 4 {
+			fmt.Printf("Line %d: invalid or anonymous record\n", lineno)
+			continue
+		}
+		id := rec.shab64 + rec.modtime + rec.size
+		if rec.annot != "" {
+			id += " " + rec.annot
+		}
+		name := rec.name
 		len_name := len(name)
 
 		// perform unfix
@@ -115,8 +128,8 @@ func repath(args []string) {
 			// fmt.Println(name)
 		}
 
-		fmt.Printf("%s :%s\n", id, name)
+		fmt.Fprintf(w, "%s :%s\n", id, name)
 	}
 
-	//w.Flush()
+	w.close()
 }
@@ -0,0 +1,445 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report file.ssf report.html | --diff old.ssf new.ssf diff.html",
+	Short: "Write a self-contained HTML report of an SSF, or of the changes between two",
+	Long: `shaman report file.ssf report.html [-c count]
+Writes a single HTML page (no external files or scripts) describing the manifest: its totals and dates,
+a chart of space used by file extension, and sortable tables of the biggest files, the latest files and
+the duplicated files (those wasting the most space first).  Click a column heading to sort by it.
+
+shaman report --diff old.ssf new.ssf diff.html
+Writes a page of the changes from old to new, for reviewing with people who would rather not read update
+output: files added (green), removed (red), changed (yellow) and moved (blue - the same contents under a
+new name), with the number of changes in each directory.`,
+	Args:    cobra.RangeArgs(2, 3),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		rep(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().IntVarP(&cli_count, "count", "c", 50, "Number of rows in each table")
+	reportCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Overwrite the output file if it exists")
+	reportCmd.Flags().BoolVarP(&cli_reportdiff, "diff", "", false, "Report the changes between two SSFs")
+}
+
+var cli_reportdiff bool = false // report --diff
+
+// ----------------------- Report function below this line -----------------------
+
+// The page layout shared by the HTML reports - each report supplies a "body" template
+const reportLayout = `<!DOCTYPE html>
+<html lang="en"><head><meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; } h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; font-size: 0.9em; }
+th, td { padding: 0.25em 0.75em; text-align: left; border-bottom: 1px solid #eee; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+th.sorted-asc::after { content: " \25B2"; } th.sorted-desc::after { content: " \25BC"; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+td.sha { font-family: monospace; font-size: 0.85em; color: #666; }
+.bar { background: #4a7ebb; height: 1em; display: inline-block; vertical-align: middle; }
+.meta td:first-child { font-weight: bold; }
+.new { background: #e6f4e6; } .del { background: #fbe6e6; } .chg { background: #fff6d6; } .mov { background: #e6eefb; }
+footer { margin-top: 3em; font-size: 0.8em; color: #888; }
+</style></head><body>
+<h1>{{.Title}}</h1>
+{{template "body" .}}
+<footer>Generated by shaman on {{.Generated}}</footer>
+<script>
+// click a heading to sort its table (cells may carry a data-v sort value)
+document.querySelectorAll("table.sortable th").forEach(function (th, col) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table"), body = table.tBodies[0];
+    var asc = !th.classList.contains("sorted-asc");
+    table.querySelectorAll("th").forEach(function (h) { h.classList.remove("sorted-asc", "sorted-desc"); });
+    th.classList.add(asc ? "sorted-asc" : "sorted-desc");
+    var idx = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var key = function (tr) { var c = tr.children[idx]; return c.dataset.v !== undefined ? c.dataset.v : c.textContent; };
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function (a, b) {
+      var x = key(a), y = key(b), nx = parseFloat(x), ny = parseFloat(y);
+      var r = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+      return asc ? r : -r;
+    });
+    rows.forEach(function (r) { body.appendChild(r); });
+  });
+});
+</script>
+</body></html>
+`
+
+const reportSummaryBody = `{{define "body"}}
+<table class="meta">
+<tr><td>Manifest</td><td>{{.File}}</td></tr>
+<tr><td>Manifest date</td><td>{{.FileTime}}</td></tr>
+<tr><td>Files</td><td>{{.Files}}</td></tr>
+<tr><td>Total size</td><td>{{.Bytes}} bytes</td></tr>
+<tr><td>Unique contents</td><td>{{.Unique}}</td></tr>
+<tr><td>Duplicated files</td><td>{{.DupFiles}} extra copies, {{.Wasted}} bytes</td></tr>
+<tr><td>Modify times</td><td>{{.Oldest}} to {{.Newest}}</td></tr>
+{{range .Comments}}<tr><td>Comment</td><td>{{.}}</td></tr>{{end}}
+</table>
+
+<h2>Size by extension</h2>
+<table class="sortable"><thead><tr><th>Extension</th><th>Files</th><th>Bytes</th><th>Share</th></tr></thead><tbody>
+{{range .Exts}}<tr><td>{{.Ext}}</td><td class="num" data-v="{{.Files}}">{{commas .Files}}</td><td class="num" data-v="{{.Bytes}}">{{commas .Bytes}}</td>
+<td data-v="{{.Bytes}}"><span class="bar" style="width:{{.Width}}px"></span> {{.Percent}}%</td></tr>
+{{end}}</tbody></table>
+
+<h2>Biggest files</h2>
+<table class="sortable"><thead><tr><th>Size</th><th>Modified</th><th>Name</th></tr></thead><tbody>
+{{range .Biggest}}<tr><td class="num" data-v="{{.Size}}">{{commas .Size}}</td><td data-v="{{.Time}}">{{when .Time}}</td><td>{{.Name}}</td></tr>
+{{end}}</tbody></table>
+
+<h2>Latest files</h2>
+<table class="sortable"><thead><tr><th>Modified</th><th>Size</th><th>Name</th></tr></thead><tbody>
+{{range .Latest}}<tr><td data-v="{{.Time}}">{{when .Time}}</td><td class="num" data-v="{{.Size}}">{{commas .Size}}</td><td>{{.Name}}</td></tr>
+{{end}}</tbody></table>
+
+<h2>Duplicates</h2>
+<table class="sortable"><thead><tr><th>Wasted</th><th>Copies</th><th>Size</th><th>Files</th><th>SHA256</th></tr></thead><tbody>
+{{range .Dupes}}<tr><td class="num" data-v="{{.Wasted}}">{{commas .Wasted}}</td><td class="num">{{.Copies}}</td><td class="num" data-v="{{.Size}}">{{commas .Size}}</td>
+<td>{{range $i, $n := .Names}}{{if $i}}<br>{{end}}{{$n}}{{end}}</td><td class="sha">{{.Sha}}</td></tr>
+{{end}}</tbody></table>
+{{end}}`
+
+// a file row in a report table
+type reportFile struct {
+	Name string
+	Size int64
+	Time int64
+}
+
+// the functions available to the report templates
+var reportFuncs = template.FuncMap{
+	"commas": intAsString,
+	"when": func(secs int64) string {
+		return time.Unix(secs, 0).Format(time.DateTime)
+	},
+}
+
+// render a report page (layout + body) to a file
+func reportWrite(fnw string, body string, data any) {
+	t := template.Must(template.New("page").Funcs(reportFuncs).Parse(reportLayout))
+	template.Must(t.Parse(body))
+	f, err := os.Create(fnw)
+	if err != nil {
+		abort(4, "Cannot create file "+fnw)
+	}
+	defer f.Close()
+	if err := t.Execute(f, data); err != nil {
+		abort(4, "Cannot write report: "+err.Error())
+	}
+}
+
+// keep the best n of a growing list (sorting and trimming only when it has doubled, to bound the work)
+func reportKeep(list []reportFile, n int, better func(a, b reportFile) int, final bool) []reportFile {
+	if len(list) < 2*n && !final {
+		return list
+	}
+	slices.SortStableFunc(list, better)
+	return list[:min(n, len(list))]
+}
+
+func rep(args []string) {
+	if cli_reportdiff {
+		if len(args) != 3 {
+			abort(6, "--diff needs old.ssf new.ssf diff.html")
+		}
+		reportDiff(args)
+		return
+	}
+	if len(args) != 2 {
+		abort(6, "report needs file.ssf report.html (or --diff old.ssf new.ssf diff.html)")
+	}
+
+	num, files, found := getSSFs(args[0:1])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+	fnr, fnw := files[0], args[1]
+	if _, err := os.Stat(fnw); err == nil && !cli_overwrite {
+		abort(6, "Output file '"+fnw+"' already exists (use --overwrite)")
+	}
+	n := max(cli_count, 1)
+
+	bigger := func(a, b reportFile) int { return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Name, b.Name)) }
+	later := func(a, b reportFile) int { return cmp.Or(cmp.Compare(b.Time, a.Time), strings.Compare(a.Name, b.Name)) }
+
+	// first pass - totals, extensions, biggest and latest
+	type extRow struct {
+		Ext          string
+		Files, Bytes int64
+		Width        int
+		Percent      string
+	}
+	var exts = map[string]*extRow{}
+	var copies = map[string]int{}
+	var biggest, latest []reportFile
+	var nfiles, nbytes int64
+	var oldest, newest int64 = 1 << 62, 0
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if rec.format < 4 {
+			abort(6, "SSF '"+fnr+"' is anonymous - the report needs names")
+		}
+		f := reportFile{rec.name, decodeHex(rec.size), decodeHex(rec.modtime)}
+		nfiles++
+		nbytes += f.Size
+		oldest, newest = min(oldest, f.Time), max(newest, f.Time)
+		copies[rec.shab64]++
+
+		ext := fileExtension(rec.name)
+		if exts[ext] == nil {
+			exts[ext] = &extRow{Ext: ext}
+		}
+		exts[ext].Files++
+		exts[ext].Bytes += f.Size
+
+		biggest = reportKeep(append(biggest, f), n, bigger, false)
+		latest = reportKeep(append(latest, f), n, later, false)
+	})
+	if nfiles == 0 {
+		abort(6, "SSF '"+fnr+"' has no records")
+	}
+	biggest = reportKeep(biggest, n, bigger, true)
+	latest = reportKeep(latest, n, later, true)
+
+	// extensions by size, with a bar scaled to the largest
+	extRows := slices.Collect(maps.Values(exts))
+	slices.SortFunc(extRows, func(a, b *extRow) int { return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.Ext, b.Ext)) })
+	extRows = extRows[:min(len(extRows), n)]
+	for _, e := range extRows {
+		e.Width = int(400 * e.Bytes / max(extRows[0].Bytes, 1))
+		e.Percent = fmt.Sprintf("%.1f", 100*float64(e.Bytes)/float64(max(nbytes, 1)))
+	}
+
+	// second pass - the duplicated files
+	type dupRow struct {
+		Sha          string
+		Size, Wasted int64
+		Copies       int
+		Names        []string
+	}
+	var dupes = map[string]*dupRow{}
+	var dupFiles, wasted int64
+	ssfForEachRecord(fnr, func(rec ssfRecord) {
+		if copies[rec.shab64] < 2 {
+			return
+		}
+		d := dupes[rec.shab64]
+		if d == nil {
+			d = &dupRow{Sha: rec.shab64, Size: decodeHex(rec.size), Copies: copies[rec.shab64]}
+			d.Wasted = d.Size * int64(d.Copies-1)
+			dupes[rec.shab64] = d
+			dupFiles += int64(d.Copies - 1)
+			wasted += d.Wasted
+		}
+		d.Names = append(d.Names, rec.name)
+	})
+	dupRows := slices.Collect(maps.Values(dupes))
+	slices.SortFunc(dupRows, func(a, b *dupRow) int {
+		return cmp.Or(cmp.Compare(b.Wasted, a.Wasted), strings.Compare(a.Names[0], b.Names[0]))
+	})
+	dupRows = dupRows[:min(len(dupRows), n)]
+
+	// header comments (e.g. the generating command) are shown as metadata
+	var comments []string
+	if r, err := ssfOpen(fnr); err == nil {
+		scanner := ssfScanner(r)
+		for lines := 0; lines < 20 && scanner.Scan(); lines++ {
+			s := scanner.Text()
+			if !strings.HasPrefix(s, "#") {
+				break
+			}
+			comments = append(comments, strings.TrimSpace(s[1:]))
+		}
+		r.Close()
+	}
+	fileTime := ""
+	if st, err := os.Stat(fnr); err == nil {
+		fileTime = st.ModTime().Format(time.DateTime)
+	}
+
+	reportWrite(fnw, reportSummaryBody, map[string]any{
+		"Title":     "Manifest report: " + path.Base(fnr),
+		"Generated": time.Now().Format(time.DateTime),
+		"File":      fnr,
+		"FileTime":  fileTime,
+		"Files":     intAsString(nfiles),
+		"Bytes":     intAsString(nbytes),
+		"Unique":    intAsString(int64(len(copies))),
+		"DupFiles":  intAsString(dupFiles),
+		"Wasted":    intAsString(wasted),
+		"Oldest":    time.Unix(oldest, 0).Format(time.DateTime),
+		"Newest":    time.Unix(newest, 0).Format(time.DateTime),
+		"Comments":  comments,
+		"Exts":      extRows,
+		"Biggest":   biggest,
+		"Latest":    latest,
+		"Dupes":     dupRows,
+	})
+	fmt.Printf("Report of %s files written to %s\n", intAsString(nfiles), fnw)
+}
+
+// ----------------------- Diff report -----------------------
+
+const reportDiffBody = `{{define "body"}}
+<table class="meta">
+<tr><td>Old manifest</td><td>{{.Old}}</td></tr>
+<tr><td>New manifest</td><td>{{.New}}</td></tr>
+<tr class="new"><td>Added</td><td>{{.Added}}</td></tr>
+<tr class="del"><td>Removed</td><td>{{.Removed}}</td></tr>
+<tr class="chg"><td>Changed</td><td>{{.Changed}}</td></tr>
+<tr class="mov"><td>Moved</td><td>{{.Moved}}</td></tr>
+<tr><td>Unchanged</td><td>{{.Unchanged}}</td></tr>
+</table>
+
+<h2>Changes by directory</h2>
+<table class="sortable"><thead><tr><th>Directory</th><th>Added</th><th>Removed</th><th>Changed</th><th>Moved</th><th>Total</th></tr></thead><tbody>
+{{range .Dirs}}<tr><td>{{.Dir}}</td><td class="num">{{.Added}}</td><td class="num">{{.Removed}}</td><td class="num">{{.Changed}}</td><td class="num">{{.Moved}}</td><td class="num">{{.Total}}</td></tr>
+{{end}}</tbody></table>
+
+<h2>Changes</h2>
+<table class="sortable"><thead><tr><th>Change</th><th>Name</th><th>Was</th><th>Size</th><th>Modified</th></tr></thead><tbody>
+{{range .Changes}}<tr class="{{.Class}}"><td>{{.Change}}</td><td>{{.Name}}</td><td>{{.Was}}</td><td class="num" data-v="{{.Size}}">{{commas .Size}}</td><td data-v="{{.Time}}">{{when .Time}}</td></tr>
+{{end}}</tbody></table>
+{{end}}`
+
+// a row of the diff report
+type reportChange struct {
+	Change, Class string
+	Name, Was     string
+	Size, Time    int64
+}
+
+// per-directory change counts
+type reportDirCount struct {
+	Dir                                   string
+	Added, Removed, Changed, Moved, Total int
+}
+
+func reportDiff(args []string) {
+	num, files, found := getSSFs(args[0:2])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for i := range 2 {
+		if !found[i] {
+			abort(6, "Input SSF file '"+files[i]+"' does not exist")
+		}
+	}
+	fna, fnb, fnw := files[0], files[1], args[2]
+	if _, err := os.Stat(fnw); err == nil && !cli_overwrite {
+		abort(6, "Output file '"+fnw+"' already exists (use --overwrite)")
+	}
+	a := snapRead(fna)
+	b := snapRead(fnb)
+	if _, anon := a[""]; anon {
+		abort(6, "SSF '"+fna+"' is anonymous - the report needs names")
+	}
+	if _, anon := b[""]; anon {
+		abort(6, "SSF '"+fnb+"' is anonymous - the report needs names")
+	}
+
+	// removed files, by contents, so an added file with the same contents can be shown as a move
+	var gone = map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(a)) {
+		if _, ok := b[name]; !ok {
+			gone[a[name][0]] = append(gone[a[name][0]], name)
+		}
+	}
+
+	var changes []reportChange
+	var dirs = map[string]*reportDirCount{}
+	var nadd, ndel, nchg, nmov, nunc int
+	count := func(name string) *reportDirCount {
+		dir := path.Dir(name)
+		if dirs[dir] == nil {
+			dirs[dir] = &reportDirCount{Dir: dir}
+		}
+		dirs[dir].Total++
+		return dirs[dir]
+	}
+	row := func(change, class, name, was string, rec [3]string) {
+		changes = append(changes, reportChange{change, class, name, was, decodeHex(rec[2]), decodeHex(rec[1])})
+	}
+
+	moved := map[string]bool{}
+	for _, name := range slices.Sorted(maps.Keys(b)) {
+		rb := b[name]
+		ra, ina := a[name]
+		switch {
+		case ina && ra[0] == rb[0]:
+			nunc++
+		case ina:
+			row("Changed", "chg", name, intAsString(decodeHex(ra[2]))+" bytes", rb)
+			count(name).Changed++
+			nchg++
+		case len(gone[rb[0]]) > 0:
+			was := gone[rb[0]][0]
+			gone[rb[0]] = gone[rb[0]][1:]
+			moved[was] = true
+			row("Moved", "mov", name, was, rb)
+			count(name).Moved++
+			nmov++
+		default:
+			row("Added", "new", name, "", rb)
+			count(name).Added++
+			nadd++
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(a)) {
+		if _, ok := b[name]; !ok && !moved[name] {
+			row("Removed", "del", name, "", a[name])
+			count(name).Removed++
+			ndel++
+		}
+	}
+	slices.SortStableFunc(changes, func(x, y reportChange) int { return strings.Compare(x.Name, y.Name) })
+	dirRows := slices.Collect(maps.Values(dirs))
+	slices.SortFunc(dirRows, func(x, y *reportDirCount) int {
+		return cmp.Or(cmp.Compare(y.Total, x.Total), strings.Compare(x.Dir, y.Dir))
+	})
+
+	reportWrite(fnw, reportDiffBody, map[string]any{
+		"Title":     "Changes: " + path.Base(fna) + " to " + path.Base(fnb),
+		"Generated": time.Now().Format(time.DateTime),
+		"Old":       fna,
+		"New":       fnb,
+		"Added":     nadd,
+		"Removed":   ndel,
+		"Changed":   nchg,
+		"Moved":     nmov,
+		"Unchanged": nunc,
+		"Dirs":      dirRows,
+		"Changes":   changes,
+	})
+	fmt.Printf("added=%d, removed=%d, changed=%d, moved=%d, unchanged=%d - written to %s\n", nadd, ndel, nchg, nmov, nunc, fnw)
+}
@@ -6,6 +6,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
+	"log/slog"
 	"os"
 )
 
@@ -18,6 +19,39 @@ Can be used to de-clutter filespaces, and - as part of a security process - be u
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		logSetup()
+		numFormatSetup()
+	},
+}
+
+var cli_loglevel string = "" // slog level (debug, info, warn, error) - default is as set in main
+var cli_logfile string = ""  // file to append log records to (default is stderr)
+
+// Re-initialise structured logging if the user asked for a level or log file
+func logSetup() {
+	if cli_loglevel == "" && cli_logfile == "" {
+		return
+	}
+
+	var lvl slog.Level = slog.LevelError
+	if cli_loglevel != "" {
+		if err := lvl.UnmarshalText([]byte(cli_loglevel)); err != nil {
+			abort(6, "Invalid --log-level '"+cli_loglevel+"' (use debug, info, warn or error)")
+		}
+	}
+
+	out := os.Stderr
+	if cli_logfile != "" {
+		f, err := os.OpenFile(cli_logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			abort(4, "Cannot open log file "+cli_logfile)
+		}
+		out = f // left open for the life of the process
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: lvl})))
+	slog.Debug("logging", "loglevel", lvl.String(), "file", cli_logfile)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -40,6 +74,13 @@ func init() {
 	// when this action is called directly.
 
 	rootCmd.Flags().BoolP("cli_verbose", "v", false, "Verbose (may do nothing)")
+	rootCmd.PersistentFlags().StringVarP(&cli_loglevel, "log-level", "", "", "Log level: debug, info, warn or error (default: error)")
+	rootCmd.PersistentFlags().BoolVarP(&cli_human, "human", "", false, "Show sizes as KiB/MiB/GiB rather than exact bytes (same as --units iec)")
+	rootCmd.PersistentFlags().StringVarP(&cli_units, "units", "", "", "Sizes in reports: exact, iec (KiB/MiB/GiB) or si (kB/MB/GB)")
+	rootCmd.PersistentFlags().StringVarP(&cli_locale, "locale", "", "", "Number separators: en (1,234.5 - default), de, fr, ch, none, or a locale such as de_DE")
+	rootCmd.PersistentFlags().BoolVarP(&cli_force, "force", "", false, "Accept SSF files not named .ssf, without checking their contents")
+	rootCmd.PersistentFlags().StringVarP(&cli_maxline, "max-line", "", "1M", "Longest SSF line accepted (e.g. 4M, for very long names or annotations)")
+	rootCmd.PersistentFlags().StringVarP(&cli_logfile, "log-file", "", "", "Append log records to this file (default: stderr)")
 
 	group1 := &cobra.Group{
 		ID:    "G1",
@@ -0,0 +1,131 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ----------------------- Scan root -----------------------
+
+// The names in an SSF are relative to the directory they were walked from, which generate, update and
+// snap create record in a comment at the top of a named SSF, '# root: /home/jon': the current directory
+// for a relative path (whose names keep it, e.g. photos/2024/a.jpg), or the path itself for an absolute
+// one (walked from there, so its names are relative to it).  verify, missing, touch, untracked, guard and
+// cas export look for the files from that root rather than the current directory.  --root gives another
+// directory (e.g. where the tree has been restored to), '--root .' the current one, and --path the
+// directory outright.  (A name that is absolute, from an SSF made before roots were recorded, is taken
+// as it is.)
+
+var cli_root string = "" // directory the names are relative to (instead of the recorded root)
+
+// the '# root:' comment for a walk of startpath
+func rootComment(startpath string) string {
+	if filepath.IsAbs(startpath) {
+		return "# root: " + filepath.Clean(startpath)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		abort(4, "Cannot find the current directory: "+err.Error())
+	}
+	return "# root: " + cwd
+}
+
+// what to walk for startpath - an absolute one is walked as '.' from itself (changing to it), so that the
+// names are relative to it, as its root comment says
+func rootWalkStart(startpath string) string {
+	if !filepath.IsAbs(startpath) {
+		return startpath
+	}
+	if err := os.Chdir(startpath); err != nil {
+		abort(4, "Cannot change to "+startpath+": "+err.Error())
+	}
+	return "."
+}
+
+// the comments before an SSF's first record (nil if it cannot be read)
+func ssfHeader(fn string) []string {
+	r, err := ssfOpen(fn)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	var header []string
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if len(s) > 0 && s[0:1] != "#" {
+			break
+		}
+		header = append(header, s)
+	}
+	return header
+}
+
+// the root recorded in an SSF ("" if none) - it is in the comments before the first record
+func ssfRoot(fn string) string {
+	for _, s := range ssfHeader(fn) {
+		if root, ok := strings.CutPrefix(s, "# root: "); ok {
+			return root
+		}
+	}
+	return ""
+}
+
+// the directory an SSF's names are to be found from, if not the current one ("" if it is): --root, else
+// the recorded root (as long as it is there)
+func rootResolve(fn string) string {
+	root := cli_root
+	if root == "" {
+		if root = ssfRoot(fn); root == "" {
+			return ""
+		}
+		if st, err := os.Stat(root); err != nil || !st.IsDir() {
+			fmt.Fprintln(os.Stderr, "Recorded root "+root+" not found - names are taken as relative to the current directory")
+			return ""
+		}
+	} else if st, err := os.Stat(root); err != nil || !st.IsDir() {
+		abort(6, "--root '"+cli_root+"' is not a directory")
+	}
+
+	abs, _ := filepath.Abs(root)
+	if cwd, err := os.Getwd(); err == nil && cwd == abs {
+		return ""
+	}
+	return abs
+}
+
+// the directory an SSF's names are found from: --path, else --root or the recorded root, else the current one
+func rootStart(fn string) string {
+	if cli_path != "" {
+		return cli_path
+	}
+	if root := rootResolve(fn); root != "" {
+		return root
+	}
+	return "."
+}
+
+// where a name is found from start (an absolute name is where it says)
+func rootJoin(start string, name string) string {
+	if path.IsAbs(name) {
+		return name
+	}
+	return path.Join(start, name)
+}
+
+// where the root came from, for messages
+func rootSource() string {
+	switch {
+	case cli_path != "":
+		return "--path"
+	case cli_root != "":
+		return "--root"
+	}
+	return "the SSF's root"
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ----------------------- Scheduled re-checks (--interval, --health) -----------------------
+
+// guard and verify can run as long-lived processes, re-checking on a schedule, so that an appliance does
+// not need cron.  The result of the last check is served as JSON by --health, e.g.
+//    curl localhost:8080/health   =>  {"last_check":"2025-08-13T10:42:07Z","result":"ok","checked":1234,...}
+// with status 200 when everything matched and 503 when it did not.
+
+var cli_interval time.Duration = 0 // re-check this often (0=once)
+var cli_health string = ""         // address to serve the health endpoint on, e.g. :8080
+
+type checkStatus struct {
+	LastCheck string `json:"last_check"` // RFC3339 ("" before the first check has finished)
+	NextCheck string `json:"next_check,omitempty"`
+	Kind      string `json:"kind"`   // what was done, e.g. "full", "sampled" or "poll"
+	Result    string `json:"result"` // "ok", "changed" or "pending"
+	Checked   int    `json:"checked"`
+	Changed   int    `json:"changed"`
+	Missing   int    `json:"missing"`
+
+	// (guard --burst-alert only)
+	EventsPerMin int64  `json:"events_per_min,omitempty"`
+	HashedPerMin int64  `json:"hashed_bytes_per_min,omitempty"`
+	Burst        string `json:"burst,omitempty"` // the thresholds passed ("" if none)
+}
+
+var scheduleStatus = struct {
+	sync.Mutex
+	checkStatus
+}{checkStatus: checkStatus{Result: "pending"}}
+
+// serve the health endpoint (if asked for) - in the background, for the life of the process
+func scheduleHealth() {
+	if cli_health == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(rw http.ResponseWriter, req *http.Request) {
+		scheduleStatus.Lock()
+		st := scheduleStatus.checkStatus
+		scheduleStatus.Unlock()
+		rw.Header().Set("Content-Type", "application/json")
+		if st.Result == "changed" || st.Burst != "" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(st)
+	})
+	srv := &http.Server{Addr: cli_health, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			abort(4, "Cannot serve --health on "+cli_health+": "+err.Error())
+		}
+	}()
+}
+
+// note the result of a check, for the health endpoint
+func scheduleRecord(kind string, checked int, changed int, missing int) {
+	scheduleStatus.Lock()
+	defer scheduleStatus.Unlock()
+	now := time.Now().UTC()
+	scheduleStatus.LastCheck = now.Format(time.RFC3339)
+	if cli_interval > 0 {
+		scheduleStatus.NextCheck = now.Add(cli_interval).Format(time.RFC3339)
+	}
+	scheduleStatus.Kind = kind
+	scheduleStatus.Checked, scheduleStatus.Changed, scheduleStatus.Missing = checked, changed, missing
+	scheduleStatus.Result = "ok"
+	if changed+missing > 0 {
+		scheduleStatus.Result = "changed"
+	}
+}
+
+// note the rates of change (see guard --burst-alert)
+func scheduleRates(events int64, hashed int64) {
+	scheduleStatus.Lock()
+	defer scheduleStatus.Unlock()
+	scheduleStatus.EventsPerMin, scheduleStatus.HashedPerMin = events, hashed
+}
+
+// note the burst thresholds passed ("" for none)
+func scheduleBurst(burst string) {
+	scheduleStatus.Lock()
+	defer scheduleStatus.Unlock()
+	scheduleStatus.Burst = burst
+}
+
+// which files a scheduled check re-hashes: all of them, or a random sample with --re-hash-sample
+func scheduleSampler() (kind string, sample func() bool) {
+	if cli_sample == "" {
+		return "full", func() bool { return true }
+	}
+	return "sampled", updateSampler()
+}
@@ -5,24 +5,31 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
+	"encoding/base32"
 	b64 "encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"maps"
 	"os"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ----------------------- Global variables (shared across 'cmd' package)
 
 var cli_path string = ""    // Path to folder where scan will be performed [cobra]
-var cli_format int = 0      // Format (0=default, 1=sha, 2=1+mod, 3=2+size, 4=3+name, 5=4+annotate, 6/7/8=unused, 9=sha256sum)
+var cli_force bool = false  // Accept files not named .ssf without checking their contents
+var cli_format string = ""  // Format, by name or number (see formatNames)
 var cli_dupes bool = false  // Show duplicates as comments at end of run
 var cli_grand bool = false  // Show grand total of files/bytes total at end
 var cli_rehash bool = false // Perform deep integrity check by regenerating file hash and comparing (slow)
+var cli_human bool = false  // Sizes as KiB/MiB/GiB in terminal output (--human) - exact values stay in SSFs and JSON
 // var cli_summary bool = false   // Summarise changes from an update, without generating new file
 var cli_overwrite bool = false // Overwrite file used in update with updated version (if there are changes)
 var cli_verbose bool = false   // Provide verbose output (may have not effect)
@@ -36,13 +43,16 @@ var cli_incsha bool = false    // Include the SHA on delete listings
 var dupes = map[string]int{} // duplicate scoreboard (collected during walk)
 
 var cli_count int = 10
-var cli_discard string = ""
+var cli_discard []string // path prefixes to leave out of biggest/latest
 var cli_ellipsis bool = false
 var cli_nodot bool = false
 
 var cli_unfix string = ""
 var cli_prefix string = ""
 
+var cli_workers int = 1    // number of hashing workers
+var cli_device string = "" // block device or stream ("-" for stdin) to hash as a single record
+
 var cli_long bool = false   // used by compare
 var cli_pixels bool = false // add pixel size to end of filename
 
@@ -62,6 +72,51 @@ func abort(rc int, reason string) {
 	os.Exit(rc)
 }
 
+// The output formats, by name (the numbers are still accepted):
+// 1=sha, 2=1+mod, 3=2+size, 4=3+name, 5=4+annotate, 6/7/8=unused, 9=sha256sum
+var formatNames = []struct {
+	name string
+	num  int
+}{
+	{"sha", 1},
+	{"sha+time", 2},
+	{"sha+time+size", 3},
+	{"named", 4},
+	{"full", 5},
+	{"sha256sum", 9},
+}
+
+// the format given by --format (or def if none), aborting unless it is one the command allows
+func formatParse(def int, allowed ...int) int {
+	if cli_format == "" {
+		return def
+	}
+	return formatLookup(cli_format, "--format", allowed...)
+}
+
+// a format by name or number (given by the option opt), aborting unless it is one of those allowed
+func formatLookup(name string, opt string, allowed ...int) int {
+	form := 0
+	if n, err := strconv.Atoi(name); err == nil {
+		form = n
+	}
+	for _, f := range formatNames {
+		if strings.EqualFold(name, f.name) {
+			form = f.num
+		}
+	}
+	if !slices.Contains(allowed, form) {
+		var valid []string
+		for _, f := range formatNames {
+			if slices.Contains(allowed, f.num) {
+				valid = append(valid, fmt.Sprintf("%s (%d)", f.name, f.num))
+			}
+		}
+		abort(6, "Invalid "+opt+" format '"+name+"' (valid: "+strings.Join(valid, ", ")+")")
+	}
+	return form
+}
+
 func bashEscape(fn string) string {
 	fn = strings.Replace(fn, "\"", "\\\"", -1)
 	fn = strings.Replace(fn, "$", "\\$", -1)
@@ -69,27 +124,6 @@ func bashEscape(fn string) string {
 	return fn
 }
 
-func intAsStringWithCommas(i int64) string {
-	s := fmt.Sprintf("%d", i)
-	switch true {
-	case i < 1e3:
-		return s
-	case i < 1e6:
-		x := len(s)
-		return s[0:x-3] + "," + s[x-3:]
-	case i < 1e9:
-		x := len(s)
-		return s[0:x-6] + "," + s[x-6:x-3] + "," + s[x-3:]
-	case i < 1e12:
-		x := len(s)
-		return s[0:x-9] + "," + s[x-9:x-6] + "," + s[x-6:x-3] + "," + s[x-3:]
-	case i < 1e15:
-		return "X" + s
-	}
-	//15,103,984,154
-	return s
-}
-
 // ----------------------- Functions that process files
 
 // Return a list of verified SSFs. **FIXME**
@@ -98,9 +132,18 @@ func getSSFs(flist []string) (int, []string, []bool) {
 	var ssfexists []bool
 
 	for _, fn := range flist {
-		// named file - check it's a valid name
-		if len(fn) < 5 || fn[len(fn)-4:] != ".ssf" {
-			abort(6, "file '"+fn+"' does not end with '.ssf'")
+		// named file - check it's a valid name (or, for an existing file, that it looks like an SSF)
+		st, err := os.Stat(fn)
+		switch {
+		case err == nil && st.IsDir():
+			abort(6, "'"+fn+"' is a directory, not an SSF file")
+		case len(fn) >= 5 && fn[len(fn)-4:] == ".ssf", cli_force:
+		case err == nil && !st.Mode().IsRegular():
+			// a pipe or device (e.g. /dev/stdin) - it cannot be looked at without being used up
+		case err == nil && !ssfLooksLikeSSF(fn):
+			abort(6, "file '"+fn+"' does not look like an SSF (use --force to read it anyway)")
+		case err != nil:
+			abort(6, "file '"+fn+"' does not end with '.ssf' (use --force to write it anyway)")
 		}
 		ssflist = append(ssflist, fn)
 
@@ -114,23 +157,124 @@ func getSSFs(flist []string) (int, []string, []bool) {
 	return len(ssflist), ssflist, ssfexists
 }
 
+// whether a file not named .ssf has SSF content - its first record parses (or it is encrypted, or has no
+// records at all)
+func ssfLooksLikeSSF(fn string) bool {
+	f, err := os.Open(fn)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 64*1024)
+	n, _ := io.ReadFull(f, head)
+	head = bytes.TrimPrefix(head[:n], []byte("\xef\xbb\xbf"))
+	if len(head) > 0 && cryptDecryptCommand(head) != nil {
+		return true
+	}
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) == 0 || line[0:1] == "#" {
+			continue
+		}
+		_, ok := parseSSFRecord(line)
+		return ok
+	}
+	return true
+}
+
+// ----------------------- Scan limits (--max-files, --max-bytes)
+
+var cli_maxfiles int64 = 0   // stop after this many files (0=no limit)
+var cli_maxbytes string = "" // stop after this many bytes, e.g. 500G
+var scanMaxBytes int64 = 0   // --max-bytes in bytes (0=no limit)
+
+// parse a size such as 4096, 64K, 1M, 2G or 1T
+func parseByteSize(s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1024
+	case "M":
+		mult = 1024 * 1024
+	case "G":
+		mult = 1024 * 1024 * 1024
+	case "T":
+		mult = 1024 * 1024 * 1024 * 1024
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n * mult, true
+}
+
+// check the limit switches
+func scanLimitsValidate() {
+	if cli_maxfiles < 0 {
+		abort(6, "Invalid --max-files (must be positive)")
+	}
+	if cli_maxbytes != "" {
+		n, ok := parseByteSize(cli_maxbytes)
+		if !ok {
+			abort(6, "Invalid --max-bytes '"+cli_maxbytes+"' (expected e.g. 500G)")
+		}
+		scanMaxBytes = n
+	}
+}
+
+// whether a scan that has covered this many files and bytes should stop
+func scanLimitReached(files int64, nbytes int64) bool {
+	return (cli_maxfiles > 0 && files >= cli_maxfiles) || (scanMaxBytes > 0 && nbytes >= scanMaxBytes)
+}
+
+// the comment written at the end of a partial SSF
+func scanPartialComment(cmd string, name string) string {
+	var limits []string
+	if cli_maxfiles > 0 {
+		limits = append(limits, fmt.Sprintf("--max-files %d", cli_maxfiles))
+	}
+	if cli_maxbytes != "" {
+		limits = append(limits, "--max-bytes "+cli_maxbytes)
+	}
+	return "# partial: " + cmd + " stopped at " + name + " (" + strings.Join(limits, " ") + ")"
+}
+
 // ----------------------- Hashing
 
 // Compute SHA256 for a given filename, returning byte array x 32 and truncated b64 hash
 func getFileSha256(fn string) ([]byte, string) {
-	//fmt.Print("*")
+	progressHashing(fn)
+	defer progressHashed(fn)
 	f, err := os.Open(fn)
-	if err != nil {
+	if err != nil && errorsOn() {
+		// (the caller leaves it out)
+		fileError("file", fn, err)
+		return nil, ""
+	} else if err != nil {
 		// shouldn't happen
 		abort(13, "Found file cannot be opened: "+fn)
 	}
 	defer f.Close()
 
+	start := time.Now()
 	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
+	nbytes, err := io.Copy(h, f)
+	if err != nil && errorsOn() {
+		fileError("file", fn, err)
+		return nil, ""
+	} else if err != nil {
 		// shouldn't happen
 		abort(14, "Found file cannot be processed: "+fn)
 	}
+	if hashStats.on {
+		statsHashed(fn, nbytes, time.Since(start))
+	}
 
 	sha_bin := h.Sum(nil)
 	sha_b64 := b64.StdEncoding.EncodeToString(sha_bin)
@@ -143,13 +287,229 @@ func getFileSha256(fn string) ([]byte, string) {
 	return sha_bin, sha_b64
 }
 
+// Compute SHA256 for a block device or stream ("-" for stdin), also returning the number of bytes read
+// (a device's size is not reliably available from a stat)
+func getStreamSha256(fn string) ([]byte, string, int64) {
+	var r io.Reader = os.Stdin
+	if fn != "-" {
+		f, err := os.Open(fn)
+		if err != nil {
+			abort(13, "Device cannot be opened: "+fn)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	h := sha256.New()
+	nbytes, err := io.Copy(h, r)
+	if err != nil {
+		abort(14, "Device cannot be read: "+fn)
+	}
+
+	sha_bin := h.Sum(nil)
+	sha_b64 := b64.StdEncoding.EncodeToString(sha_bin)[0:43]
+	return sha_bin, sha_b64, nbytes
+}
+
 func shaBase64ToShaBinary(sha_b64 string) []byte {
 	shabin, _ := b64.StdEncoding.DecodeString(sha_b64 + "=")
 	return shabin
 }
 
+// SSFs always hold a SHA as 43 characters of standard base64, but for other systems an output can give it
+// as --encoding base64url ('-' and '_' rather than '+' and '/'), hex (64 digits) or base32 (52 characters,
+// unpadded).  Any of them is recognised by its length and alphabet when read back (shaDecode).
+
+var cli_encoding string = "base64" // how outputs for other systems give a SHA
+
+var shaEncodings = []string{"base64", "base64url", "hex", "base32"}
+
+func shaEncodingValidate() {
+	if !slices.Contains(shaEncodings, cli_encoding) {
+		abort(6, "Invalid --encoding '"+cli_encoding+"' (valid: "+strings.Join(shaEncodings, ", ")+")")
+	}
+}
+
+// a SHA (as held in an SSF) in the --encoding asked for
+func shaEncode(sha_b64 string) string {
+	switch cli_encoding {
+	case "base64url":
+		return strings.NewReplacer("+", "-", "/", "_").Replace(sha_b64)
+	case "hex":
+		return hex.EncodeToString(shaBase64ToShaBinary(sha_b64))
+	case "base32":
+		return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(shaBase64ToShaBinary(sha_b64))
+	}
+	return sha_b64
+}
+
+// a SHA256 in any of the encodings (base64 with or without its '=') as held in an SSF, or "" if it is
+// none of them
+func shaDecode(v string) string {
+	var bin []byte
+	var err error
+	switch {
+	case len(v) == 64:
+		bin, err = hex.DecodeString(v)
+	case len(v) == 52:
+		bin, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(v))
+	case len(v) == 43 && strings.ContainsAny(v, "-_"):
+		bin, err = b64.RawURLEncoding.DecodeString(v)
+	case len(v) == 43:
+		bin, err = b64.StdEncoding.DecodeString(v + "=")
+	case len(v) == 44:
+		bin, err = b64.StdEncoding.DecodeString(v)
+	default:
+		return ""
+	}
+	if err != nil || len(bin) != 32 {
+		return ""
+	}
+	return b64.StdEncoding.EncodeToString(bin)[0:43]
+}
+
+// ----------------------- SSF record encoding (shared by every reader and writer)
+
+// An SSF record line is:
+//
+//	<sha: 43 base64 ch><modtime: 8 hex ch><size: 4-16 hex ch>[ <annotation>...][ :<name>]
+//
+// The size is lower-case hex with a minimum of four digits and no further leading zeros, so files
+// over 64k simply have a longer field (up to 16 digits for the largest int64).  The field is
+// self-delimiting: it ends at the first space (annotations/name) or at end of line (anonymous).
+// Anonymous formats drop trailing parts: format 1 is sha only, 2 is sha+modtime, 3 is sha+modtime+size.
+
+type ssfRecord struct {
+	format  int    // 1-3 anonymous, 4 named, 5 named with annotations
+	shab64  string // 43 ch base64 (no trailing '=')
+	modtime string // 8 hex ch ("" for format 1)
+	size    string // 4-16 hex ch ("" for formats 1 and 2)
+	annot   string // space separated annotations (may be "")
+	name    string // escaped filename ("" for formats 1-3)
+}
+
+// canonical modify time field (always 8 hex digits)
+func encodeModTime(secs int64) string {
+	return fmt.Sprintf("%08x", secs)
+}
+
+// canonical size field (4 hex digits minimum, otherwise as long as needed)
+func encodeSize(nbytes int64) string {
+	return fmt.Sprintf("%04x", nbytes)
+}
+
+// convert a hex modtime or size field to a number (0 if invalid)
+func decodeHex(h string) int64 {
+	n, _ := strconv.ParseInt(h, 16, 64)
+	return n
+}
+
+// fixed-width (16 ch) version of a size field, for string comparison/sorting of sizes
+func sizeKey(size string) string {
+	return fmt.Sprintf("%016x", decodeHex(size))
+}
+
+// check a string is all hex digits (either case)
+func isHex(h string) bool {
+	for _, c := range h {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse any format of SSF record line (not comments) into its fields - false if malformed
+func parseSSFRecord(s string) (ssfRecord, bool) {
+	var rec ssfRecord
+	if len(s) < 43 {
+		return rec, false
+	}
+	rec.shab64 = s[0:43]
+
+	// identifier block ends at the first space (or end of line)
+	id := s
+	pos := strings.IndexByte(s, ' ')
+	if pos != -1 {
+		id = s[0:pos]
+	}
+	switch {
+	case len(id) == 43 && pos == -1:
+		rec.format = 1
+		return rec, true
+	case len(id) == 51 && pos == -1:
+		rec.format = 2
+		rec.modtime = id[43:51]
+		return rec, isHex(rec.modtime)
+	case len(id) < 55 || len(id) > 51+16:
+		return rec, false
+	}
+	rec.modtime = id[43:51]
+	rec.size = id[51:]
+	if !isHex(rec.modtime) || !isHex(rec.size) {
+		return rec, false
+	}
+	if pos == -1 {
+		rec.format = 3
+		return rec, true
+	}
+
+	// named record - annotations (if any) then ' :' then name
+	namepos := strings.Index(s, " :")
+	if namepos == -1 {
+		return rec, false
+	}
+	rec.format = 4
+	if namepos > pos {
+		rec.annot = s[pos+1 : namepos]
+		rec.format = 5
+	}
+	rec.name = s[namepos+2:]
+	return rec, true
+}
+
+// Produce the line for a record in its format (the inverse of parseSSFRecord) - size/modtime are
+// re-encoded canonically, so this also normalises records read from older or hand-made files
+func ssfRecordLine(rec ssfRecord) string {
+	line := rec.shab64
+	if rec.format >= 2 {
+		line += encodeModTime(decodeHex(rec.modtime))
+	}
+	if rec.format >= 3 {
+		line += encodeSize(decodeHex(rec.size))
+	}
+	if rec.format == 5 && rec.annot != "" {
+		line += " " + rec.annot
+	}
+	if rec.format >= 4 {
+		line += " :" + rec.name
+	}
+	return line
+}
+
+// Sort records by name in strict byte order (the canonical order, which is not the walk order generate
+// writes - see walkCompare - so an SSF written in it is marked with sortFullComment), then by sha
+func sortRecords(recs []ssfRecord) {
+	slices.SortStableFunc(recs, func(a, b ssfRecord) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.shab64, b.shab64)
+	})
+}
+
 // ----------------------- Reporting
 
+// whether a name is under one of the --discard prefixes
+func discarded(name string) bool {
+	for _, d := range cli_discard {
+		if strings.HasPrefix(name, d) {
+			return true
+		}
+	}
+	return false
+}
+
 // Reproducible comment on total number of files/bytes
 func reportGrandTotals(w *bufio.Writer, tf int64, tb int64) {
 	if cli_grand {
@@ -178,19 +538,70 @@ func reportDupes(w *bufio.Writer) {
 	}
 }
 
+// the comments shaman writes itself at the end of an SSF (totals, duplicates, partial or interrupted runs
+// and errors), which --keep-comments does not carry through - they are made afresh, if at all
+var generatedComment = regexp.MustCompile(`^# (\d+ files, \d+ bytes|There were no duplicates|-+ Duplicates -+|[A-Za-z0-9+/]{43} x\d+|partial: .*|error: .*|INCOMPLETE: .*|root: .*|sort: full)$`)
+
+func commentIsGenerated(s string) bool {
+	return generatedComment.MatchString(s)
+}
+
+// ----------------------- SSF line reading
+
+// SSFs edited on Windows can gain a byte-order mark and CRLF line endings, and names or annotations can
+// make a line longer than bufio.Scanner's 64k default (which would end the scan early, looking like the
+// end of the file).  Every SSF is read with ssfScanner, which drops the BOM and CRs, and stops with an
+// error on a line longer than --max-line.
+
+var cli_maxline string = "1M" // longest SSF line accepted (--max-line)
+
+func ssfMaxLine() int64 {
+	maxline, ok := parseByteSize(cli_maxline)
+	if !ok || maxline < 1024 || maxline > 1024*1024*1024 {
+		abort(6, "Invalid --max-line '"+cli_maxline+"' (e.g. 1M - between 1K and 1G)")
+	}
+	return maxline
+}
+
+func ssfScanner(r *ssfFile) *bufio.Scanner {
+	maxline := ssfMaxLine()
+	var lineno int
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), int(maxline)+2)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		adv, tok, err := bufio.ScanLines(data, atEOF) // (drops a trailing CR)
+		if tok == nil {
+			if !atEOF && int64(len(data)) > maxline {
+				abort(6, fmt.Sprintf("Line %d of %s is longer than %s bytes - not an SSF, or raise --max-line", lineno+1, r.fn, intAsString(maxline)))
+			}
+			return adv, tok, err
+		}
+		lineno++
+		if len(tok) < adv && data[len(tok)] == '\r' {
+			r.crlf++
+		}
+		if lineno == 1 && bytes.HasPrefix(tok, []byte("\xef\xbb\xbf")) {
+			r.bom = true
+			tok = tok[3:]
+		}
+		return adv, tok, err
+	})
+	return sc
+}
+
 // ----------------------- File processing
 
 // return the number of lines with a sha in a file (NOT the number of unique shas)
 func ssfRecCount(fn string) int64 {
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
 	defer r.Close()
 
 	var count int64
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s := scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -206,8 +617,8 @@ func ssfRecCount(fn string) int64 {
 
 // read the given ssf file, and create a key=sha, value=flag in map m / return length
 func ssfScoreboardRead(fn string, m map[string]bool, flag bool) (int, int) {
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
@@ -215,7 +626,7 @@ func ssfScoreboardRead(fn string, m map[string]bool, flag bool) (int, int) {
 
 	var count int
 	var s string
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -233,8 +644,8 @@ func ssfScoreboardRead(fn string, m map[string]bool, flag bool) (int, int) {
 
 // read a file and set map entry to flag only if the sha exists in the map
 func ssfScoreboardMark(fn string, m map[string]bool, flag bool) (int, int) {
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
@@ -243,7 +654,7 @@ func ssfScoreboardMark(fn string, m map[string]bool, flag bool) (int, int) {
 	var count int
 	var hits int
 	var s string
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -280,15 +691,15 @@ func ssfScoreboardRemove(m map[string]bool, target bool) int {
 
 // read the given ssf file, and create a key=sha, value=flag in map m / return length
 func ssfSelectNameByScoreboard(fn string, m map[string]bool, list *[]string) int {
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
 	defer r.Close()
 
 	var s string
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -313,8 +724,8 @@ func ssfSelectNameByScoreboard(fn string, m map[string]bool, list *[]string) int
 
 // ssfScoreboardDupRead - entry per SHA, bool false if one, true if multi
 func ssfScoreboardDupRead(fn string, m map[string]bool) (int, int) {
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
@@ -322,7 +733,7 @@ func ssfScoreboardDupRead(fn string, m map[string]bool) (int, int) {
 
 	var multi int
 	var s string
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -350,17 +761,13 @@ func ssfScoreboardDupRead(fn string, m map[string]bool) (int, int) {
 }
 
 // Split a line from an SSF into constituent fields (no hex to dec conversion) / empty str on error
+// Any annotations between the identifier and the name are skipped, and anonymous records are rejected
 func splitSSFLine(s string) (id string, shab64 string, modtime string, length string, name string) {
-	pos := strings.IndexByte(s, 32)
-	if pos == -1 {
+	rec, ok := parseSSFRecord(s)
+	if !ok || rec.format < 4 {
 		return "", "", "", "", ""
 	}
-	id = s[0:pos]
-	shab64 = s[0:43]
-	modtime = s[43:51]
-	length = s[51:pos]
-	name = s[pos+2:]
-	return id, shab64, modtime, length, name
+	return rec.shab64 + rec.modtime + rec.size, rec.shab64, rec.modtime, rec.size, rec.name
 }
 
 // Take scoreboard and filename, and return 'first use' map and 'reports' strings map
@@ -387,8 +794,8 @@ func sshScoreboardReadMapMap(multiple map[string]bool, fn string, first map[stri
 	// multiple["ss"] = false
 	// return 1
 
-	var r *os.File
-	r, err := os.Open(fn)
+	var r *ssfFile
+	r, err := ssfOpen(fn)
 	if err != nil {
 		abort(4, "Can't open "+fn+" - stuck!")
 	}
@@ -396,7 +803,7 @@ func sshScoreboardReadMapMap(multiple map[string]bool, fn string, first map[stri
 
 	var s string
 	var tm int
-	scanner := bufio.NewScanner(r)
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
@@ -443,9 +850,23 @@ func sshScoreboardReadMapMap(multiple map[string]bool, fn string, first map[stri
 
 // Consolidation functions
 
-func ssfCollectRead(fnr string, hits map[string]string, format int) (int, int) {
-	var r *os.File
-	r, err := os.Open(fnr)
+func ssfCollectRead(fnr string, hits map[string]string, comments map[string][]string, format int) (int, int) {
+	rows := ssfCollectEach(fnr, format, comments, func(shab64 string, val string) {
+		// keep the earliest modtime (the value starts with it, when present)
+		if old, ok := hits[shab64]; ok && old[0:min(len(old), 8)] < val[0:min(len(val), 8)] {
+			return
+		}
+		hits[shab64] = val
+	})
+	return len(hits), rows
+}
+
+// Read an SSF of any format, calling f with each record's SHA and its format-1/2/3 value (empty string,
+// mod-time, or composite time/size), returning the number of records.  If comments is given, the comment
+// lines before each record are added to it under the record's SHA (and those at the end under "").
+func ssfCollectEach(fnr string, format int, comments map[string][]string, f func(shab64 string, val string)) int {
+	var r *ssfFile
+	r, err := ssfOpen(fnr)
 	if err != nil {
 		abort(4, "Can't open "+fnr+" - stuck!")
 	}
@@ -453,47 +874,49 @@ func ssfCollectRead(fnr string, hits map[string]string, format int) (int, int) {
 
 	var rows int
 	var s string
-	scanner := bufio.NewScanner(r)
+	var held []string // comments waiting for the next record
+	scanner := ssfScanner(r)
 	for scanner.Scan() {
 		s = scanner.Text()
 		if len(s) == 0 || s[0:1] == "#" {
-			// drop comments or empty lines
+			// drop comments (unless kept) or empty lines
+			if comments != nil && len(s) > 0 && !commentIsGenerated(s) {
+				held = append(held, s)
+			}
 			continue
 		}
 
-		// get fields
-		_, shab64, modtime, size, _ := splitSSFLine(s)
-		// fmt.Println(s, shab64, modtime, size)
-		if shab64 == "" {
+		// get fields (any format - consolidate is mostly fed anonymous files)
+		rec, ok := parseSSFRecord(s)
+		if !ok {
 			fmt.Println("Ignoring corrupt line: " + s)
 			continue
 		}
+		if (format == 2 && rec.modtime == "") || (format == 3 && rec.size == "") {
+			abort(6, fmt.Sprintf("File %s has format %d records - cannot produce format %d", fnr, rec.format, format))
+		}
 
 		switch format {
 		case 1:
 			// just the SHA
-			hits[shab64] = ""
+			f(rec.shab64, "")
 		case 2:
 			// record modtime
-			val, ok := hits[shab64]
-			if ok && val < modtime {
-				// don't overwrite if stored modtime is earlier
-				continue
-			}
-			hits[shab64] = modtime
+			f(rec.shab64, rec.modtime)
 		case 3:
 			// record modtime and size
-			val, ok := hits[shab64]
-			if ok && val[0:8] < modtime {
-				// don't overwrite if stored modtime is earlier
-				continue
-			}
-			// fmt.Println(shab64, modtime, size)
-			hits[shab64] = modtime + size
+			f(rec.shab64, rec.modtime+rec.size)
+		}
+		if len(held) > 0 {
+			comments[rec.shab64] = append(comments[rec.shab64], held...)
+			held = nil
 		}
 
 		rows++
 	}
+	if len(held) > 0 {
+		comments[""] = append(comments[""], held...)
+	}
 
-	return len(hits), rows
+	return rows
 }
@@ -0,0 +1,121 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// signCmd represents the sign command
+var signCmd = &cobra.Command{
+	Use:   "sign file.ssf --cosign",
+	Short: "Sign (or verify the signature of) an SSF with Sigstore cosign",
+	Long: `shaman sign file.ssf --cosign [--key cosign.key]
+Signs the canonical form of the SSF (as used by 'attest': its records, re-encoded and sorted, without
+comments) using the cosign tool, which must be on the PATH.  The Sigstore bundle (signature, and the
+certificate when keyless) is stored alongside as file.ssf.sigstore.json.  Without --key, cosign uses
+keyless signing, which opens a browser for an OIDC login; with --key, the given cosign private key
+(or KMS reference) is used.
+
+shaman sign --verify file.ssf --cosign [--key cosign.pub | --identity who@example.com --issuer URL]
+Checks the SSF against its bundle, with the public key, or with the identity and OIDC issuer expected
+in the keyless certificate.  Comments can be added to a signed SSF without breaking the signature.`,
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		sig(args)
+	},
+}
+
+var cli_cosign bool = false    // sign with cosign (the only method at present)
+var cli_verify bool = false    // verify rather than sign
+var cli_key string = ""        // cosign key (private to sign, public to verify)
+var cli_identity string = ""   // expected certificate identity for keyless verification
+var cli_oidcissuer string = "" // expected OIDC issuer for keyless verification
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().BoolVarP(&cli_cosign, "cosign", "", false, "Sign using Sigstore cosign")
+	signCmd.Flags().BoolVarP(&cli_verify, "verify", "", false, "Verify the signature instead of signing")
+	signCmd.Flags().StringVarP(&cli_key, "key", "k", "", "Cosign key file or KMS reference (default: keyless)")
+	signCmd.Flags().StringVarP(&cli_identity, "identity", "", "", "Certificate identity expected when verifying keyless signatures")
+	signCmd.Flags().StringVarP(&cli_oidcissuer, "issuer", "", "", "OIDC issuer expected when verifying keyless signatures")
+}
+
+// ----------------------- Sign function below this line -----------------------
+
+func sig(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch {
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case !cli_cosign:
+		abort(6, "Give the signing method: --cosign")
+	case cli_verify && cli_key == "" && (cli_identity == "" || cli_oidcissuer == ""):
+		abort(6, "Verifying needs --key, or --identity and --issuer for a keyless signature")
+	}
+	fnr := files[0]
+	bundle := fnr + ".sigstore.json"
+	if cli_verify {
+		if _, err := os.Stat(bundle); err != nil {
+			abort(6, "No signature bundle '"+bundle+"'")
+		}
+	}
+	cosign, err := exec.LookPath("cosign")
+	if err != nil {
+		abort(9, "cosign is not installed (see https://docs.sigstore.dev/cosign/system_config/installation/)")
+	}
+
+	// cosign signs/verifies a file, so write the canonical form to a temporary one
+	tmp, err := os.CreateTemp("", "shaman-sign-*.ssf")
+	if err != nil {
+		abort(4, "Cannot create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(ssfCanonical(fnr)); err != nil {
+		abort(4, "Cannot write temporary file (disk full?)")
+	}
+	tmp.Close()
+
+	var c []string
+	if cli_verify {
+		c = []string{"verify-blob", "--bundle", bundle}
+		if cli_key != "" {
+			c = append(c, "--key", cli_key)
+		} else {
+			c = append(c, "--certificate-identity", cli_identity, "--certificate-oidc-issuer", cli_oidcissuer)
+		}
+	} else {
+		c = []string{"sign-blob", "--yes", "--bundle", bundle}
+		if cli_key != "" {
+			c = append(c, "--key", cli_key)
+		}
+	}
+	c = append(c, tmp.Name())
+	slog.Debug("running cosign", "args", c)
+
+	run := exec.Command(cosign, c...)
+	run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := run.Run(); err != nil {
+		os.Remove(tmp.Name()) // (abort skips the deferred removal)
+		if cli_verify {
+			abort(1, "Signature of "+fnr+" does NOT verify")
+		}
+		abort(1, "cosign failed: "+err.Error())
+	}
+	if cli_verify {
+		fmt.Println("Signature of " + fnr + " verified")
+	} else {
+		fmt.Println("Signed " + fnr + " - bundle written to " + bundle)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// snapCmd represents the snap command (parent of create/list/diff)
+var snapCmd = &cobra.Command{
+	Use:   "snap",
+	Short: "Keep a dated series of SSF snapshots of a tree",
+	Long: `shaman snap create|list|diff
+Maintains a dated series of manifests for a tree in a snapshot directory (default '.shaman/'), giving a
+history of what changed when.  Snapshots are ordinary SSF files named by their creation time, e.g.
+.shaman/2025-08-13_093000.ssf, so every other command can be used on them.
+   shaman snap create                        # snapshot current directory into .shaman/
+   shaman snap create -p /data --dir /var/snaps --keep 30
+   shaman snap list
+   shaman snap diff 2025-08-01 2025-08-13    # dates may be any unique prefix of a snapshot name`,
+	GroupID: "G1",
+}
+
+// snapCreateCmd represents the snap create command
+var snapCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new snapshot (re-using hashes from the previous one where files are unchanged)",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		snapCreate()
+	},
+}
+
+// snapListCmd represents the snap list command
+var snapListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots held",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		snapList()
+	},
+}
+
+// snapDiffCmd represents the snap diff command
+var snapDiffCmd = &cobra.Command{
+	Use:   "diff <date1> <date2>",
+	Short: "Show files added, deleted and changed between two snapshots",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		snapDiff(args)
+	},
+}
+
+var cli_snapdir string = ".shaman" // where snapshots are kept
+var cli_keep int = 0               // number of snapshots to retain (0=all)
+var cli_keepdays int = 0           // age in days beyond which snapshots are removed (0=forever)
+
+const snapTimeFormat = "2006-01-02_150405"
+
+func init() {
+	rootCmd.AddCommand(snapCmd)
+	snapCmd.AddCommand(snapCreateCmd)
+	snapCmd.AddCommand(snapListCmd)
+	snapCmd.AddCommand(snapDiffCmd)
+
+	snapCmd.PersistentFlags().StringVarP(&cli_snapdir, "dir", "", ".shaman", "Directory holding the snapshots")
+
+	snapCreateCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to snapshot (default is current directory)")
+	snapCreateCmd.Flags().IntVarP(&cli_keep, "keep", "k", 0, "Number of snapshots to retain (default: all)")
+	snapCreateCmd.Flags().IntVarP(&cli_keepdays, "keep-days", "", 0, "Remove snapshots older than this many days (default: never)")
+	snapCreateCmd.Flags().BoolVarP(&cli_nodot, "no-dot", "", false, "Do not include files/directories beginning '.'")
+}
+
+// ----------------------- Snapshot functions below this line -----------------------
+
+// the snapshot files in the snapshot directory, oldest first
+func snapFiles() []string {
+	entries, err := os.ReadDir(cli_snapdir)
+	if err != nil {
+		return nil
+	}
+	var snaps []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, ".ssf") {
+			continue
+		}
+		if _, err := time.Parse(snapTimeFormat, strings.TrimSuffix(name, ".ssf")); err == nil {
+			snaps = append(snaps, name)
+		}
+	}
+	slices.Sort(snaps) // names are timestamps, so this is chronological
+	return snaps
+}
+
+// find the snapshot for a date (any unique prefix, or the last of several on a day)
+func snapFind(date string) string {
+	var match string
+	for _, name := range snapFiles() {
+		if strings.HasPrefix(name, date) {
+			match = name
+		}
+	}
+	if match == "" {
+		abort(6, "No snapshot matches '"+date+"' (try 'shaman snap list')")
+	}
+	return path.Join(cli_snapdir, match)
+}
+
+// read a named SSF into a map of name -> [sha, modtime, size]
+func snapRead(fn string) map[string][3]string {
+	r, err := ssfOpen(fn)
+	if err != nil {
+		abort(4, "Can't open "+fn+" - stuck!")
+	}
+	defer r.Close()
+
+	var recs = map[string][3]string{}
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+		_, shab64, modtime, size, name := splitSSFLine(s)
+		if shab64 != "" {
+			recs[name] = [3]string{shab64, modtime, size}
+		}
+	}
+	return recs
+}
+
+func snapCreate() {
+	var startpath string = "."
+	if cli_path != "" {
+		startpath = cli_path // add validation here
+	}
+	if err := os.MkdirAll(cli_snapdir, 0755); err != nil {
+		abort(4, "Cannot create snapshot directory "+cli_snapdir)
+	}
+
+	// previous snapshot supplies hashes for files whose time and size have not changed
+	var prev = map[string][3]string{}
+	snaps := snapFiles()
+	if len(snaps) > 0 {
+		prev = snapRead(path.Join(cli_snapdir, snaps[len(snaps)-1]))
+	}
+
+	now := time.Now()
+	fn := path.Join(cli_snapdir, now.Format(snapTimeFormat)+".ssf")
+	if _, err := os.Stat(fn); err == nil {
+		abort(6, "Snapshot "+fn+" already exists")
+	}
+	w := writeInit(fn)
+
+	// record the root the names are relative to (see rootComment) - unless the last snapshot has absolute
+	// names, from before roots were recorded, which this one is to match
+	absnames := filepath.IsAbs(startpath) && len(snaps) > 0 && ssfRoot(path.Join(cli_snapdir, snaps[len(snaps)-1])) == ""
+	cli_snapdir, _ = filepath.Abs(cli_snapdir) // (the walk may change directory)
+	if !absnames {
+		fmt.Fprintln(w, rootComment(startpath))
+		startpath = rootWalkStart(startpath)
+	}
+
+	// walk the tree (ignoring the snapshot directory itself, if it is inside)
+	skip := cli_snapdir + "/"
+	if cwd, err := os.Getwd(); err == nil && !absnames {
+		if rel, err := filepath.Rel(cwd, cli_snapdir); err == nil {
+			skip = rel + "/"
+		}
+	}
+	opts := walkOptionsFromFlags()
+	fileQueue := make(chan triplex, 4096)
+	go func() {
+		defer close(fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
+	}()
+
+	var added, changed, hashed int
+	var seen = map[string]bool{}
+	for filerec := range fileQueue {
+		name := filerec.filename
+		if strings.HasPrefix(path.Clean(name)+"/", skip) {
+			continue
+		}
+
+		modt := encodeModTime(filerec.modified)
+		size := encodeSize(filerec.size)
+		sha := ""
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			added++
+		case old[1] == modt && old[2] == size:
+			sha = old[0] // trust the previous hash
+		default:
+			changed++
+		}
+		if sha == "" {
+			_, sha = getFileSha256(name)
+			hashed++
+			if ok && sha == old[0] {
+				changed-- // only the time changed - content didn't
+			}
+		}
+		seen[name] = true
+		w.record(true, 5, 0, "N", sha, modt, size, "", name, "")
+	}
+	w.Flush()
+
+	var deleted int
+	for name := range prev {
+		if !seen[name] {
+			deleted++
+		}
+	}
+	fmt.Printf("Created %s: %d files (%d hashed) - %d new, %d changed, %d deleted since last snapshot\n",
+		fn, w.files(), hashed, added, changed, deleted)
+
+	snapRotate(now)
+}
+
+// apply the retention rules (count and age) - the newest snapshot is never removed
+func snapRotate(now time.Time) {
+	snaps := snapFiles()
+	for x, name := range snaps[:max(len(snaps)-1, 0)] {
+		expired := cli_keep > 0 && x < len(snaps)-cli_keep
+		if cli_keepdays > 0 {
+			t, _ := time.ParseInLocation(snapTimeFormat, strings.TrimSuffix(name, ".ssf"), time.Local)
+			expired = expired || now.Sub(t) > time.Duration(cli_keepdays)*24*time.Hour
+		}
+		if expired {
+			slog.Debug("snapshot rotation", "removing", name)
+			if err := os.Remove(path.Join(cli_snapdir, name)); err == nil {
+				fmt.Println("Removed old snapshot " + name)
+			}
+		}
+	}
+}
+
+func snapList() {
+	snaps := snapFiles()
+	if len(snaps) == 0 {
+		abort(1, "No snapshots in "+cli_snapdir)
+	}
+	fmt.Println("SNAPSHOT                      FILES             BYTES")
+	for _, name := range snaps {
+		var nbytes int64
+		recs := snapRead(path.Join(cli_snapdir, name))
+		for _, rec := range recs {
+			n, _ := strconv.ParseInt(rec[2], 16, 64)
+			nbytes += n
+		}
+		fmt.Printf("%-24s %10s %17s\n", strings.TrimSuffix(name, ".ssf"), intAsString(int64(len(recs))), sizeAsString(nbytes))
+	}
+}
+
+func snapDiff(args []string) {
+	fna := snapFind(args[0])
+	fnb := snapFind(args[1])
+	if fna > fnb {
+		// always report from older to newer
+		fna, fnb = fnb, fna
+	}
+	a := snapRead(fna)
+	b := snapRead(fnb)
+
+	fmt.Println("Changes from " + fna + " to " + fnb + ":")
+	var nnew, ndel, nchg int
+	names := slices.Sorted(maps.Keys(a))
+	for name := range maps.Keys(b) {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		ra, ina := a[name]
+		rb, inb := b[name]
+		switch {
+		case !ina:
+			fmt.Println("  New: " + name)
+			nnew++
+		case !inb:
+			fmt.Println("  Del: " + name)
+			ndel++
+		case ra[0] != rb[0]:
+			fmt.Println("  Chg: " + name)
+			nchg++
+		}
+	}
+	fmt.Printf("new=%d, deleted=%d, changed=%d, unchanged=%d\n", nnew, ndel, nchg, len(names)-nnew-ndel-nchg)
+}
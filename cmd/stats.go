@@ -0,0 +1,120 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ----------------------- Throughput statistics (--stats) -----------------------
+
+// Every file hash is timed while --stats is on, to give an end-of-run summary: files and bytes per
+// second, the time spent hashing, and the slowest files.  Comparing the hashing rate with this machine's
+// in-memory SHA256 rate shows whether the run was limited by the storage or by the CPU.  The space the
+// files take on disk is totalled too, as sparse (or compressed) files take less than their size.
+
+var cli_stats bool = false // time hashing and print a summary at the end
+
+const statsSlowest = 10 // slowest files listed
+
+type statsFile struct {
+	name  string
+	bytes int64
+	d     time.Duration
+}
+
+var hashStats struct {
+	sync.Mutex
+	on      bool
+	start   time.Time
+	files   int64
+	bytes   int64
+	busy    time.Duration // total time spent hashing (over all workers)
+	slowest []statsFile   // slowest first
+
+	apparent  int64 // sizes of the files whose allocation is known
+	allocated int64 // and the space they take
+	sparse    int64 // files at least a block short of their size
+}
+
+// start timing (if --stats was given)
+func statsStart() {
+	hashStats.on = cli_stats
+	hashStats.start = time.Now()
+}
+
+// note a file hash (called by the hashing functions)
+func statsHashed(fn string, nbytes int64, d time.Duration) {
+	var apparent, allocated int64 = 0, -1
+	if info, err := os.Stat(fn); err == nil {
+		if a, ok := fileAllocated(info); ok {
+			apparent, allocated = info.Size(), a
+		}
+	}
+	hashStats.Lock()
+	defer hashStats.Unlock()
+	if allocated >= 0 {
+		hashStats.apparent += apparent
+		hashStats.allocated += allocated
+		if apparent-allocated >= 4096 {
+			hashStats.sparse++
+		}
+	}
+	hashStats.files++
+	hashStats.bytes += nbytes
+	hashStats.busy += d
+	if len(hashStats.slowest) < statsSlowest || d > hashStats.slowest[len(hashStats.slowest)-1].d {
+		hashStats.slowest = append(hashStats.slowest, statsFile{fn, nbytes, d})
+		slices.SortStableFunc(hashStats.slowest, func(a, b statsFile) int { return int(b.d - a.d) })
+		hashStats.slowest = hashStats.slowest[:min(len(hashStats.slowest), statsSlowest)]
+	}
+}
+
+// print the summary (nothing unless --stats was given)
+func statsReport(out io.Writer, workers int) {
+	if !hashStats.on {
+		return
+	}
+	hashStats.Lock()
+	defer hashStats.Unlock()
+	elapsed := time.Since(hashStats.start)
+	secs := max(elapsed.Seconds(), 0.001)
+
+	fmt.Fprintf(out, "Elapsed:     %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "Hashed:      %s files, %s\n", intAsString(hashStats.files), bytesAsString(hashStats.bytes))
+	fmt.Fprintf(out, "Throughput:  %.1f files/sec, %.1f MB/s\n", float64(hashStats.files)/secs, mbps(hashStats.bytes, elapsed))
+	if hashStats.apparent > 0 {
+		fmt.Fprintf(out, "On disk:     %s allocated for %s of files (%s sparse)\n", bytesAsString(hashStats.allocated),
+			bytesAsString(hashStats.apparent), intAsString(hashStats.sparse))
+	}
+
+	// the hashing rate of one worker against the in-memory rate says where the time goes
+	if hashStats.files > 0 {
+		perWorker := mbps(hashStats.bytes, hashStats.busy)
+		buf := make([]byte, 16*1024*1024)
+		start := time.Now()
+		sha256.Sum256(buf)
+		cpu := mbps(int64(len(buf)), time.Since(start))
+		verdict := "CPU-bound (hashing is the limit)"
+		if perWorker < cpu*0.5 {
+			verdict = "disk-bound (reading is slower than hashing)"
+		}
+		fmt.Fprintf(out, "Hash rate:   %.1f MB/s per file being hashed, against %.0f MB/s in memory - %s\n", perWorker, cpu, verdict)
+		if workers > 1 {
+			fmt.Fprintf(out, "Workers:     %d, busy %.0f%% of the time\n", workers, 100*hashStats.busy.Seconds()/secs/float64(workers))
+		}
+	}
+	if len(hashStats.slowest) > 0 {
+		fmt.Fprintln(out, "Slowest files:")
+		for _, s := range hashStats.slowest {
+			fmt.Fprintf(out, "  %10s  %15s  %s\n", s.d.Round(time.Microsecond), sizeAsString(s.bytes), s.name)
+		}
+	}
+}
@@ -19,7 +19,9 @@ var sumCmd = &cobra.Command{
 	Short: "Produce a GNU-style sha256sum check file from an SSF or live directory",
 	Long: `shaman sum file.ssh
 Generate a GNU-style sha256sum check file from an SSF or live directory.  Typically used with the --path
-switch to select a subdirectory. Produces immediately from file, or can calculate live.`,
+switch to select a subdirectory. Produces immediately from file, or can calculate live.
+SHAs are base64 as in an SSF unless --encoding gives base64url, hex or base32; with hex, the lines are
+exactly sha256sum's ('hash  name'), so that 'sha256sum -c' can check them.`,
 	Aliases: []string{"sum"},
 	Args:    cobra.MaximumNArgs(1),
 	GroupID: "G1",
@@ -32,6 +34,7 @@ func init() {
 	rootCmd.AddCommand(sumCmd)
 
 	sumCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to use (default is all files)")
+	sumCmd.Flags().StringVarP(&cli_encoding, "encoding", "", "base64", "SHA encoding: base64, base64url, hex (sha256sum's own) or base32")
 }
 
 // ----------------------- Sum function below this line -----------------------
@@ -66,6 +69,11 @@ func sum(args []string) {
 	if num > 1 {
 		abort(8, "Too many .ssf files specified)")
 	}
+	shaEncodingValidate()
+	sep := " "
+	if cli_encoding == "hex" {
+		sep = "  " // (as sha256sum writes it)
+	}
 
 	// Check whether file specified and if so that it does not yet exist and that it ends ".ssf"
 	var w *bufio.Writer
@@ -101,10 +109,11 @@ func sum(args []string) {
 	// ------------------------------------------
 
 	// Call the tree walker to sum a file list (as a channel)
+	opts := walkOptionsFromFlags()
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
 	// process file list to sum SSF records
@@ -112,7 +121,7 @@ func sum(args []string) {
 	var total_bytes int64
 	for filerec := range fileQueue {
 		_, sha_b64 := getFileSha256(filerec.filename)
-		fmt.Fprintln(w, sha_b64+" "+filerec.filename)
+		fmt.Fprintln(w, shaEncode(sha_b64)+sep+filerec.filename)
 
 		// stats and ticks (dot every 100, flush every 500)
 		total_bytes += filerec.size
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// timelineCmd represents the timeline command
+var timelineCmd = &cobra.Command{
+	Use:   "timeline file1.ssf file2.ssf ...",
+	Short: "Show when files appeared, changed and disappeared across a series of SSFs",
+	Long: `shaman timeline file1.ssf file2.ssf ... [--name pattern]
+Given several manifests of the same tree, taken at different times and supplied oldest first (a shell glob
+of dated names such as snapshots does this naturally), reports for each file the manifest in which it first
+appeared, each one in which its content changed (hash transition), and the one in which it disappeared.
+The --name pattern is a shell-style glob (e.g. 'reports/*.xlsx'); without it every file with a history
+beyond simply being present throughout is shown.
+   shaman timeline .shaman/*.ssf --name 'reports/q3.xlsx'`,
+	Args:    cobra.MinimumNArgs(2),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		tim(args)
+	},
+}
+
+var cli_name string = "" // filename pattern (glob)
+
+func init() {
+	rootCmd.AddCommand(timelineCmd)
+
+	timelineCmd.Flags().StringVarP(&cli_name, "name", "n", "", "Only report files matching this glob pattern")
+}
+
+// ----------------------- Timeline function below this line -----------------------
+
+func tim(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "Input SSF file '"+fn+"' does not exist")
+		}
+	}
+	if cli_name != "" {
+		if _, err := path.Match(cli_name, ""); err != nil {
+			abort(6, "Invalid --name pattern '"+cli_name+"'")
+		}
+	}
+
+	var current = map[string]string{}  // name -> sha (as of last manifest processed)
+	var events = map[string][]string{} // name -> report lines
+	var interesting = map[string]bool{}
+	for x, fn := range files {
+		r, err := ssfOpen(fn)
+		if err != nil {
+			abort(4, "Can't open "+fn+" - stuck!")
+		}
+
+		var present = map[string]bool{}
+		scanner := ssfScanner(r)
+		for scanner.Scan() {
+			s := scanner.Text()
+			if len(s) == 0 || s[0:1] == "#" {
+				// drop comments or empty lines
+				continue
+			}
+			_, shab64, modtime, size, name := splitSSFLine(s)
+			if shab64 == "" {
+				continue
+			}
+			if cli_name != "" {
+				if ok, _ := path.Match(cli_name, name); !ok {
+					continue
+				}
+			}
+			present[name] = true
+
+			secs, _ := strconv.ParseInt(modtime, 16, 64)
+			nbytes, _ := strconv.ParseInt(size, 16, 64)
+			detail := fmt.Sprintf("%s  %s  %s", shab64, time.Unix(secs, 0).Format(time.DateTime), bytesAsString(nbytes))
+			old, ok := current[name]
+			switch {
+			case !ok:
+				events[name] = append(events[name], fmt.Sprintf("  %-30s Appeared  %s", fn, detail))
+				if x > 0 {
+					interesting[name] = true
+				}
+			case old != shab64:
+				events[name] = append(events[name], fmt.Sprintf("  %-30s Changed   %s", fn, detail))
+				interesting[name] = true
+			}
+			current[name] = shab64
+		}
+		r.Close()
+
+		// anything we knew about that isn't in this manifest has gone
+		for name := range current {
+			if !present[name] {
+				events[name] = append(events[name], fmt.Sprintf("  %-30s Gone", fn))
+				interesting[name] = true
+				delete(current, name)
+			}
+		}
+	}
+
+	// report (with a pattern, show everything that matched - otherwise only files with a history)
+	var shown int
+	for _, name := range slices.Sorted(maps.Keys(events)) {
+		if cli_name == "" && !interesting[name] {
+			continue
+		}
+		fmt.Println(name)
+		for _, line := range events[name] {
+			fmt.Println(line)
+		}
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("No matching files changed across the given manifests")
+	}
+}
@@ -4,82 +4,101 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
+	"container/heap"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // ----------------------- "Topper" functions (used by latest.go and biggest.go)
 
+// The table is a bounded min-heap: its root is the entry that would be dropped next (lowest key, and the
+// latest arrival among equal keys), so each Add is O(log N) rather than a shuffle of the whole table.
+// Reports are in descending key order, with equal keys in order of arrival.
+
+type topEntry struct {
+	key   string // that which we sort on
+	iden  string // identifier block
+	name  string // reporting name
+	dupes int    // duplicate count
+	seq   int    // arrival order
+}
+
+type topHeap []*topEntry
+
+func (h topHeap) Len() int { return len(h) }
+func (h topHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].seq > h[j].seq
+}
+func (h topHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any)   { *h = append(*h, x.(*topEntry)) }
+func (h *topHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
 // globs
-var topKeys []string  // that which we sort on
-var topIdens []string // identifier block
-var topNames []string // reporting name
-var topDupes []int    // duplicate count
-var topDupeUsed bool  // whether we use dupes
-var topDepth int      // size of the table (N)
-var topLines int      // actual number of lines received
+var topTable topHeap               // the table (N entries, as a heap)
+var topByIden map[string]*topEntry // entries by identifier (for duplicate counting)
+var topDupeUsed bool               // whether we use dupes
+var topDepth int                   // size of the table (N)
+var topLines int                   // actual number of lines received
 
 // set up topper (can be size or date)
 func topInit(n int, useDupe bool, defaultKey string) {
 	topDepth = n
-	topKeys = make([]string, n)  // that which we sort on
-	topIdens = make([]string, n) // identifier block
-	topNames = make([]string, n) // reporting name
-	topDupes = make([]int, n)    // duplicate count
+	topTable = make(topHeap, n)
+	topByIden = make(map[string]*topEntry, n)
 	topDupeUsed = useDupe
 
 	for x := 0; x < n; x++ {
-		topKeys[x] = defaultKey
-		topNames[x] = "(no entry)"
-		topIdens[x] = ""
-		topDupes[x] = 0
+		topTable[x] = &topEntry{key: defaultKey, name: "(no entry)", seq: x}
 	}
+	heap.Init(&topTable)
+}
+
+// the lowest key in the table (callers can reject anything below it without Adding)
+func topThreshold() string {
+	return topTable[0].key
 }
 
 func topAdd(key string, id string, name string) string {
 	topLines++
-	//fmt.Print(topLines, name)
-	// do conditional dupes later
 
 	// quickly check for duplication
-	for x := 0; x < topDepth; x++ {
-		if topIdens[x] == id {
-			topDupes[x]++
-			return topKeys[topDepth-1]
-		}
+	if e, ok := topByIden[id]; ok {
+		e.dupes++
+		return topThreshold()
 	}
 
-	// perform ascending insertion
-	// fmt.Println("Want to insert", size, "into", sizes)
-	pos := topDepth - 2 // "the row above the end of table"
-	for pos >= 0 {
-		//fmt.Print("CHK", topKeys, "<", topKeys[pos], " (pos=", pos, ")\n")
-
-		if key <= topKeys[pos] { // <= required to get alpha on non-SHA search
-			//fmt.Print("\n", "BREAK: ", topKeys, "<", topKeys[pos], " pos=", pos, "\n")
-			break
-		}
-
-		// shift content down
-		// fmt.Print("/ roll ", pos, "to", pos+1)
-		topKeys[pos+1] = topKeys[pos]
-		topNames[pos+1] = topNames[pos]
-		topIdens[pos+1] = topIdens[pos]
-		topDupes[pos+1] = topDupes[pos]
-		pos--
-	}
-
-	// record insertion
-	pos++
-	// fmt.Printf("Insert %s at %d\n", size, pos)
-	topKeys[pos] = key
-	topNames[pos] = name
-	topIdens[pos] = id
-	topDupes[pos] = 1
+	// replace the entry that drops off the bottom
+	e := topTable[0]
+	delete(topByIden, e.iden)
+	*e = topEntry{key: key, iden: id, name: name, dupes: 1, seq: topDepth + topLines}
+	topByIden[id] = e
+	heap.Fix(&topTable, 0)
 
 	// return threshold (caller can reject without Adding)
-	return topKeys[topDepth-1]
+	return topThreshold()
+}
+
+// the table in report order (descending key, then arrival)
+func topSorted() []*topEntry {
+	sorted := slices.Clone(topTable)
+	slices.SortFunc(sorted, func(a, b *topEntry) int {
+		if c := strings.Compare(b.key, a.key); c != 0 {
+			return c
+		}
+		return a.seq - b.seq
+	})
+	return sorted
 }
 
 func topReportBySize(title string) {
@@ -87,26 +106,73 @@ func topReportBySize(title string) {
 	fmt.Println("POS   HEX SIZE   -----SIZE-----   #  FILENAME")
 	var decNum int64 = 0
 	var lastNum int64 = 0
+	table := topSorted()
 	for x := 0; x < min(topDepth, topLines); x++ {
-		decNum, _ = strconv.ParseInt(topKeys[x], 16, 0)
+		decNum, _ = strconv.ParseInt(table[x].key, 16, 0)
 		if !cli_ellipsis || decNum != lastNum {
 			// print full line every time
-			fmt.Printf("%2d:  %10s%16s %3d  %s\n", x+1, topKeys[x], intAsStringWithCommas(decNum), topDupes[x], topNames[x])
+			fmt.Printf("%2d:  %10s%16s %3d  %s\n", x+1, encodeSize(decNum), sizeAsString(decNum), table[x].dupes, table[x].name)
 		} else {
 			// use ellipsis to highlight repeated sizes/hashes
-			fmt.Printf("%2d:  %10s%16s %3d  %s\n", x+1, "   ....   ", "....     ", topDupes[x], topNames[x])
+			fmt.Printf("%2d:  %10s%16s %3d  %s\n", x+1, "   ....   ", "....     ", table[x].dupes, table[x].name)
 		}
 		lastNum = decNum
 	}
 }
 
+// a modify time for a report: ISO 8601 (local time, or UTC with --utc), or with --relative its age
+func topDate(t time.Time) string {
+	switch {
+	case cli_relative:
+		return relativeTime(t, time.Now())
+	case cli_utc:
+		return t.UTC().Format(time.RFC3339)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// how long ago t was, in the largest whole unit ("3 days ago", "2 years ago")
+func relativeTime(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 {
+		return "in the future"
+	}
+	days := int64(d.Hours() / 24)
+	var n int64
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int64(d.Minutes()), "minute"
+	case days < 1:
+		n, unit = int64(d.Hours()), "hour"
+	case days < 30:
+		n, unit = days, "day"
+	case days < 365:
+		n, unit = days/30, "month"
+	default:
+		n, unit = days/365, "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
+
 func topReportByDate(title string) {
 	fmt.Println(title)
-	fmt.Println("POS  HEX DATE   -------------DATE------------   FILENAME")
+	fmt.Println("POS  HEX DATE   -----------DATE----------   FILENAME")
 	var decnum int64 = 0
-	for x := 0; x < topDepth; x++ {
-		decnum, _ = strconv.ParseInt(topKeys[x], 16, 0)
-		t := time.Unix(decnum, 0)
-		fmt.Printf("%2d:  %s%32s   %s\n", x+1, topKeys[x], t, topNames[x])
+	for x, e := range topSorted() {
+		if e.iden == "" {
+			break // (the rest of the table was never filled)
+		}
+		decnum, _ = strconv.ParseInt(e.key, 16, 0)
+		if cli_reverse {
+			// (keys for oldest-first are upside down)
+			decnum = 0xffffffff - decnum
+		}
+		fmt.Printf("%2d:  %08x   %-25s   %s\n", x+1, decnum, topDate(time.Unix(decnum, 0)), e.name)
 	}
 }
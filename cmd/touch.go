@@ -0,0 +1,163 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// touchCmd represents the touch command
+var touchCmd = &cobra.Command{
+	Use:   "touch file.ssf",
+	Short: "Restore file modify times from an SSF where the hash matches",
+	Long: `shaman touch file.ssf [-p path]
+Sets the modify time of each file on disk to the time recorded in the SSF, but only when the file's hash
+matches the record - repairing timestamps mangled by a copy tool.
+For a named SSF (format 4/5) each record's file is checked directly.  For an anonymous SSF with times
+(format 2/3, e.g. the output of consolidate) the tree is walked and any file whose hash is in the SSF is
+re-patched to the (earliest) recorded time.
+   shaman touch file.ssf                     # files relative to the SSF's root (else the current directory)
+   shaman touch file.ssf -p /mnt/copy        # files relative to /mnt/copy`,
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G3",
+	Run: func(cmd *cobra.Command, args []string) {
+		tou(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(touchCmd)
+
+	touchCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	touchCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to, instead of the recorded root ('.' for the current directory)")
+	touchCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "List each file as its time is changed")
+}
+
+// ----------------------- Touch function below this line -----------------------
+
+// set the modify time of fn to the (hex) modtime if it differs - returns whether a change was made
+func touchFile(fn string, modtime string, name string) bool {
+	secs, err := strconv.ParseInt(modtime, 16, 64)
+	if err != nil {
+		return false
+	}
+	st, err := os.Stat(fn)
+	if err != nil || st.ModTime().Unix() == secs {
+		return false
+	}
+	t := time.Unix(secs, 0)
+	if err := os.Chtimes(fn, t, t); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot set time on %s: %v\n", fn, err)
+		return false
+	}
+	if cli_verbose {
+		fmt.Printf("  Touch: %s (%s)\n", name, t.Format(time.DateTime))
+	}
+	return true
+}
+
+func tou(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+
+	startpath := rootStart(files[0])
+
+	r, err := ssfOpen(files[0])
+	if err != nil {
+		abort(4, "Can't open "+files[0]+" - stuck!")
+	}
+	defer r.Close()
+
+	// named records are processed as we go, anonymous ones are collected for a tree walk
+	var earliest = map[string]string{} // sha -> modtime (anonymous records)
+	var sizes = map[int64]bool{}       // sizes seen in anonymous records (format 3)
+	var touched, matched, mismatched, missing int
+	var s string
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s = scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+
+		rec, ok := parseSSFRecord(s)
+		if !ok {
+			fmt.Printf("Skipping line %d - Invalid format\n", lineno)
+			continue
+		}
+		if rec.format >= 4 {
+			// named record - check the file it names
+			shab64, modtime, name := rec.shab64, rec.modtime, rec.name
+			fn := rootJoin(startpath, name)
+			if _, err := os.Stat(fn); err != nil {
+				missing++
+				continue
+			}
+			if _, sha := getFileSha256(fn); sha != shab64 {
+				mismatched++
+				continue
+			}
+			matched++
+			if touchFile(fn, modtime, name) {
+				touched++
+			}
+			continue
+		}
+
+		// anonymous record - needs a modtime
+		if rec.format == 1 {
+			abort(6, "SSF '"+files[0]+"' has no modify times (format 1) - nothing to restore from")
+		}
+		if v, ok := earliest[rec.shab64]; !ok || rec.modtime < v {
+			earliest[rec.shab64] = rec.modtime
+		}
+		if rec.format == 3 {
+			sizes[decodeHex(rec.size)] = true
+		}
+	}
+
+	if len(earliest) > 0 {
+		// walk the tree looking for content we know (only hashing plausible sizes if we have them)
+		opts := walkOptionsFromFlags()
+		fileQueue := make(chan triplex, 4096)
+		go func() {
+			defer close(fileQueue)
+			walkTreeToChannel(startpath, opts, fileQueue)
+		}()
+		for filerec := range fileQueue {
+			if len(sizes) > 0 && !sizes[filerec.size] {
+				continue
+			}
+			_, sha := getFileSha256(filerec.filename)
+			modtime, ok := earliest[sha]
+			if !ok {
+				continue
+			}
+			matched++
+			if touchFile(filerec.filename, modtime, filerec.filename) {
+				touched++
+			}
+		}
+	}
+
+	fmt.Printf("%d files matched, %d times restored", matched, touched)
+	if mismatched+missing > 0 {
+		fmt.Printf(" (%d changed content, %d missing)", mismatched, missing)
+	}
+	fmt.Println()
+}
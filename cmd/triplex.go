@@ -4,9 +4,12 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
-	"fmt"
+	"errors"
+	"io/fs"
 	"os"
 	"path"
+	"slices"
+	"strings"
 )
 
 // ----------------------- Triplex read channel handlers -----------------------
@@ -25,36 +28,264 @@ type triplex struct {
 	size     int64
 }
 
-func walkTreeToChannel(startpath string, c chan triplex) {
-	entries, err := os.ReadDir(startpath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Skipping directory: %s\n", startpath)
-		return
+// What the walker sends is set by a walkOptions, made from the command line by walkOptionsFromFlags in
+// the same way for every command that walks a tree, so that --no-dot, --exclude-ext and the rest behave
+// alike wherever they are offered (a flag a command does not offer is left at its default).
+type walkOptions struct {
+	noDot    bool     // leave out names beginning '.' (and everything under a directory that does)
+	exclude  []string // extensions to leave out (see below)
+	only     []string // extensions to keep (all others left out)
+	dirs     bool     // send directories too (see entries.go)
+	links    bool     // send symbolic links too
+	specials bool     // send sockets, FIFOs and devices too
+	sortFull bool     // sort directories as if their names ended '/' (see below)
+	maxDepth int      // levels to go down (1 = the top directory only, 0 = no limit)
+	oneFS    bool     // do not go into directories on other filesystems
+	quiet    bool     // (a count) report no errors, and show no progress
+}
+
+var cli_maxdepth int = 0   // levels of directory to walk (0 = all)
+var cli_onefs bool = false // stay on the filesystem of the top directory
+
+// Extension filters (--exclude-ext, --only-ext): files are left out of the walk by name alone, before
+// they are stat'ed or hashed.  Each is a comma-separated list, matched case-insensitively against the end
+// of the name (so "tar.gz" works), with or without the leading '.'.
+var cli_excludeext string = "" // extensions to leave out
+var cli_onlyext string = ""    // extensions to keep (all others left out)
+
+// the walk options given on the command line (checking them)
+func walkOptionsFromFlags() walkOptions {
+	parse := func(list string) []string {
+		var exts []string
+		for _, e := range strings.Split(strings.ToLower(list), ",") {
+			if e = strings.TrimPrefix(strings.TrimSpace(e), "."); e != "" {
+				exts = append(exts, "."+e)
+			}
+		}
+		return exts
+	}
+	opts := walkOptions{noDot: cli_nodot, exclude: parse(cli_excludeext), only: parse(cli_onlyext),
+		dirs: cli_dirs, links: cli_links, specials: cli_specials, sortFull: cli_sort == "full",
+		maxDepth: cli_maxdepth, oneFS: cli_onefs}
+	switch {
+	case cli_onlyext != "" && len(opts.only) == 0:
+		abort(6, "Invalid --only-ext '"+cli_onlyext+"' (expected e.g. jpg,png)")
+	case cli_maxdepth < 0:
+		abort(6, "Invalid --max-depth (expected 1 or more, or 0 for no limit)")
+	}
+	return opts
+}
+
+// Ordering: entries are sorted by name within each directory (fs.ReadDir does this, so the order does not
+// depend on the filesystem), and each directory's contents follow immediately in its place.  That is not
+// quite byte order overall - "a/x" comes before "a.txt" - so with sortFull set, directories are sorted
+// as if named "a/", making the whole output strict byte order (see 'generate --sort full').
+
+// the comment at the top of an SSF made with sortFull, so that lint knows which order to expect
+const sortFullComment = "# sort: full"
+
+// whether an SSF says it was made with sortFull (so is in byte order, rather than walk order)
+func ssfSortFull(fn string) bool {
+	return slices.Contains(ssfHeader(fn), sortFullComment)
+}
+
+// sort key of a directory entry (see above)
+func (opts walkOptions) sortKey(entry fs.DirEntry) string {
+	if opts.sortFull && entry.IsDir() {
+		return entry.Name() + "/"
+	}
+	return entry.Name()
+}
+
+// whether a file is wanted by the extension filters
+func (opts walkOptions) extWanted(name string) bool {
+	if opts.exclude == nil && opts.only == nil {
+		return true
+	}
+	name = strings.ToLower(name)
+	hasExt := func(exts []string) bool {
+		return slices.ContainsFunc(exts, func(e string) bool { return strings.HasSuffix(name, e) })
+	}
+	return !hasExt(opts.exclude) && (opts.only == nil || hasExt(opts.only))
+}
+
+// compare two names in walk order (without sortFull) - by each part of the path in turn
+func walkCompare(a string, b string) int {
+	return slices.Compare(strings.Split(a, "/"), strings.Split(b, "/"))
+}
+
+// The walk is over an io/fs.FS, so that a tree other than the local filesystem (a zip archive, a remote
+// store, or an fstest.MapFS for a test) can be walked in the same way, with the same order and filters.
+// walkTreeToChannel walks a local directory (through os.DirFS) - the names it sends are under startpath.
+func walkTreeToChannel(startpath string, opts walkOptions, c chan triplex) {
+	walkFSToChannel(os.DirFS(startpath), startpath, opts, c)
+}
+
+// The walk is iterative rather than recursive - a stack of the directories being walked, each with its
+// (sorted) entries and how far through them it is - so a tree thousands of directories deep needs no
+// deep call stack.  Each directory is read in full and closed before going into its subdirectories, so
+// only one is ever open.  A directory that is its own ancestor (a bind mount of a parent, say) is reported
+// as an error rather than walked forever.
+
+// walk fsys from its top, sending names joined to prefix
+func walkFSToChannel(fsys fs.FS, prefix string, opts walkOptions, c chan triplex) {
+	var topdev uint64
+	top, err := fs.Stat(fsys, ".")
+	if err == nil && opts.oneFS {
+		topdev, _ = fileDevice(top)
+	}
+
+	// a directory being walked (depth is that of its entries - 1 for those at the top)
+	type walkFrame struct {
+		dir     string
+		entries []fs.DirEntry
+		next    int
+		depth   int
+		id      string // device and inode ("" if not known)
+	}
+	var stack []*walkFrame
+	onStack := map[string]string{} // ids of the directories being walked -> their names
+
+	report := func(what string, name string, err error) {
+		if !opts.quiet {
+			fileError(what, name, err)
+		}
 	}
+	showDir := func(name string) {
+		if !opts.quiet {
+			progressDir(name)
+		}
+	}
+
+	// read a directory onto the stack
+	push := func(dir string, info fs.FileInfo, depth int) {
+		name := path.Join(prefix, dir)
+		var id string
+		if info != nil {
+			id = fileID(info)
+		}
+		if outer, ok := onStack[id]; ok && id != "" {
+			report("directory", name, errors.New("cycle - it is "+outer+" again"))
+			return
+		}
+		showDir(name)
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			if pe, ok := err.(*fs.PathError); ok {
+				pe.Path = name // (the name as the user knows it, not within fsys)
+			}
+			report("directory", name, err)
+			return
+		}
+		slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+			return strings.Compare(opts.sortKey(a), opts.sortKey(b))
+		})
+		if id != "" {
+			onStack[id] = name
+		}
+		stack = append(stack, &walkFrame{dir, entries, 0, depth, id})
+	}
+	push(".", top, 1)
+
+	// step through the contents of the innermost directory
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		if f.next == len(f.entries) {
+			showDir("")
+			delete(onStack, f.id)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		entry := f.entries[f.next]
+		f.next++
 
-	// step through contents of this dir
-	for _, entry := range entries {
+		if opts.noDot && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		rel := path.Join(f.dir, entry.Name())
+		name := path.Join(prefix, rel)
 		if !entry.IsDir() {
-			if !entry.Type().IsRegular() {
-				// we ignore symlinks
+			if !entry.Type().IsRegular() && !(opts.links && entry.Type()&fs.ModeSymlink != 0) &&
+				!(opts.specials && entrySpecialKind(entry.Type()) != "") {
+				// we ignore symlinks, sockets, FIFOs and devices (unless recording them)
+				continue
+			}
+			if !opts.extWanted(entry.Name()) {
 				continue
 			}
 
-			name := path.Join(startpath, entry.Name())
+			// (for a symlink, this is the link itself - its size is the length of the target; for a
+			// special file, it is 0)
 			info, err := entry.Info()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Skipping entry: %s\n", name)
+				report("entry", name, err)
 				continue
 			}
 
 			c <- triplex{name, info.ModTime().Unix(), info.Size()}
 		} else {
-			// it's a directory - dig down
-			walkTreeToChannel(path.Join(startpath, entry.Name()), c)
+			// it's a directory - record it (if asked), then dig down (unless too deep, or elsewhere)
+			info, err := entry.Info()
+			if opts.dirs && err == nil {
+				c <- triplex{entryDirName(name), info.ModTime().Unix(), 0}
+			}
+			if opts.maxDepth > 0 && f.depth >= opts.maxDepth {
+				continue
+			}
+			if opts.oneFS && err == nil {
+				if dev, ok := fileDevice(info); ok && dev != topdev {
+					continue
+				}
+			}
+			if err != nil {
+				info = nil
+			}
+			push(rel, info, f.depth+1)
 		}
 	}
 }
 
+// ----------------------- Hashing stage (worker pool)
+
+// A triplex with its hash attached
+type hashedTriplex struct {
+	triplex
+	shab64 string
+	quick  string // annotation if the hash is a partial (--quick) one
+}
+
+// Hash the files arriving from the walker using a pool of workers, delivering the results in the
+// same order as they arrived (so the SSF remains sorted).  One worker is the same as hashing inline.
+func hashTriplexes(in chan triplex, workers int) chan hashedTriplex {
+	workers = max(workers, 1)
+	out := make(chan hashedTriplex, 4096)
+	pending := make(chan chan hashedTriplex, workers*4) // bounded look-ahead, in walk order
+
+	go func() {
+		defer close(pending)
+		sem := make(chan struct{}, workers)
+		for t := range in {
+			res := make(chan hashedTriplex, 1)
+			pending <- res
+			sem <- struct{}{}
+			go func(t triplex) {
+				sha, quick := getFileSha256Quick(t.filename, t.size, quickHead)
+				res <- hashedTriplex{t, sha, quick}
+				<-sem
+			}(t)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range pending {
+			out <- <-res
+		}
+	}()
+
+	return out
+}
+
 // ----------------------- Directory traversal (producer)
 
 //var fileQueue = chan triplex
@@ -75,7 +306,7 @@ func getNextTriplex(fileQueue chan triplex) (fs_name string, fs_modt string, fs_
 		return "", "", ""
 	} else {
 		return t.filename,
-			fmt.Sprintf("%08x", t.modified), // always 8 digits
-			fmt.Sprintf("%04x", t.size) // overflows 4-8 digits
+			encodeModTime(t.modified), // always 8 digits
+			encodeSize(t.size) // 4 digits or more
 	}
 }
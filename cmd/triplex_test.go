@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// the names walkFSToChannel sends for fsys (joined to prefix)
+func walkNames(fsys fs.FS, prefix string, opts walkOptions) []string {
+	c := make(chan triplex, 4096)
+	go func() {
+		defer close(c)
+		walkFSToChannel(fsys, prefix, opts, c)
+	}()
+	var names []string
+	for t := range c {
+		names = append(names, t.filename)
+	}
+	return names
+}
+
+func TestWalkFSToChannel(t *testing.T) {
+	tree := fstest.MapFS{
+		"a.txt":         {Data: []byte("1")},
+		"a/x":           {Data: []byte("2")},
+		"a/b/deep.jpg":  {Data: []byte("3")},
+		"a-b":           {Data: []byte("4")},
+		"b.JPG":         {Data: []byte("5")},
+		".hidden":       {Data: []byte("6")},
+		".git/config":   {Data: []byte("7")},
+		"c/d.tar.gz":    {Data: []byte("8")},
+		"c/.cache/keep": {Data: []byte("9")},
+	}
+
+	tests := []struct {
+		name string
+		opts walkOptions
+		want []string
+	}{
+		{"walk order (a/x before a.txt)", walkOptions{},
+			[]string{"t/.git/config", "t/.hidden", "t/a/b/deep.jpg", "t/a/x", "t/a-b", "t/a.txt", "t/b.JPG", "t/c/.cache/keep", "t/c/d.tar.gz"}},
+		{"--sort full (byte order)", walkOptions{sortFull: true},
+			[]string{"t/.git/config", "t/.hidden", "t/a-b", "t/a.txt", "t/a/b/deep.jpg", "t/a/x", "t/b.JPG", "t/c/.cache/keep", "t/c/d.tar.gz"}},
+		{"--no-dot prunes dot directories", walkOptions{noDot: true},
+			[]string{"t/a/b/deep.jpg", "t/a/x", "t/a-b", "t/a.txt", "t/b.JPG", "t/c/d.tar.gz"}},
+		{"--exclude-ext", walkOptions{exclude: []string{".jpg", ".tar.gz"}},
+			[]string{"t/.git/config", "t/.hidden", "t/a/x", "t/a-b", "t/a.txt", "t/c/.cache/keep"}},
+		{"--only-ext (case-insensitive)", walkOptions{only: []string{".jpg"}},
+			[]string{"t/a/b/deep.jpg", "t/b.JPG"}},
+		{"--max-depth 1", walkOptions{maxDepth: 1},
+			[]string{"t/.hidden", "t/a-b", "t/a.txt", "t/b.JPG"}},
+		{"--max-depth 2", walkOptions{maxDepth: 2, noDot: true},
+			[]string{"t/a/x", "t/a-b", "t/a.txt", "t/b.JPG", "t/c/d.tar.gz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := walkNames(tree, "t", tt.opts); !slices.Equal(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// the walk order is the order walkCompare gives (without sortFull), which update's merge relies on
+func TestWalkCompareMatchesWalk(t *testing.T) {
+	tree := fstest.MapFS{
+		"a.txt": {}, "a/x": {}, "a/y/z": {}, "a-b": {}, "a0": {}, "ab/c": {}, "b": {},
+	}
+	got := walkNames(tree, "", walkOptions{})
+	if !slices.IsSortedFunc(got, walkCompare) {
+		t.Errorf("walk order %q is not walkCompare order", got)
+	}
+	sorted := slices.Clone(got)
+	slices.SortFunc(sorted, walkCompare)
+	if !slices.Equal(got, sorted) {
+		t.Errorf("got %q, walkCompare sorts to %q", got, sorted)
+	}
+}
+
+// a tree thousands of directories deep is walked to the bottom, every file sent (the walk is iterative)
+func TestWalkFSToChannelDeep(t *testing.T) {
+	const depth = 5000
+	tree := fstest.MapFS{}
+	var want []string
+	dir := "d"
+	for level := 1; level <= depth; level++ {
+		if level%100 == 0 {
+			tree[dir+"/f"] = &fstest.MapFile{Data: []byte("x")}
+			want = append(want, dir+"/f")
+		}
+		dir += "/d"
+	}
+	tree[dir+"/leaf"] = &fstest.MapFile{Data: []byte("y")}
+	want = append(want, dir+"/leaf")
+	slices.SortFunc(want, walkCompare)
+
+	got := walkNames(tree, "", walkOptions{})
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %d files, want %d", len(got), len(want))
+	}
+	if got := walkNames(tree, "", walkOptions{maxDepth: 250}); len(got) != 2 {
+		t.Errorf("--max-depth 250 gave %d files, want 2 (those at levels 100 and 200)", len(got))
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// -------------------------------- Cobra management -------------------------------
+
+// untrackedCmd represents the untracked command
+var untrackedCmd = &cobra.Command{
+	Use:   "untracked file.ssf",
+	Short: "List files on disk that have no record in an SSF",
+	Long: `shaman untracked file.ssf [-p path]
+Walks the tree (default current directory) and lists the files that are not in the SSF - a quick
+"what hasn't been baselined yet" check.  Nothing is hashed, and the SSF is not changed.
+The tree is that of the SSF's names: the root recorded in it (see 'shaman generate'), --root, or --path,
+and the untracked files are listed by their names relative to it.
+Exit code is 0 if every file is tracked, 1 otherwise.`,
+	Aliases: []string{"unt"},
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G2",
+	Run: func(cmd *cobra.Command, args []string) {
+		unt(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(untrackedCmd)
+
+	untrackedCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	untrackedCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to, instead of the recorded root ('.' for the current directory)")
+	untrackedCmd.Flags().BoolVarP(&cli_nodot, "no-dot", "", false, "Do not include files/directories beginning '.'")
+}
+
+// ----------------------- Untracked function below this line -----------------------
+
+func unt(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	if !found[0] {
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	}
+
+	startpath := rootStart(files[0])
+	abs, err := filepath.Abs(startpath)
+	if err != nil {
+		abort(6, "Cannot find '"+startpath+"': "+err.Error())
+	}
+
+	// (matched by where they are, so that an absolute name is matched as well as a relative one)
+	var tracked = map[string]bool{}
+	ssfForEachRecord(files[0], func(rec ssfRecord) {
+		if rec.format >= 4 {
+			tracked[rootJoin(abs, rec.name)] = true
+		}
+	})
+	if len(tracked) == 0 {
+		abort(6, "SSF '"+files[0]+"' has no named records - nothing to match against")
+	}
+
+	opts := walkOptionsFromFlags()
+	fileQueue := make(chan triplex, 4096)
+	go func() {
+		defer close(fileQueue)
+		walkFSToChannel(os.DirFS(startpath), "", opts, fileQueue)
+	}()
+
+	var total, untracked int
+	for filerec := range fileQueue {
+		name := filerec.filename
+		total++
+		if tracked[rootJoin(abs, name)] {
+			continue
+		}
+		fmt.Println(name)
+		untracked++
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d files untracked\n", untracked, total)
+	if untracked > 0 {
+		abort(1, "")
+	}
+}
@@ -6,20 +6,46 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
-	"bufio"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // -------------------------------- Cobra management -------------------------------
 
 // updateCmd represents the update command
 var updateCmd = &cobra.Command{
-	Use:     "update",
-	Short:   "Update an existing SSF file",
-	Long:    `Update an existing SSF file`,
+	Use:   "update",
+	Short: "Update an existing SSF file",
+	Long: `shaman update old.ssf [new.ssf] [-o]
+Updates an existing SSF file from the tree: new files are hashed and added, changed ones (modify time or
+size) re-hashed, and deleted ones dropped.  With -v each change is listed - except that a directory
+that was moved or renamed as a whole is one 'Mov dir: old/ -> new/' line, rather than a Del and a New for
+every file in it.
+With --checkpoint, a long update saves its position every interval, so that after an interruption it can
+be carried on with --resume (given the same files) rather than started again:
+   shaman update --checkpoint 10m huge.ssf huge-new.ssf
+   shaman update --resume huge.ssf huge-new.ssf
+Comments are dropped, unless --keep-comments is given: then each run of comment lines stays before the
+record it came before (or, if that was deleted, the next record written), and any at the end stay at
+the end.  The totals, duplicates, partial and error comments shaman writes itself are not carried.
+With --check PORT, the progress is served as JSON at /progress, and with --progress the directory being
+read and file being hashed are shown as it goes (see 'shaman generate').
+With --dry-run, everything is done (including hashing) but nothing is written, replaced or removed: the
+output's size and destination are reported instead.
+An SSF made with 'shaman generate --sort full' (marked '# sort: full') is kept in that order, and marked.
+With --deleted-to gone.ssf, the records that are dropped (files deleted - or moved, under their old names)
+are written to a side file as they were, with their SHA, modify time, size and annotations, as a record
+of what left the tree between the two baselines.
+With --drop-known known.ssf, new files whose SHA256 is in that reference set are left out (as for
+'shaman generate --drop-known').`,
 	Aliases: []string{"upd"},
 	GroupID: "G1",
 	Run: func(cmd *cobra.Command, args []string) {
@@ -32,27 +58,84 @@ func init() {
 
 	// NB: no anonymous switch for update (also, be aware, cannot update an anonymous file)
 	updateCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Path to directory to scan (default is current directory)")
-	updateCmd.Flags().IntVarP(&cli_format, "format", "f", 0, "Format/anonymisation level 1..5 (default: 5)")
+	updateCmd.Flags().StringVarP(&cli_format, "format", "f", "", "Format: sha, sha+time, sha+time+size, named or full (or 1..5, default full)")
 	//updateCmd.Flags().BoolVarP(&cli_dupes, "dupes", "d", false, "Whether to show dupes (as comments) on completion")
 	//updateCmd.Flags().BoolVarP(&cli_grand, "grand-totals", "g", false, "Display grand totals of bytes/files on completion")
 	//updateCmd.Flags().BoolVarP(&cli_summary, "summary", "s", false, "Summarise differences (do not update the reference .ssf)")
 	updateCmd.Flags().BoolVarP(&cli_overwrite, "overwrite", "o", false, "Replace input .ssf with updated one (if changed)")
 	updateCmd.Flags().BoolVarP(&cli_rehash, "re-hash", "r", false, "Re-hash files for maximum integrity (compromise detection)")
+	updateCmd.Flags().StringVarP(&cli_sample, "re-hash-sample", "", "", "Re-hash a random percentage of unchanged files, e.g. 5%")
+	updateCmd.Flags().Uint64VarP(&cli_seed, "seed", "", 0, "Random seed for --re-hash-sample (default: different each run)")
+	updateCmd.Flags().Int64VarP(&cli_maxfiles, "max-files", "", 0, "Stop checking after this many files (the rest are carried through)")
+	updateCmd.Flags().StringVarP(&cli_maxbytes, "max-bytes", "", "", "Stop checking after this many bytes, e.g. 500G (the rest are carried through)")
 	updateCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "Give running commentary of update")
+	updateCmd.Flags().IntVarP(&cli_workers, "workers", "w", 1, "Number of files to hash in parallel (see 'shaman bench')")
+	updateCmd.Flags().StringVarP(&cli_annotate, "annotate", "a", "", "Annotate new/changed records (e.g. 'media')")
+	updateCmd.Flags().StringVarP(&cli_errors, "errors", "", "", "Unreadable files: skip, record (as '# error:' comments) or fail - with a count at the end, and rc 5")
+	updateCmd.Flags().StringVarP(&cli_chunks, "chunks", "", "", "Record the content-defined chunks of new/changed files this size or over, e.g. 1G")
+	updateCmd.Flags().StringVarP(&cli_excludeext, "exclude-ext", "", "", "Leave out files with these extensions (any already in the SSF are dropped)")
+	updateCmd.Flags().StringVarP(&cli_onlyext, "only-ext", "", "", "Only include files with these extensions (any others in the SSF are dropped)")
+	updateCmd.Flags().BoolVarP(&cli_dirs, "dirs", "", false, "Record directories (name ending '/') as well as files")
+	updateCmd.Flags().BoolVarP(&cli_links, "links", "", false, "Record symbolic links (with their target) as well as files")
+	updateCmd.Flags().IntVarP(&cli_maxdepth, "max-depth", "", 0, "Levels of directory to go down (1 = the top only, default: all)")
+	updateCmd.Flags().BoolVarP(&cli_onefs, "one-file-system", "x", false, "Do not go into directories on other filesystems (mounts)")
+	updateCmd.Flags().BoolVarP(&cli_specials, "specials", "", false, "Record sockets, FIFOs and devices (by type) as well as files")
+	updateCmd.Flags().BoolVarP(&cli_stats, "stats", "", false, "Show throughput, elapsed time and the slowest files on completion")
+	updateCmd.Flags().StringVarP(&cli_encryptto, "encrypt-to", "", "", "Encrypt the output to an age recipient (age1...) or PGP key")
+	updateCmd.Flags().StringVarP(&cli_checkpoint, "checkpoint", "", "", "Save the position every interval (e.g. 10m), so that the update can be resumed")
+	updateCmd.Flags().BoolVarP(&cli_resume, "resume", "", false, "Carry on an interrupted update from its checkpoint")
+	updateCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	updateCmd.Flags().StringVarP(&cli_deletedto, "deleted-to", "", "", "Write the records of deleted files to this SSF (a journal of what left the tree)")
+	updateCmd.Flags().BoolVarP(&cli_dryrun, "dry-run", "n", false, "Do everything but write: report what would be written, touching no file")
+	updateCmd.Flags().BoolVarP(&cli_progress, "progress", "", false, "Show the directory being read and file being hashed (on stderr)")
+	updateCmd.Flags().StringVarP(&cli_check, "check", "", "", "Serve progress as JSON on this port (e.g. 8080) at /progress")
+	updateCmd.Flags().BoolVarP(&cli_keepcomments, "keep-comments", "", false, "Carry comment lines through, with the records they come before")
+	updateCmd.Flags().StringVarP(&cli_dropknown, "drop-known", "", "", "Leave out new files whose hash is in this set of known-good hashes")
 }
 
-// ----------------------- Update function below this line -----------------------
+var cli_sample string = ""    // percentage of unchanged files to re-hash on each run
+var cli_seed uint64 = 0       // seed for the sample (0=random)
+var cli_deletedto string = "" // side file for the records dropped
 
-func upd(args []string) {
-	var fnr string      // filename for reading
-	var fnw string      // where to write to (filename to open)
-	var w *bufio.Writer // buffer writer
-	var form int = 5    // format defaults to 5
+// ----------------------- Update function below this line -----------------------
 
-	// for update, the format default is 5 (full)
-	if cli_format != 0 {
-		form = cli_format
+// Returns a function that says whether an unchanged file should be re-hashed this run.  Over a series of
+// runs with different seeds, every file is eventually checked - at a bounded cost per run.
+func updateSampler() func() bool {
+	if cli_sample == "" {
+		return func() bool { return false }
+	}
+	pct, err := strconv.ParseFloat(strings.TrimSuffix(cli_sample, "%"), 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		abort(6, "Invalid --re-hash-sample '"+cli_sample+"' (expected a percentage, e.g. 5%)")
 	}
+	seed := cli_seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	fmt.Printf("Re-hashing a %g%% sample of unchanged files (seed %d)\n", pct, seed)
+	rng := rand.New(rand.NewPCG(seed, 0))
+	return func() bool {
+		return rng.Float64()*100 < pct
+	}
+}
+
+func upd(args []string) {
+	var fnr string  // filename for reading
+	var fnw string  // where to write to (filename to open)
+	var w *writeSSF // buffer writer
+
+	form := formatParse(5, 1, 2, 3, 4, 5) // format defaults to 5 (full)
+
+	annotateValidate()
+	opts := walkOptionsFromFlags()
+	knownLoad()
+	errorsValidate()
+	scanLimitsValidate()
+	sample := updateSampler()
+	every := checkpointInterval()
+	statsStart()
+	var nsampled int
 
 	// process CLI
 	num, files, found := getSSFs(args)
@@ -64,19 +147,26 @@ func upd(args []string) {
 		abort(9, "Input file not specified")
 	case !found[0]:
 		abort(6, "SSF file '"+files[0]+"' does not exist")
-	case num > 1 && found[1]:
+	case num > 1 && found[1] && !cli_resume:
 		fmt.Println("Output file '" + files[1] + "' will be overwritten")
 	}
 
 	// create reader from fnr get got from getSSF
 	fnr = files[0]
-	var r *os.File
-	r, err := os.Open(fnr)
+	var r *ssfFile
+	r, err := ssfOpen(fnr)
 	if err != nil {
 		abort(4, "Internal error #4: ")
 	}
 	defer r.Close()
 
+	// an SSF made with --sort full is in byte order - the walk and the merge follow it
+	opts.sortFull = ssfSortFull(fnr)
+	compare := walkCompare
+	if opts.sortFull {
+		compare = strings.Compare
+	}
+
 	// create writer as same file with ".temp" suffix
 	if num == 1 && !cli_overwrite {
 		// One file given, nowhere to write output (quick though)
@@ -100,102 +190,370 @@ func upd(args []string) {
 		abort(3, "unexpected update")
 	}
 
+	// names are found from the SSF's root (or --root, or an absolute --path) - so the walk is made from there
+	// (but an SSF of absolute names, from before roots were recorded, is still walked as it was made)
+	root, absnames := "", filepath.IsAbs(cli_path) && ssfRoot(fnr) == ""
+	switch {
+	case filepath.IsAbs(cli_path) && !absnames:
+		root = filepath.Clean(cli_path)
+	case cli_path == "":
+		root = rootResolve(fnr)
+	}
+	if root != "" {
+		abs := func(fn string) string {
+			if fn == "" {
+				return ""
+			}
+			a, _ := filepath.Abs(fn)
+			return a
+		}
+		fnr, fnw, cli_deletedto = abs(fnr), abs(fnw), abs(cli_deletedto)
+		if err := os.Chdir(root); err != nil {
+			abort(4, "Cannot change to root "+root+": "+err.Error())
+		}
+		fmt.Println("Walking from " + root + " (" + rootSource() + ")")
+	}
+
 	// open writing buffer (if used)
-	w = writeInit(fnw)
 	amWriting := (fnw != "")
+	if !amWriting || cli_dryrun {
+		cli_encryptto = "" // (nothing to encrypt in a dry-run)
+	}
+	var resume *updateCheckpoint
+	switch {
+	case (every > 0 || cli_resume) && !amWriting:
+		abort(6, "--checkpoint and --resume need an output (give a second file, or '-o')")
+	case (every > 0 || cli_resume) && cli_dryrun:
+		abort(6, "--checkpoint and --resume cannot be used with --dry-run")
+	case (every > 0 || cli_resume) && cli_encryptto != "":
+		abort(6, "--checkpoint and --resume cannot be used with --encrypt-to")
+	case cli_resume:
+		resume = checkpointLoad(fnw, fnr)
+		w = checkpointWriter(fnw, resume)
+	default:
+		if !cli_dryrun {
+			os.Remove(checkpointName(fnw)) // (any left from an earlier run no longer applies)
+		}
+		w = writeInit(fnw)
+		if amWriting && !absnames && form >= 4 {
+			fmt.Fprintln(w, rootComment(cli_path))
+		}
+		if amWriting && opts.sortFull {
+			fmt.Fprintln(w, sortFullComment)
+		}
+	}
+
+	// the journal of deleted records (if asked for)
+	var gone *writeSSF
+	if cli_deletedto != "" {
+		if _, err := os.Stat(cli_deletedto); err == nil {
+			abort(6, "--deleted-to file '"+cli_deletedto+"' already exists")
+		}
+		if cli_resume {
+			abort(6, "--deleted-to cannot be used with --resume (the records dropped before the checkpoint are not known)")
+		}
+		gone = writeInit(cli_deletedto)
+		fmt.Fprintf(gone, "# deleted: records dropped by update of %s at %s\n", fnr, time.Now().UTC().Format(time.RFC3339))
+	}
 
 	// get tree start, and initiate producer channel
 	var startpath string = "."
-	if cli_path != "" {
+	if cli_path != "" && root == "" {
 		startpath = cli_path // add validation here
 	}
+	progressServe("update", startpath, opts)
 	fileQueue := make(chan triplex, 4096)
 	go func() {
 		defer close(fileQueue)
-		walkTreeToChannel(startpath, fileQueue)
+		walkTreeToChannel(startpath, opts, fileQueue)
 	}()
 
-	// for now, perform copy (as a test) using scanner on 'r' buffer, max line is 64k
-	var lineno int = 0 // needed for error reporting on .ssf file corruptions
 	var verbosity int = 1
-	if cli_verbose {
+	switch {
+	case cli_verbose:
 		verbosity = 2
-	} else {
+	case cli_progress:
+		verbosity = 0 // (the status line instead of dots)
+	default:
 		fmt.Print("Processing")
 	}
 
+	// pipeline: SSF reader and tree walker -> merge (decides each record) -> hashers -> writer (here)
+	var stopped string // name of the record at which a limit was reached
+	jobs := make(chan updateJob, 4096)
+	go func() {
+		defer close(jobs)
+		stopped, nsampled = updateMerge(updateReadSSF(r), fileQueue, compare, sample, jobs, resume)
+	}()
+	nextCheckpoint := time.Now().Add(every)
+	moves := updateMovesInit()
+	var held []string  // kept comments, waiting for a record to be written
+	var ninvalid int64 // lines deleted for being invalid (not journalled - they have no record)
+	for j := range updateHash(jobs, cli_workers, amWriting) {
+		held = append(held, j.comments...)
+		if j.lineno > 0 {
+			ninvalid++
+			fmt.Printf("Deleting line %d - Invalid format on line\n", j.lineno)
+			w.record(amWriting, form, 0, "D", "", "", "", "", "", "")
+			continue
+		}
+		if j.tag == "E" || j.tag == "#" {
+			continue // (unreadable - see fileError - or just the comments at the end)
+		}
+		if j.tag == "N" && knownDrop(j.shab64, decodeHex(j.size)) {
+			continue
+		}
+		if j.tag == "D" && gone != nil {
+			gone.record(true, 5, 0, "N", j.shab64, j.modt, j.size, j.annot, j.name, "")
+		}
+		if amWriting {
+			for _, c := range held {
+				fmt.Fprintln(w, c)
+			}
+		}
+		held = nil
+		if verbosity == 2 && moves.hold(j) {
+			// (reported once all are in, so that a moved directory can be one line)
+			w.record(amWriting, form, 0, j.tag, j.shab64, j.modt, j.size, j.annot, j.name, j.flags)
+		} else {
+			w.record(amWriting, form, verbosity, j.tag, j.shab64, j.modt, j.size, j.annot, j.name, j.flags)
+		}
+		if j.tag != "D" {
+			progressNote(j.name, decodeHex(j.size))
+		}
+		if every > 0 && time.Now().After(nextCheckpoint) {
+			checkpointSave(fnw, fnr, w, j.name)
+			nextCheckpoint = time.Now().Add(every)
+		}
+	}
+
+	// End of processing - report the number of changes
+	progressDone()
+	if gone != nil {
+		gone.close()
+		fmt.Printf("%d deleted records written to %s\n", gone.files(), cli_deletedto)
+		if gone.files() != w.deleted()-ninvalid {
+			// (every deleted record - wherever it falls in the walk - must be in the journal)
+			abort(10, fmt.Sprintf("%d records deleted but %d journalled to %s", w.deleted()-ninvalid, gone.files(), cli_deletedto))
+		}
+	}
+	if verbosity == 1 {
+		fmt.Println()
+	}
+	moves.report()
+	nchanges := w.added() + w.deleted() + w.changed()
+	updateDetails := fmt.Sprintf("(new=%d, deleted=%d, changed=%d, unchanged=%d)", w.added(), w.deleted(), w.changed(), w.unchanged())
+
+	switch nchanges {
+	case 0:
+		fmt.Println("There were 0 changes - " + fnr + " still good")
+	case 1:
+		fmt.Println("There was 1 change " + updateDetails)
+	default:
+		fmt.Println("There were", nchanges, "changes "+updateDetails)
+	}
+	if stopped != "" {
+		fmt.Println("Limit reached - records from " + stopped + " onwards were carried through unchecked")
+	}
+	if cli_sample != "" {
+		fmt.Printf("Sample: %d unchanged files re-hashed\n", nsampled)
+	}
+	knownReport(os.Stdout)
+	statsReport(os.Stdout, cli_workers)
+	slog.Debug("changes", "new", w.added(), "del", w.deleted(), "nchg", w.changed(), "unchanged", w.unchanged(), "tf", w.files(), "tb", w.bytes())
+
+	// (the exit code says whether there were changes - or errors, which take precedence)
+	exit := func(rc int) {
+		if errorsReport() {
+			rc = errorsExit
+		}
+		os.Exit(rc)
+	}
+
+	// Optional totals and duplicates statements + file shuffle and final buffer flush
+	if amWriting {
+		for _, c := range held {
+			fmt.Fprintln(w, c)
+		}
+		if stopped != "" {
+			fmt.Fprintln(w, scanPartialComment("update", stopped))
+		}
+		errorsRecord(w)
+		reportGrandTotals(w.Writer, w.files(), w.bytes())
+		reportDupes(w.Writer)
+		w.close()
+		if !cli_dryrun {
+			os.Remove(checkpointName(fnw))
+		}
+
+		if cli_overwrite {
+			if nchanges == 0 && !cli_dryrun {
+				// destroy tempfile
+				os.Remove(fnw)
+			} else if nchanges > 0 {
+				fmt.Println("Overwriting " + fnr)
+				ssfReplace(fnw, fnr)
+				exit(1)
+			} else if cli_grand || cli_dupes {
+				// if the ssf file was correct, then we do not update it to preserve its timestamp
+				// but this means that we have to leave its total/dupes statements as-is - i.e. if
+				// we wrote these, then this metadata change would be the only change to the ssf
+				fmt.Println("Ignoring --grand-total and/or --dupes in order to retain file timestamp")
+			}
+		}
+	}
+
+	exit(0) //explicit (because we're a rc=0 or rc=1 depending on whether any changes)
+}
+
+// ----------------------- Update pipeline -----------------------
+
+// An update runs as a pipeline, so that a slow disk does not stall everything: the SSF reader and tree
+// walker feed the merge, which decides what each record is; hashing is done by a pool of workers; and
+// the writer takes the results in order.  Each stage is joined by a bounded channel.
+
+// one output record, in SSF order - an 'R' (re-hash) becomes 'C' or 'V' once hashed by updateHash
+type updateJob struct {
+	tag    string
+	shab64 string
+	modt   string
+	size   string
+	annot  string
+	name   string
+	flags  string
+	lineno int // for an invalid SSF line (deleted)
+
+	comments []string // (--keep-comments) to be written before it - or, if it is not written, the next
+}
+
+// one line of the SSF being updated (ok=false for an invalid record)
+type updateLine struct {
+	rec    ssfRecord
+	ok     bool
+	lineno int // needed for error reporting on .ssf file corruptions
+
+	comments []string // (--keep-comments) those before it - or, for the last line (lineno 0), at the end
+}
+
+// read the SSF's records, dropping empty lines and comments, unless kept (max line is 64k)
+func updateReadSSF(r *ssfFile) chan updateLine {
+	lines := make(chan updateLine, 4096)
+	go func() {
+		defer close(lines)
+		var lineno int = 0
+		var held []string
+		scanner := ssfScanner(r)
+		for scanner.Scan() {
+			s := scanner.Text()
+			lineno++
+			if len(s) == 0 || s[0:1] == "#" {
+				if cli_keepcomments && len(s) > 0 && !commentIsGenerated(s) {
+					held = append(held, s)
+				}
+				continue
+			}
+			rec, ok := parseSSFRecord(s)
+			lines <- updateLine{rec, ok && rec.format >= 4, lineno, held}
+			held = nil
+		}
+		if len(held) > 0 {
+			lines <- updateLine{comments: held}
+		}
+	}()
+	return lines
+}
+
+// merge the SSF records with the tree (both in the order of compare), deciding what happens to each - when
+// resuming, the records up to the checkpoint's were dealt with already, and are skipped
+func updateMerge(lines chan updateLine, fileQueue chan triplex, compare func(a, b string) int, sample func() bool, jobs chan updateJob, resume *updateCheckpoint) (stopped string, nsampled int) {
+	// totals for the limits (as the writer will count them)
+	var nfiles, nbytes int64
+	var after string
+	if resume != nil {
+		nfiles, nbytes, after = resume.Files, resume.Bytes, resume.Last
+	}
+	done := func(name string) bool {
+		return after != "" && compare(name, after) <= 0
+	}
+	var carry, tail []string // kept comments for the next job, and those at the end
+	emit := func(j updateJob) {
+		if j.tag != "D" {
+			nfiles++
+			nbytes += decodeHex(j.size)
+		}
+		j.comments, carry = carry, nil
+		jobs <- j
+	}
+
 	trip_name, trip_modt, trip_size := getNextTriplex(fileQueue)
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		// process the line from scanner (from the SSF file)
-		s := scanner.Text()
-		lineno++
-		//fmt.Println(lineno, s)
-
-		// drop comments or empty lines
-		if len(s) == 0 || s[0:1] == "#" {
+	for trip_name != "" && done(trip_name) {
+		trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
+	}
+	skipping := after != ""
+	for line := range lines {
+		if line.lineno == 0 {
+			tail = line.comments
 			continue
 		}
+		if skipping && (!line.ok || done(line.rec.name)) {
+			continue
+		}
+		skipping = false
+		if !line.ok {
+			carry = append(carry, line.comments...)
+			emit(updateJob{tag: "D", lineno: line.lineno})
+			continue
+		}
+		ssf := line.rec
 
-		// chop up s to get fields *FIXME* add annotation handling here **
-		pos := strings.IndexByte(s, 32)
-		if pos == -1 || pos < 55 {
-			fmt.Printf("Deleting line %d - Invalid format on line (pos %d)\n", lineno, pos)
-			ndel++
+		// 0/5 Once over the limit, the remaining records are carried through unchecked
+		if stopped == "" && scanLimitReached(nfiles, nbytes) {
+			stopped = ssf.name
+		}
+		if stopped != "" {
+			carry = append(carry, line.comments...)
+			emit(updateJob{"U", ssf.shab64, ssf.modtime, ssf.size, ssf.annot, ssf.name, "", 0, nil})
 			continue
 		}
-		ssf_shab64 := s[0:43]
-		ssf_modtime := s[43:51]
-		ssf_length := s[51:pos]
-		ssf_name := s[pos+2:]
 
-		// 1/5 Check for empty triplex
+		// 1/5 Check for empty triplex - the walk has ended, so the rest of the records are deleted files
 		if trip_name == "" {
-			//fmt.Println("[break! #1]")
-			break
+			carry = append(carry, line.comments...)
+			emit(updateJob{"D", ssf.shab64, ssf.modtime, ssf.size, ssf.annot, ssf.name, "", 0, nil})
+			continue
 		}
 
 		// 2/5 If the filesystem is providing names before the current one, we need to process and add them
-		if trip_name < ssf_name {
-			for trip_name < ssf_name {
-				// write record, lazy hash (generated by writer if needed)
-				writeRecord(w, amWriting, form, verbosity, "N", "", trip_modt, trip_size, trip_name, "")
-
-				trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
-				if trip_name == "" {
-					break
-				}
-			} // fall out of this for when trip_name >= ssf_name
-		}
+		// (in the order the SSF is in - walk order, see walkCompare, or byte order for --sort full)
+		for trip_name != "" && compare(trip_name, ssf.name) < 0 {
+			// new record, hashed (and annotated) by updateHash
+			emit(updateJob{tag: "N", modt: trip_modt, size: trip_size, name: trip_name})
+			trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
+		} // fall out of this for when trip_name >= ssf.name
+
+		// (the record's comments go with it - new records before it are written first)
+		carry = append(carry, line.comments...)
 
 		// 3/5 If we are at a matching name, we need to determine if a re-hash is required
-		if trip_name == ssf_name {
-			trip_name = "" // we do this so that 'continuation' knows not to duplicate
-			if ssf_modtime == trip_modt && ssf_length == trip_size && !cli_rehash {
+		if trip_name == ssf.name {
+			unchanged := ssf.modtime == trip_modt && ssf.size == trip_size
+			if unchanged && !cli_rehash && sample() {
+				nsampled++
+				unchanged = false // checked by updateHash (only the hash can differ)
+			}
+			if unchanged && !cli_rehash {
 				// no change (assumed on soft criteria) - pass through
-				writeRecord(w, amWriting, form, verbosity, "U", ssf_shab64, trip_modt, trip_size, ssf_name, "")
+				emit(updateJob{"U", ssf.shab64, trip_modt, trip_size, ssf.annot, ssf.name, "", 0, nil})
 			} else {
-				// has changed - get new digest
-				_, sha_b64 := getFileSha256(ssf_name)
-
+				// may have changed - re-hash (carrying the old digest and annotations for comparison)
 				flag := ""
-				if ssf_modtime != trip_modt {
+				if ssf.modtime != trip_modt {
 					flag += "T"
 				}
-				if ssf_length != trip_size {
+				if ssf.size != trip_size {
 					flag += "S"
 				}
-				if ssf_shab64 != sha_b64 {
-					flag += "H"
-				}
-
-				if flag != "" {
-					// changed
-					writeRecord(w, amWriting, form, verbosity, "C", sha_b64, trip_modt, trip_size, ssf_name, flag)
-				} else {
-					// verified and unchanged
-					writeRecord(w, amWriting, form, verbosity, "V", sha_b64, trip_modt, trip_size, ssf_name, flag)
-				}
+				emit(updateJob{"R", ssf.shab64, trip_modt, trip_size, ssf.annot, ssf.name, flag, 0, nil})
 			}
 
 			trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
@@ -203,61 +561,228 @@ func upd(args []string) {
 		}
 
 		// 4/5 The file stream is before current, so del 'not seen' ssf file (if non-empty)
-		if ssf_name != "" && trip_name > ssf_name {
-			writeRecord(w, amWriting, form, verbosity, "D", "", "", "", ssf_name, "") // verified unchanged
+		if ssf.name != "" && (trip_name == "" || compare(trip_name, ssf.name) > 0) {
+			emit(updateJob{"D", ssf.shab64, ssf.modtime, ssf.size, ssf.annot, ssf.name, "", 0, nil})
 		}
 	}
-
-	// 5/5 Input file exhausted - check for 1x pending, and tail of triplex channel
-	if trip_name == "" {
+	// 5/5 Input file exhausted - the tail of triplex channel is new (unless stopped by a limit)
+	for trip_name != "" && stopped == "" {
+		emit(updateJob{tag: "N", modt: trip_modt, size: trip_size, name: trip_name})
 		trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
 	}
-	for trip_name != "" {
-		writeRecord(w, amWriting, form, verbosity, "N", "", trip_modt, trip_size, trip_name, "") // new
+	if carry = append(carry, tail...); len(carry) > 0 {
+		jobs <- updateJob{tag: "#", comments: carry}
+	}
+	return stopped, nsampled
+}
 
-		trip_name, trip_modt, trip_size = getNextTriplex(fileQueue)
+// complete the jobs that need hashing, using a pool of workers, keeping the jobs in order
+// (new records are only hashed when writing - a dry-run just counts them)
+func updateHash(in chan updateJob, workers int, amWriting bool) chan updateJob {
+	workers = max(workers, 1)
+	out := make(chan updateJob, 4096)
+	pending := make(chan chan updateJob, workers*4) // bounded look-ahead, in SSF order
+
+	go func() {
+		defer close(pending)
+		sem := make(chan struct{}, workers)
+		for j := range in {
+			res := make(chan updateJob, 1)
+			pending <- res
+			if j.tag != "N" && j.tag != "R" {
+				res <- j
+				continue
+			}
+			sem <- struct{}{}
+			go func(j updateJob) {
+				res <- updateComplete(j, amWriting)
+				<-sem
+			}(j)
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range pending {
+			out <- <-res
+		}
+	}()
+
+	return out
+}
+
+func updateComplete(j updateJob, amWriting bool) updateJob {
+	switch j.tag {
+	case "N":
+		j.annot = getAnnotations(j.name)
+		if amWriting {
+			j.shab64 = getEntrySha256(j.name)
+		}
+		if amWriting && j.shab64 == "" {
+			j.tag = "E" // (unreadable - left out)
+		}
+	case "R":
+		// (a quick hash is re-made the same way, so that it can be compared)
+		sha_b64, quick := getFileSha256Quick(j.name, decodeHex(j.size), quickAnnotated(j.annot))
+		if sha_b64 == "" {
+			j.tag = "E" // (unreadable - left out)
+			return j
+		}
+		if j.shab64 != sha_b64 {
+			j.flags += "H"
+		}
+		j.shab64 = sha_b64
+		if j.flags != "" {
+			// changed (annotations are re-made, as the old ones may no longer be true)
+			j.tag = "C"
+			j.annot = annotationAdd(getAnnotations(j.name), quick)
+		} else {
+			// verified and unchanged
+			j.tag = "V"
+		}
 	}
+	return j
+}
 
-	// End of processing - report the number of changes
-	if verbosity == 1 {
-		fmt.Println()
+// ----------------------- Moved directories -----------------------
+
+// A directory that was renamed or moved shows up as a Del for each file in it and a New for each in the
+// new place.  In verbose mode these are held back to the end, and if every record under one directory
+// went, and every record under another arrived, with the same contents and the same names below them,
+// the pair is reported as a single 'Mov dir' line.
+
+type updateMoves struct {
+	dels    []updateJob
+	news    []updateJob
+	kept    map[string]bool // directories with records that were neither new nor deleted
+	lastDir string
+}
+
+func updateMovesInit() *updateMoves {
+	return &updateMoves{kept: map[string]bool{}}
+}
+
+// hold back a New or Del (true), or note where records were kept
+func (m *updateMoves) hold(j updateJob) bool {
+	switch j.tag {
+	case "N":
+		m.news = append(m.news, j)
+		return true
+	case "D":
+		m.dels = append(m.dels, j)
+		return true
 	}
-	nchanges := nnew + ndel + nchg
-	updateDetails := fmt.Sprintf("(new=%d, deleted=%d, changed=%d, unchanged=%d)", nnew, ndel, nchg, nunc)
+	if dir := path.Dir(strings.TrimSuffix(j.name, "/")); dir != m.lastDir {
+		m.lastDir = dir
+		for ; dir != "." && dir != "/" && !m.kept[dir]; dir = path.Dir(dir) {
+			m.kept[dir] = true
+		}
+	}
+	return false
+}
 
-	switch nchanges {
-	case 0:
-		fmt.Println("There were 0 changes - " + fnr + " still good")
-	case 1:
-		fmt.Println("There was 1 change " + updateDetails)
-	default:
-		fmt.Println("There were", nchanges, "changes "+updateDetails)
+// whether a record is under (or is) a directory
+func movesUnder(name string, dir string) bool {
+	name = strings.TrimSuffix(name, "/")
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// the directories a record moved between - the parts of the two names before the path they have in
+// common at the end ("" if either is at the top)
+func movesDirs(from string, to string) (string, string) {
+	a := strings.Split(strings.TrimSuffix(from, "/"), "/")
+	b := strings.Split(strings.TrimSuffix(to, "/"), "/")
+	for len(a) > 1 && len(b) > 1 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
 	}
-	slog.Debug("changes", "new", nnew, "del", ndel, "nchg", nchg, "unchanged", nunc, "tf", tf, "tb", tb)
+	if len(a) == 0 || len(b) == 0 || slices.Equal(a, b) {
+		return "", ""
+	}
+	return strings.Join(a, "/"), strings.Join(b, "/")
+}
 
-	// Optional totals and duplicates statements + file shuffle and final buffer flush
-	if amWriting {
-		reportGrandTotals(w, tf, tb)
-		reportDupes(w)
-		w.Flush()
+// print the held back lines, with wholly moved directories as one line each
+func (m *updateMoves) report() {
+	if len(m.dels)+len(m.news) == 0 {
+		return
+	}
+	// the same contents (or size, as new files are not hashed in a dry-run) and base name
+	hashed := len(m.news) > 0 && m.news[0].shab64 != ""
+	key := func(j updateJob) string {
+		id := "size:" + j.size
+		if hashed {
+			id = j.shab64
+		}
+		return id + "|" + path.Base(strings.TrimSuffix(j.name, "/"))
+	}
+	byKey := map[string][]updateJob{}
+	for _, n := range m.news {
+		byKey[key(n)] = append(byKey[key(n)], n)
+	}
+	type dirPair struct{ from, to string }
+	votes := map[dirPair]int{}
+	for _, d := range m.dels {
+		for _, n := range byKey[key(d)] {
+			if from, to := movesDirs(d.name, n.name); from != "" {
+				votes[dirPair{from, to}]++
+				break
+			}
+		}
+	}
 
-		if cli_overwrite {
-			if nchanges == 0 {
-				// destroy tempfile
-				os.Remove(fnw)
-			} else if nchanges > 0 {
-				fmt.Println("Overwriting " + fnr)
-				os.Remove(fnr)
-				os.Rename(fnw, fnr)
-				os.Exit(1)
-			} else if cli_grand || cli_dupes {
-				// if the ssf file was correct, then we do not update it to preserve its timestamp
-				// but this means that we have to leave its total/dupes statements as-is - i.e. if
-				// we wrote these, then this metadata change would be the only change to the ssf
-				fmt.Println("Ignoring --grand-total and/or --dupes in order to retain file timestamp")
+	// a pair is a move if all that went from one, and all that arrived in the other, is accounted for
+	var moved []dirPair
+	counts := map[dirPair]int{}
+	for p, n := range votes {
+		if m.kept[p.from] || m.kept[p.to] {
+			continue
+		}
+		var ndel, nnew int
+		for _, d := range m.dels {
+			if movesUnder(d.name, p.from) {
+				ndel++
 			}
 		}
+		for _, j := range m.news {
+			if movesUnder(j.name, p.to) {
+				nnew++
+			}
+		}
+		if ndel == n && nnew == n {
+			moved = append(moved, p)
+			counts[p] = n
+		}
 	}
+	slices.SortFunc(moved, func(a, b dirPair) int { return strings.Compare(a.from, b.from) })
 
-	os.Exit(0) //explicit (because we're a rc=0 or rc=1 depending on whether any changes)
+	isMoved := func(name string, to bool) bool {
+		for _, p := range moved {
+			if (!to && movesUnder(name, p.from)) || (to && movesUnder(name, p.to)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range moved {
+		fmt.Printf("    Mov dir: %s/ -> %s/ (%d files)\n", p.from, p.to, counts[p])
+	}
+	var rest []updateJob
+	for _, d := range m.dels {
+		if !isMoved(d.name, false) {
+			rest = append(rest, d)
+		}
+	}
+	for _, n := range m.news {
+		if !isMoved(n.name, true) {
+			rest = append(rest, n)
+		}
+	}
+	slices.SortStableFunc(rest, func(a, b updateJob) int { return walkCompare(a.name, b.name) })
+	for _, j := range rest {
+		msg := "    New: "
+		if j.tag == "D" {
+			msg = "    Del: "
+		}
+		fmt.Println(msg + j.name + recordSizeTrail(decodeHex(j.size)))
+	}
 }
@@ -5,35 +5,226 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// -------------------------------- Cobra management -------------------------------
+
 // verifyCmd represents the verify command
 var verifyCmd = &cobra.Command{
-	Use:   "verify",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:   "verify file.ssf",
+	Short: "Check the files on disk still match an SSF (without rewriting it)",
+	Long: `shaman verify file.ssf [-p path]
+Re-hashes every file named in the SSF and reports those that have changed or gone missing.
+With --device, the single record of an SSF made by 'shaman generate --device' is checked against a
+block device, disk image or stream ('-' for stdin):
+   shaman verify sdcard.ssf --device /dev/sdb1
+If the SSF was made with --annotate owner, files whose owner, group, mode or ACL have changed since are
+reported too ('Prm'), as permission drift.
+The files are looked for from the root recorded in the SSF (where it was generated), or --root, or --path.
+Exit code is 0 if everything matched, 1 otherwise.
+With --interval, verify keeps running, re-checking on that schedule (every file, or a random sample of
+them with --re-hash-sample - the rest are checked for presence and size), and --health serves the result
+of the last check as JSON at /health (status 503 if anything differed).`,
+	Args:    cobra.ExactArgs(1),
+	GroupID: "G1",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("verify called")
+		ver(args)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 
-	// Here you will define your flags and configuration settings.
+	verifyCmd.Flags().StringVarP(&cli_path, "path", "p", "", "Directory the SSF names are relative to (default is current directory)")
+	verifyCmd.Flags().StringVarP(&cli_root, "root", "", "", "Directory the SSF names are relative to (default: the recorded root, else current directory)")
+	verifyCmd.Flags().BoolVarP(&cli_verbose, "verbose", "v", false, "List every file checked")
+	verifyCmd.Flags().StringVarP(&cli_device, "device", "", "", "Check a block device or stream ('-' for stdin) against the single record")
+	verifyCmd.Flags().DurationVarP(&cli_interval, "interval", "", 0, "Keep running, re-checking this often, e.g. 6h")
+	verifyCmd.Flags().StringVarP(&cli_sample, "re-hash-sample", "", "", "With --interval, re-hash a random percentage of the files, e.g. 5%")
+	verifyCmd.Flags().Uint64VarP(&cli_seed, "seed", "", 0, "Random seed for --re-hash-sample (default: different each run)")
+	verifyCmd.Flags().StringVarP(&cli_health, "health", "", "", "With --interval, serve the last check's result at /health on this address, e.g. :8080")
+}
+
+// ----------------------- Verify function below this line -----------------------
+
+func ver(args []string) {
+	num, files, found := getSSFs(args)
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	switch true {
+	case !found[0]:
+		abort(6, "Input SSF file '"+files[0]+"' does not exist")
+	case cli_device != "" && cli_path != "":
+		abort(6, "Give --path or --device, not both")
+	case cli_interval == 0 && (cli_sample != "" || cli_health != ""):
+		abort(6, "--re-hash-sample and --health need --interval")
+	case cli_interval != 0 && cli_device != "":
+		abort(6, "--interval cannot be used with --device")
+	}
+
+	var startpath string = "."
+	if cli_device == "" {
+		if startpath = rootStart(files[0]); startpath != "." {
+			fmt.Println("Checking files from " + startpath + " (" + rootSource() + ")")
+		}
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// verifyCmd.PersistentFlags().String("foo", "", "A help for foo")
+	if cli_interval > 0 {
+		scheduleHealth()
+		kind, sample := scheduleSampler()
+		fmt.Printf("Verifying (%s) every %s (^C to stop)\n", kind, cli_interval)
+		for {
+			ok, changed, missing, drift := verCheck(files[0], startpath, sample)
+			scheduleRecord(kind, ok+changed+missing, changed+drift, missing)
+			fmt.Printf("%s  verified=%d, changed=%d, missing=%d%s\n", time.Now().Format(time.DateTime), ok, changed, missing, verDriftCount(drift))
+			time.Sleep(cli_interval)
+		}
+	}
+
+	ok, changed, missing, drift := verCheck(files[0], startpath, func() bool { return true })
+	if cli_device != "" {
+		abort(6, "SSF '"+files[0]+"' has no record to check the device against")
+	}
+	fmt.Printf("verified=%d, changed=%d, missing=%d%s\n", ok, changed, missing, verDriftCount(drift))
+	if changed+missing+drift > 0 {
+		abort(1, "")
+	}
+}
+
+// the permission drift for the summary line ("" if none)
+func verDriftCount(drift int) string {
+	if drift == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", permissions=%d", drift)
+}
+
+// check the files of an SSF, re-hashing those chosen by rehash (the others are checked for presence and
+// size) - drift counts those whose ownership or permissions differ (whether or not their contents do)
+func verCheck(fnr string, startpath string, rehash func() bool) (ok int, changed int, missing int, drift int) {
+	r, err := ssfOpen(fnr)
+	if err != nil {
+		abort(4, "Can't open "+fnr+" - stuck!")
+	}
+	defer r.Close()
+
+	var s string
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s = scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			// drop comments or empty lines
+			continue
+		}
+
+		rec, valid := parseSSFRecord(s)
+		if !valid {
+			fmt.Printf("Skipping line %d - Invalid format\n", lineno)
+			continue
+		}
+
+		if cli_device != "" {
+			verDevice(rec)
+			os.Exit(0)
+		}
+		if rec.format < 4 {
+			abort(6, "SSF '"+fnr+"' has no names (anonymous format) - nothing to verify against")
+		}
+
+		fn := rootJoin(startpath, rec.name)
+		if entryIsSpecial(rec) {
+			switch verEntry(rec, fn) {
+			case "Mis":
+				fmt.Println("  Mis: " + rec.name)
+				missing++
+			case "Chg":
+				fmt.Println("  Chg: " + rec.name)
+				changed++
+			default:
+				if cli_verbose {
+					fmt.Println("  OK:  " + rec.name)
+				}
+				ok++
+			}
+			continue
+		}
+		st, err := os.Stat(fn)
+		if err != nil || !st.Mode().IsRegular() {
+			fmt.Println("  Mis: " + rec.name)
+			missing++
+			continue
+		}
+		if d := ownerDrift(rec.annot, fn); d != "" {
+			fmt.Println("  Prm: " + rec.name + " (" + d + ")")
+			drift++
+		}
+		if !rehash() {
+			if rec.size != "" && decodeHex(rec.size) != st.Size() {
+				fmt.Println("  Chg: " + rec.name)
+				changed++
+				continue
+			}
+		} else if _, sha := getFileSha256(fn); sha != rec.shab64 {
+			fmt.Println("  Chg: " + rec.name)
+			changed++
+			continue
+		}
+		if cli_verbose {
+			fmt.Println("  OK:  " + rec.name)
+		}
+		ok++
+	}
+	return ok, changed, missing, drift
+}
+
+// check a device (or stream) against a record - size first, as a short read is the common failure
+func verDevice(rec ssfRecord) {
+	_, sha, nbytes := getStreamSha256(cli_device)
+	switch {
+	case rec.size != "" && decodeHex(rec.size) != nbytes:
+		fmt.Printf("%s: size differs (%s, expected %s)\n", cli_device, bytesAsString(nbytes), bytesAsString(decodeHex(rec.size)))
+		abort(1, "")
+	case sha != rec.shab64:
+		fmt.Printf("%s: hash differs (%s read)\n", cli_device, bytesAsString(nbytes))
+		abort(1, "")
+	}
+	fmt.Printf("%s: verified (%s)\n", cli_device, bytesAsString(nbytes))
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// verifyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// check a directory, link or special file record (see entries.go) - "Mis", "Chg" or "" if it is unchanged
+func verEntry(rec ssfRecord, fn string) string {
+	if strings.HasSuffix(rec.name, "/") {
+		if st, err := os.Stat(fn); err != nil || !st.IsDir() {
+			return "Mis"
+		}
+		if entryDirSha256(fn) != rec.shab64 {
+			return "Chg"
+		}
+		return ""
+	}
+	if kind := entrySpecialType(rec.annot); kind != "" {
+		st, err := os.Lstat(fn)
+		if err != nil {
+			return "Mis"
+		}
+		if now, dev := entrySpecialInfo(st); now != kind || dev != annotationMap(rec.annot)["dev"] {
+			return "Chg"
+		}
+		return ""
+	}
+	st, err := os.Lstat(fn)
+	if err != nil || st.Mode()&os.ModeSymlink == 0 {
+		return "Mis"
+	}
+	if target, err := os.Readlink(fn); err != nil || target != entryLinkTarget(rec.annot) {
+		return "Chg"
+	}
+	return ""
 }
@@ -4,36 +4,121 @@ Copyright © 2025 Jon Knox <jon@k2x.io>
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+// -------------------------------- Cobra management -------------------------------
+
 // whereisCmd represents the whereis command
 var whereisCmd = &cobra.Command{
-	Use:   "whereis",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:   "whereis sha file.ssf...",
+	Short: "List the names a SHA has in one or more SSFs",
+	Long: `shaman whereis sha file.ssf [file.ssf...]
+Lists every name with the given SHA in the SSFs, as 'file.ssf: name'.  The SHA can be given as hex (as
+made by sha256sum), as base64 (as in an SSF), or as a prefix of either (at least 6 characters) as long as
+it matches only one SHA.  The exit code is 1 if the SHA is not found.  See also 'shaman lookup'.`,
+	Args:    cobra.MinimumNArgs(2),
+	GroupID: "G2",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("whereis called")
+		whe(args)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(whereisCmd)
+}
 
-	// Here you will define your flags and configuration settings.
+// ----------------------- Whereis function below this line -----------------------
+
+// a SHA to look for - hex or base64, whole or a prefix
+type shaQuery struct {
+	raw  string
+	hexp string // lower-case hex prefix ("" if not hex)
+	b64p string // base64 prefix ("" if not base64)
+}
+
+const shaQueryMin = 6 // shortest prefix accepted
+
+func shaQueryParse(s string) shaQuery {
+	s = strings.TrimSpace(s)
+	q := shaQuery{raw: s}
+	if len(s) < shaQueryMin {
+		abort(6, fmt.Sprintf("SHA '%s' is too short (give at least %d characters)", s, shaQueryMin))
+	}
+	if len(s) <= 64 && strings.Trim(strings.ToLower(s), "0123456789abcdef") == "" {
+		q.hexp = strings.ToLower(s)
+	}
+	if len(s) <= 43 && strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/") == "" {
+		q.b64p = s
+	}
+	if q.hexp == "" && q.b64p == "" {
+		abort(6, "'"+s+"' is not a SHA256 (or prefix) in hex or base64")
+	}
+	return q
+}
+
+func (q shaQuery) match(shab64 string) bool {
+	if q.b64p != "" && strings.HasPrefix(shab64, q.b64p) {
+		return true
+	}
+	return q.hexp != "" && strings.HasPrefix(hex.EncodeToString(shaBase64ToShaBinary(shab64)), q.hexp)
+}
+
+// a record found by a query, and the SSF it is in
+type shaFound struct {
+	ssf string
+	rec ssfRecord
+}
+
+// find the records matching a query in the SSFs - aborting if the query matches more than one SHA
+func shaQueryFind(q shaQuery, files []string) []shaFound {
+	var found []shaFound
+	var shas []string
+	for _, fn := range files {
+		ssfForEachRecord(fn, func(rec ssfRecord) {
+			if !q.match(rec.shab64) {
+				return
+			}
+			found = append(found, shaFound{fn, rec})
+			if !slices.Contains(shas, rec.shab64) {
+				shas = append(shas, rec.shab64)
+			}
+		})
+	}
+	if len(shas) > 1 {
+		for _, sha := range shas {
+			fmt.Printf("  %s  (hex %s)\n", sha, hex.EncodeToString(shaBase64ToShaBinary(sha)))
+		}
+		abort(6, fmt.Sprintf("SHA prefix '%s' is ambiguous - it matches the %d SHAs above", q.raw, len(shas)))
+	}
+	return found
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// whereisCmd.PersistentFlags().String("foo", "", "A help for foo")
+func whe(args []string) {
+	q := shaQueryParse(args[0])
+	num, files, found := getSSFs(args[1:])
+	slog.Debug("cli handler", "num", num, "files", files, "found", found)
+	for x, fn := range files {
+		if !found[x] {
+			abort(6, "SSF file '"+fn+"' does not exist")
+		}
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// whereisCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	hits := shaQueryFind(q, files)
+	if len(hits) == 0 {
+		abort(1, "SHA '"+q.raw+"' not found")
+	}
+	for _, h := range hits {
+		name := h.rec.name
+		if h.rec.format < 4 {
+			name = "(anonymous)"
+		}
+		fmt.Printf("%s: %s\n", h.ssf, name)
+	}
 }
@@ -5,8 +5,10 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,47 +16,161 @@ import (
 
 // ----------------------- Shared writer function -----------------------
 
-// counters
-var tf int64        // total files
-var tb int64        // total bytes
-var nnew int64      // new records written
-var nchg int64      // changed record written
-var ndel int64      // deleted (dropped)
-var nunc int64      // unchanged
-var dot int         // dot ticker
-var flushTime int64 // time of last buffer flush
-
-func writeInit(fnw string) *bufio.Writer {
-	// progress counters (for future, in case we launch two write sessions)
-	tf = 0
-	tb = 0
-	nnew = 0
-	nchg = 0
-	ndel = 0
-	nunc = 0
-	dot = 0
-
-	// buffer
-	var w *bufio.Writer // buffer writer (local!)
-	if fnw != "" {
+// An SSF being written, with the counts of what has been written to it.  Each command opens its own
+// with writeInit, and writes records through it (it is also a *bufio.Writer, for comments and the like).
+type writeSSF struct {
+	*bufio.Writer
+	crypt     *cryptWriter // encryption filter being written through (or nil)
+	file      *os.File     // file being written to (or nil)
+	flushTime int64        // time of last buffer flush
+	tf        int64        // total files
+	tb        int64        // total bytes
+	nnew      int64        // new records written
+	nchg      int64        // changed records written
+	ndel      int64        // deleted (dropped)
+	nunc      int64        // unchanged
+	dot       int          // dot ticker
+	dry       *dryCounter  // with --dry-run, what would have been written (or nil)
+}
+
+// With --dry-run, a writing command does everything but write: the output is counted rather than
+// created, and nothing is replaced or removed - the counts and destination are reported instead.
+
+var cli_dryrun bool = false // show what would be written, without touching any file
+
+// where the output would have gone, and how much of it there was
+type dryCounter struct {
+	fn    string
+	lines int64
+	bytes int64
+}
+
+func (d *dryCounter) Write(p []byte) (int, error) {
+	d.lines += int64(bytes.Count(p, []byte("\n")))
+	d.bytes += int64(len(p))
+	return len(p), nil
+}
+
+func writeInit(fnw string) *writeSSF {
+	w := &writeSSF{flushTime: time.Now().Unix()}
+	if cli_dryrun {
+		// count what would be written
+		w.dry = &dryCounter{fn: fnw}
+		if fnw == "" {
+			w.dry.fn = "stdout"
+		}
+		w.Writer = bufio.NewWriterSize(w.dry, 64*1024)
+	} else if cli_encryptto != "" {
+		// write through the encryption filter
+		w.crypt = cryptCreate(fnw)
+		w.Writer = bufio.NewWriterSize(w.crypt, 64*1024)
+	} else if fnw != "" {
 		// write to file
-		//var err error
 		fwh, err := os.Create(fnw)
 		if err != nil {
 			abort(4, "Cannot create file "+fnw)
 		}
-		w = bufio.NewWriterSize(fwh, 64*1024)
+		w.Writer = bufio.NewWriterSize(fwh, 64*1024)
+		w.file = fwh
 	} else {
 		// write to stdout
-		w = bufio.NewWriterSize(os.Stdout, 512) // more 'real time'
+		w.Writer = bufio.NewWriterSize(os.Stdout, 512) // more 'real time'
 	}
-	flushTime = time.Now().Unix()
-
 	return w
 }
 
+// replace an SSF by the new version written beside it (to temp, in the same directory) - only once the
+// new one is on disk and parses, and by a rename, so that a crash at any point leaves one or the other
+// whole.  (An encrypted one cannot be checked without the key, so is only synced.)
+func ssfReplace(temp string, fn string) {
+	if cli_dryrun {
+		fmt.Println("Dry run: " + fn + " would be replaced by the new version")
+		return
+	}
+	f, err := os.Open(temp)
+	if err == nil {
+		err = f.Sync()
+		f.Close()
+	}
+	if err != nil {
+		abort(4, "Cannot sync "+temp+" - "+fn+" left as it was")
+	}
+	if cli_encryptto == "" {
+		if n := ssfBadLine(temp); n > 0 {
+			abort(4, fmt.Sprintf("New version %s does not parse (line %d) - %s left as it was", temp, n, fn))
+		}
+	}
+	if err := os.Rename(temp, fn); err != nil {
+		abort(4, "Cannot replace "+fn+" by "+temp+": "+err.Error())
+	}
+	if d, err := os.Open(filepath.Dir(fn)); err == nil {
+		d.Sync() // (the rename itself)
+		d.Close()
+	}
+}
+
+// the number of the first line of a file that is not a comment or record (0 if there is none)
+func ssfBadLine(fn string) int {
+	r, err := ssfOpen(fn)
+	if err != nil {
+		return 1
+	}
+	defer r.Close()
+	var lineno int
+	scanner := ssfScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		lineno++
+		if len(s) == 0 || s[0:1] == "#" {
+			continue
+		}
+		if _, ok := parseSSFRecord(s); !ok {
+			if _, ok := parseSha256sumLine(s); !ok {
+				return lineno
+			}
+		}
+	}
+	return 0
+}
+
+// flush the output, and finish the encryption if there is any
+func (w *writeSSF) close() {
+	w.Flush()
+	if w.dry != nil {
+		fmt.Printf("Dry run: would write %s lines (%s) to %s\n", intAsString(w.dry.lines), bytesAsString(w.dry.bytes), w.dry.fn)
+		w.dry = nil
+	}
+	if w.crypt != nil {
+		w.crypt.Close()
+		w.crypt = nil
+	}
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+// counts of records (and bytes) passed to record - all but the deleted ones count as files
+func (w *writeSSF) files() int64     { return w.tf }
+func (w *writeSSF) bytes() int64     { return w.tb }
+func (w *writeSSF) added() int64     { return w.nnew }
+func (w *writeSSF) changed() int64   { return w.nchg }
+func (w *writeSSF) deleted() int64   { return w.ndel }
+func (w *writeSSF) unchanged() int64 { return w.nunc }
+
+// the size of a big file, for the end of an explanation line ("" if not big)
+func recordSizeTrail(nbytes int64) string {
+	switch {
+	case nbytes > 1*1024*1024 && cli_human:
+		return " (" + sizeAsString(nbytes) + ")"
+	case nbytes > 1*1024*1024:
+		return " (" + intAsString(int64(nbytes/(1024*1024))) + "MB)"
+	}
+	return ""
+}
+
 // verbosity: 0=nothing, 1=dots, 2=explanation line
-func writeRecord(w *bufio.Writer, amWriting bool, format int, verbosity int, tag string, shab64 string, modt string, size string, name string, flags string) {
+func (w *writeSSF) record(amWriting bool, format int, verbosity int, tag string, shab64 string, modt string, size string, annot string, name string, flags string) {
 	// type and counters
 	msg := ""
 	trail := ""
@@ -62,10 +178,10 @@ func writeRecord(w *bufio.Writer, amWriting bool, format int, verbosity int, tag
 	switch tag {
 	case "N":
 		msg = "  New: " + name
-		nnew++
+		w.nnew++
 	case "C":
 		msg = "  Chg: " + name
-		nchg++
+		w.nchg++
 		if strings.Contains(flags, "T") {
 			trail += " [Time]"
 		}
@@ -78,56 +194,47 @@ func writeRecord(w *bufio.Writer, amWriting bool, format int, verbosity int, tag
 	case "U":
 		// Unchanged
 		msg = "  N/C: " + name
-		nunc++
+		w.nunc++
 	case "V":
 		// Verified unchanged (we checked the )
 		msg = "  N/C: " + name + " (verified)"
-		nunc++
+		w.nunc++
 	case "D":
 		// Deleted - does not produce record
 		msg = "  Del: " + name
-		ndel++
+		w.ndel++
 	default:
 		abort(10, "unknown tag")
 	}
 
 	// terminal report
-	dot++
+	w.dot++
 	switch true {
 	case verbosity == 1 && (tag == "N" || tag == "C"):
-		if dot%100 == 0 {
+		if w.dot%100 == 0 {
 			fmt.Print(".")
 		}
 	case verbosity == 2 && tag != "U":
-		if nbytes > 1*1024*1024 {
-			trail += " (" + intAsStringWithCommas(int64(nbytes/(1024*1024))) + "MB)"
-		}
-		fmt.Println("  " + msg + trail)
+		fmt.Println("  " + msg + trail + recordSizeTrail(nbytes))
+	}
+
+	// totals (kept even when not writing, so that limits work the same in a dry-run)
+	if tag != "D" {
+		w.tf++
+		w.tb += nbytes
 	}
 
 	// pushing to output buffer
 	if amWriting && tag != "D" {
 		if shab64 == "" {
 			// lazy hash
-			_, shab64 = getFileSha256(name) // horrible - to be resolved
+			shab64 = getEntrySha256(name) // horrible - to be resolved
 		}
 		//fmt.Println(format)
 		switch format {
-		case 1:
-			// anonymise to SHA256 only
-			fmt.Fprintln(w, shab64)
-		case 2:
-			// anonymise to SHA256 + Modify time only
-			fmt.Fprintln(w, shab64+modt)
-		case 3:
-			// anonymise to SHA256 + Modify time + Size (full identifier) only
-			fmt.Fprintln(w, shab64+modt+size)
-		case 4:
-			// generate identifier + name (drop annotations)
-			fmt.Fprintln(w, shab64+modt+size+" :"+name)
-		case 5:
-			// full SSF record
-			fmt.Fprintln(w, shab64+modt+size+" :"+name)
+		case 1, 2, 3, 4, 5:
+			// SSF record - anonymised to SHA (1), +modify time (2), +size (3), +name (4) or full (5)
+			fmt.Fprintln(w, ssfRecordLine(ssfRecord{format, shab64, modt, size, annot, name}))
 		case 9:
 			// md5sum compatibility mode
 			shabin := shaBase64ToShaBinary(shab64)
@@ -137,14 +244,11 @@ func writeRecord(w *bufio.Writer, amWriting bool, format int, verbosity int, tag
 			abort(10, "Format not valid")
 		}
 
-		tf++
-		tb += nbytes
-
 		// flush control - every minute
-		if time.Now().Unix() > flushTime+60 {
+		if time.Now().Unix() > w.flushTime+60 {
 			//fmt.Println("Flushing output buffer!")
 			w.Flush()
-			flushTime = time.Now().Unix()
+			w.flushTime = time.Now().Unix()
 		}
 	}
 }
@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ----------------------- Minimal XLSX writer -----------------------
+
+// An .xlsx is a zip of XML parts.  This writes just enough of the format for a workbook of plain sheets:
+// inline strings (no shared-string table), numbers, dates, a bold frozen header row with an auto-filter,
+// and column widths.  Sheets are streamed, one at a time, so a large sheet is never held in memory.
+
+const xlsxMaxRows = 1048576 // Excel's limit (including the header)
+
+// cell styles (indexes into cellXfs in styles.xml, below)
+const (
+	xlsxPlain  = 0
+	xlsxHeader = 1 // bold
+	xlsxNumber = 2 // #,##0
+	xlsxDate   = 3 // yyyy-mm-dd hh:mm:ss
+)
+
+// a cell value - exactly one of the fields is used
+type xlsxCell struct {
+	s    string // text
+	n    int64  // number
+	t    int64  // unix time (shown as a date)
+	kind int    // xlsxPlain (text), xlsxNumber or xlsxDate
+}
+
+func xlsxText(s string) xlsxCell { return xlsxCell{s: s, kind: xlsxPlain} }
+func xlsxNum(n int64) xlsxCell   { return xlsxCell{n: n, kind: xlsxNumber} }
+func xlsxTime(t int64) xlsxCell  { return xlsxCell{t: t, kind: xlsxDate} }
+
+type xlsxWriter struct {
+	f      *os.File
+	z      *zip.Writer
+	sheets []string      // names, in order
+	w      *bufio.Writer // current sheet
+	row    int           // rows written to the current sheet
+	cols   int           // columns in the current sheet
+	full   bool          // the current sheet hit the row limit
+}
+
+func xlsxCreate(fn string) *xlsxWriter {
+	f, err := os.Create(fn)
+	if err != nil {
+		abort(4, "Cannot create file "+fn)
+	}
+	return &xlsxWriter{f: f, z: zip.NewWriter(f)}
+}
+
+// column letter(s) for a 0-based column number
+func xlsxColumn(c int) string {
+	s := ""
+	for c++; c > 0; c = (c - 1) / 26 {
+		s = string(rune('A'+(c-1)%26)) + s
+	}
+	return s
+}
+
+// start a new sheet with a header row and column widths
+func (x *xlsxWriter) sheet(name string, headers []string, widths []int) {
+	x.endSheet()
+	x.sheets = append(x.sheets, name)
+	part, err := x.z.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		abort(4, "Cannot write workbook")
+	}
+	x.w = bufio.NewWriterSize(part, 64*1024)
+	x.row, x.cols, x.full = 0, len(headers), false
+
+	fmt.Fprint(x.w, xml.Header)
+	fmt.Fprint(x.w, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	fmt.Fprint(x.w, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	fmt.Fprint(x.w, `<cols>`)
+	for c, wid := range widths {
+		fmt.Fprintf(x.w, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, c+1, c+1, wid)
+	}
+	fmt.Fprint(x.w, `</cols><sheetData>`)
+
+	var cells []xlsxCell
+	for _, h := range headers {
+		cells = append(cells, xlsxCell{s: h, kind: xlsxHeader})
+	}
+	x.add(cells...)
+}
+
+// add a row to the current sheet (rows past Excel's limit are dropped, with a warning)
+func (x *xlsxWriter) add(cells ...xlsxCell) {
+	if x.row >= xlsxMaxRows {
+		if !x.full {
+			fmt.Fprintf(os.Stderr, "Sheet '%s' is full (%d rows) - further rows dropped\n", x.sheets[len(x.sheets)-1], xlsxMaxRows)
+			x.full = true
+		}
+		return
+	}
+	x.row++
+	fmt.Fprintf(x.w, `<row r="%d">`, x.row)
+	for c, cell := range cells {
+		ref := xlsxColumn(c) + strconv.Itoa(x.row)
+		switch cell.kind {
+		case xlsxNumber:
+			fmt.Fprintf(x.w, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxNumber, cell.n)
+		case xlsxDate:
+			// Excel counts days from 1900 (with its leap-year bug, hence 25569 for 1970-01-01)
+			fmt.Fprintf(x.w, `<c r="%s" s="%d"><v>%.6f</v></c>`, ref, xlsxDate, float64(cell.t)/86400+25569)
+		default:
+			fmt.Fprintf(x.w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, cell.kind)
+			xml.EscapeText(x.w, []byte(cell.s))
+			fmt.Fprint(x.w, `</t></is></c>`)
+		}
+	}
+	fmt.Fprint(x.w, `</row>`)
+}
+
+func (x *xlsxWriter) endSheet() {
+	if x.w == nil {
+		return
+	}
+	fmt.Fprintf(x.w, `</sheetData><autoFilter ref="A1:%s%d"/></worksheet>`, xlsxColumn(x.cols-1), max(x.row, 1))
+	x.w.Flush()
+	x.w = nil
+}
+
+// write the workbook-level parts and close the file
+func (x *xlsxWriter) close() {
+	x.endSheet()
+
+	var types, rels, sheets strings.Builder
+	for n, name := range x.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n+1, n+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, n+1, n+1)
+	}
+	nstyles := len(x.sheets) + 1
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, nstyles) +
+			`</Relationships>`},
+		{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="4">` +
+			`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+			`<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+			`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+			`</cellXfs></styleSheet>`},
+	}
+	for _, p := range parts {
+		part, err := x.z.Create(p.name)
+		if err != nil {
+			abort(4, "Cannot write workbook")
+		}
+		io.WriteString(part, xml.Header+p.body)
+	}
+
+	if err := x.z.Close(); err != nil {
+		abort(4, "Cannot write workbook (disk full?)")
+	}
+	x.f.Close()
+}
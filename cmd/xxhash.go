@@ -0,0 +1,123 @@
+/*
+Copyright © 2025 Jon Knox <jon@k2x.io>
+*/
+package cmd
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// ----------------------- XXH64 (non-cryptographic pre-filter) -----------------------
+
+// XXH64 is many times faster than SHA256, so it is used to weed out the files that cannot be duplicates
+// before paying for a SHA256 of the rest.  It is never recorded: a match only means "worth hashing".
+// (An implementation of the published algorithm, with a seed of 0.)
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int // bytes in buf
+}
+
+func xxh64New() *xxh64 {
+	p1, p2 := xxPrime1, xxPrime2 // (wrapping arithmetic, as at run time)
+	return &xxh64{v: [4]uint64{p1 + p2, p2, 0, -p1}}
+}
+
+func xxRound(acc uint64, input uint64) uint64 {
+	acc += input * xxPrime2
+	return bits.RotateLeft64(acc, 31) * xxPrime1
+}
+
+func xxMerge(acc uint64, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (x *xxh64) stripe(b []byte) {
+	for i := range x.v {
+		x.v[i] = xxRound(x.v[i], binary.LittleEndian.Uint64(b[i*8:]))
+	}
+}
+
+func (x *xxh64) Write(p []byte) (int, error) {
+	size := len(p)
+	x.total += uint64(size)
+	if x.n > 0 {
+		c := copy(x.buf[x.n:], p)
+		x.n += c
+		p = p[c:]
+		if x.n < 32 {
+			return size, nil
+		}
+		x.stripe(x.buf[:])
+		x.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		x.stripe(p)
+	}
+	x.n = copy(x.buf[:], p)
+	return size, nil
+}
+
+func (x *xxh64) Sum64() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		v := x.v
+		h = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) + bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, vi := range v {
+			h = xxMerge(h, vi)
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += x.total
+
+	p := x.buf[:x.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+// the XXH64 of a file (ok=false if it cannot be read)
+func getFileXXH64(fn string) (sum uint64, ok bool) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	x := xxh64New()
+	if _, err := io.Copy(x, f); err != nil {
+		return 0, false
+	}
+	return x.Sum64(), true
+}